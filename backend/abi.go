@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ContractABI is the ABI of a contract, as uploaded to the registry.
+type ContractABI struct {
+	Address   string    `json:"address" gorm:"column:address;primaryKey"`
+	Name      string    `json:"name,omitempty" gorm:"column:name"`
+	ABI       string    `json:"abi,omitempty" gorm:"column:abi;type:text"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at"`
+}
+
+// migrateABIs creates the table of the ABI registry.
+func (b *mixinBackend) migrateABIs(ctx context.Context) error {
+	return b.db.WithContext(ctx).Table(b.table("abis")).AutoMigrate(&ContractABI{})
+}
+
+func (b *mixinBackend) ContractABI(ctx context.Context, address common.Address) (*ContractABI, error) {
+	var row ContractABI
+	err := b.db.WithContext(ctx).Table(b.table("abis")).
+		Where("address = ?", addressHex(address)).
+		Take(&row).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func (b *mixinBackend) ContractABIs(ctx context.Context, offset, limit int) ([]*ContractABI, error) {
+	var rows []*ContractABI
+	err := b.db.WithContext(ctx).Table(b.table("abis")).
+		Select("address, name, created_at, updated_at").
+		Order("address ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&rows).
+		Error
+	return rows, err
+}
+
+func (b *mixinBackend) PutContractABI(ctx context.Context, address common.Address, name, abi string) error {
+	now := time.Now().UTC()
+	row := &ContractABI{
+		Address:   addressHex(address),
+		Name:      name,
+		ABI:       abi,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return b.db.WithContext(ctx).Table(b.table("abis")).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "abi", "updated_at"}),
+		}).
+		Create(row).
+		Error
+}
+
+func (b *mixinBackend) DeleteContractABI(ctx context.Context, address common.Address) (bool, error) {
+	result := b.db.WithContext(ctx).Table(b.table("abis")).
+		Where("address = ?", addressHex(address)).
+		Delete(&ContractABI{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TransactionRef locates a transaction on the chain.
+type TransactionRef struct {
+	BlockNumber uint64      `json:"blockNumber"`
+	Position    uint64      `json:"transactionPosition"`
+	Hash        common.Hash `json:"transactionHash"`
+}
+
+// addressHex returns the address in the lowercase form stored in the tables.
+func addressHex(address common.Address) string {
+	return strings.ToLower(address.Hex())
+}
+
+func (b *mixinBackend) ContractCreations(ctx context.Context, address common.Address) ([]*CallFrame, error) {
+	var traces []Trace
+	l := b.layout
+	err := b.traces(ctx).
+		Where(l.col("to_address")+" = ?", addressHex(address)).
+		Where(l.col("trace_type")+" IN ?", []string{"create", "create2"}).
+		Order(l.order(false, "blknum", "txpos", "trace_address")).
+		Find(&traces).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	return b.callFrames(ctx, traces)
+}
+
+func (b *mixinBackend) SearchTransactions(ctx context.Context, address common.Address, fromBlock, toBlock uint64, descending bool, limit int) ([]*TransactionRef, error) {
+	type row struct {
+		BlockNum        uint64 `gorm:"column:blknum"`
+		TransactionPos  uint64 `gorm:"column:txpos"`
+		TransactionHash string `gorm:"column:txhash"`
+	}
+	var (
+		l    = b.layout
+		addr = addressHex(address)
+	)
+	sql := b.traces(ctx).
+		Distinct(l.selects("blknum", "txpos", "txhash")).
+		Where(l.col("blknum")+" BETWEEN ? AND ?", fromBlock, toBlock).
+		Where("("+l.col("from_address")+" = ? OR "+l.col("to_address")+" = ?)", addr, addr).
+		Where(l.col("txhash") + " IS NOT NULL").
+		Order(l.order(descending, "blknum", "txpos"))
+	if limit > 0 {
+		sql = sql.Limit(limit)
+	}
+	var rows []row
+	if err := sql.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	refs := make([]*TransactionRef, len(rows))
+	for i, r := range rows {
+		refs[i] = &TransactionRef{
+			BlockNumber: r.BlockNum,
+			Position:    r.TransactionPos,
+			Hash:        common.HexToHash(r.TransactionHash),
+		}
+	}
+	return refs, nil
+}
+
+// Direction restricts which side of a frame an address filter matches.
+type Direction string
+
+const (
+	DirectionBoth Direction = ""     // The address is either the sender or the receiver
+	DirectionFrom Direction = "from" // The address is the sender
+	DirectionTo   Direction = "to"   // The address is the receiver
+)
+
+// TraceCursor is the position of a frame in the (blknum, txpos, trace_address)
+// order of the traces table, used to resume paginated queries.
+type TraceCursor struct {
+	BlockNumber         uint64 `json:"b"`
+	TransactionPosition uint64 `json:"t"`
+	TraceAddress        string `json:"a"`
+}
+
+// TraceFilter selects frames from the traces table.
+type TraceFilter struct {
+	Address        *common.Address // Only frames sent from or to the address
+	Direction      Direction       // Side of the frames the address is matched against
+	FromBlock      uint64          // First block of the range (inclusive)
+	ToBlock        uint64          // Last block of the range (inclusive)
+	Types          []string        // Only frames of these trace types, e.g. "call" or "create"
+	TopLevel       *bool           // Only top-level (true) or internal (false) frames
+	OnlyValueCalls bool            // Skip call frames which don't transfer value
+	Descending     bool            // Newest frames first
+	After          *TraceCursor    // Only frames strictly after this position in the iteration order
+	Offset         int             // Number of matching frames to skip
+	Limit          int             // Maximum number of frames to return, 0 for no limit
+}
+
+// FilterTraces returns the frames matching the filter. If the limit cut the
+// result short, the cursor of the last returned frame is returned as well.
+func (b *mixinBackend) FilterTraces(ctx context.Context, filter *TraceFilter) ([]*CallFrame, *TraceCursor, error) {
+	l := b.layout
+	sql := b.traces(ctx).Where(l.col("blknum")+" BETWEEN ? AND ?", filter.FromBlock, filter.ToBlock)
+	if filter.Address != nil {
+		addr := addressHex(*filter.Address)
+		switch filter.Direction {
+		case DirectionFrom:
+			sql = sql.Where(l.col("from_address")+" = ?", addr)
+		case DirectionTo:
+			sql = sql.Where(l.col("to_address")+" = ?", addr)
+		default:
+			sql = sql.Where("("+l.col("from_address")+" = ? OR "+l.col("to_address")+" = ?)", addr, addr)
+		}
+	}
+	if len(filter.Types) > 0 {
+		sql = sql.Where(l.col("trace_type")+" IN ?", filter.Types)
+	}
+	if filter.TopLevel != nil {
+		sql = sql.Where(l.topLevel(*filter.TopLevel))
+	}
+	if filter.OnlyValueCalls {
+		sql = sql.Where("("+l.col("trace_type")+" <> ? OR "+l.col("value")+" > 0)", "call")
+	}
+	if c := filter.After; c != nil {
+		op := ">"
+		if filter.Descending {
+			op = "<"
+		}
+		placeholder, address := l.traceAddressCursor(c.TraceAddress)
+		cond := fmt.Sprintf("(%s, %s, %s) %s (?, ?, %s)", l.col("blknum"), l.col("txpos"), l.traceAddressKey(), op, placeholder)
+		sql = sql.Where(cond, c.BlockNumber, c.TransactionPosition, address)
+	}
+	sql = sql.Order(l.order(filter.Descending, "blknum", "txpos", "trace_address")).Offset(filter.Offset)
+	if filter.Limit > 0 {
+		// Fetch one more row to know whether the result was cut short
+		sql = sql.Limit(filter.Limit + 1)
+	}
+	var traces []Trace
+	if err := sql.Find(&traces).Error; err != nil {
+		return nil, nil, err
+	}
+	var cursor *TraceCursor
+	if filter.Limit > 0 && len(traces) > filter.Limit {
+		traces = traces[:filter.Limit]
+		last := traces[len(traces)-1]
+		cursor = &TraceCursor{
+			BlockNumber:         last.BlockNum,
+			TransactionPosition: last.TransactionPos,
+			TraceAddress:        last.TraceAddress,
+		}
+	}
+	frames, err := b.callFrames(ctx, traces)
+	if err != nil {
+		return nil, nil, err
+	}
+	return frames, cursor, nil
+}
@@ -0,0 +1,145 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// wideFixture replaces the traces of the first fixture block by a call with
+// n children, the second one calling further. The frames are loaded in
+// reverse, their depth-first order is returned.
+func wideFixture(t *testing.T, n int) (*mixinBackend, [][]int) {
+	t.Helper()
+	b, fixture := newTestDevBackend(t, "ethereum.json")
+	block := fixture.Blocks[0]
+	blob, err := json.Marshal(block.Traces[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := func(address []int, subtraces int) *CallFrame {
+		f := new(CallFrame)
+		if err := json.Unmarshal(blob, f); err != nil {
+			t.Fatal(err)
+		}
+		f.TraceAddress, f.Subtraces = address, subtraces
+		return f
+	}
+	order := [][]int{{}}
+	frames := []*CallFrame{frame([]int{}, n)}
+	for i := 0; i < n; i++ {
+		subtraces := 0
+		if i == 1 {
+			subtraces = 1
+		}
+		order = append(order, []int{i})
+		frames = append(frames, frame([]int{i}, subtraces))
+		if i == 1 {
+			order = append(order, []int{1, 0})
+			frames = append(frames, frame([]int{1, 0}, 0))
+		}
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	block.Traces = frames
+	if err := b.LoadFixture(context.Background(), &Fixture{Chain: fixture.Chain, Blocks: []*FixtureBlock{block}}); err != nil {
+		t.Fatal(err)
+	}
+	return b, order
+}
+
+func checkOrder(t *testing.T, frames []*CallFrame, want [][]int) {
+	t.Helper()
+	if len(frames) != len(want) {
+		t.Fatalf("have %d frames, want %d", len(frames), len(want))
+	}
+	for i, frame := range frames {
+		if CompareTraceAddress(frame.TraceAddress, want[i]) != 0 {
+			t.Errorf("frame %d: have %v, want %v", i, frame.TraceAddress, want[i])
+		}
+	}
+}
+
+func TestTraceAddressOrder(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		b, order = wideFixture(t, 12)
+		number   = uint64(17034870)
+		from     = common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")
+	)
+	frames, _, err := b.FilterTraces(ctx, &TraceFilter{Address: &from, FromBlock: number, ToBlock: number})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrder(t, frames, order)
+
+	frames, _, err = b.FilterTraces(ctx, &TraceFilter{Address: &from, FromBlock: number, ToBlock: number, Descending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := make([][]int, len(order))
+	for i := range order {
+		reversed[i] = order[len(order)-1-i]
+	}
+	checkOrder(t, frames, reversed)
+
+	// Block and transaction traces come in the order of the query alone
+	frames, err = b.TraceBlock(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrder(t, frames, order)
+	frames, err = b.TraceTransaction(ctx, *frames[0].TransactionHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrder(t, frames, order)
+}
+
+func TestFilterTracesPagination(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		b, _ = wideFixture(t, 12)
+	)
+	for _, desc := range []bool{false, true} {
+		filter := &TraceFilter{FromBlock: 0, ToBlock: 1 << 62, Descending: desc}
+		all, cursor, err := b.FilterTraces(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cursor != nil {
+			t.Fatalf("cursor %+v without limit", cursor)
+		}
+		// Pages end within the wide transaction and across blocks
+		var paged []*CallFrame
+		filter.Limit = 3
+		for page := 0; ; page++ {
+			frames, next, err := b.FilterTraces(ctx, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged = append(paged, frames...)
+			if next == nil {
+				break
+			}
+			if page > len(all) {
+				t.Fatal("pagination doesn't end")
+			}
+			filter.After = next
+		}
+		if len(paged) != len(all) {
+			t.Fatalf("descending %v: paged %d frames, want %d", desc, len(paged), len(all))
+		}
+		for i := range all {
+			a, p := all[i], paged[i]
+			if a.BlockNumber != p.BlockNumber || a.TransactionPosition != p.TransactionPosition || CompareTraceAddress(a.TraceAddress, p.TraceAddress) != 0 {
+				t.Errorf("descending %v: frame %d: paged %d/%d/%v, want %d/%d/%v", desc, i,
+					p.BlockNumber, p.TransactionPosition, p.TraceAddress, a.BlockNumber, a.TransactionPosition, a.TraceAddress)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package backend
 
 import (
 	"context"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -13,7 +14,51 @@ type Backend interface {
 	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
 	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
 	BlockTimestamp(ctx context.Context, number rpc.BlockNumber) (uint64, error)
+	// TransactionByHash returns a transaction with its block number and time.
+	// Pending transactions are returned along with a *PendingError.
 	TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, uint64, uint64, error)
 	TraceBlock(ctx context.Context, number rpc.BlockNumber) ([]*CallFrame, error)
+	// Mined transactions without traces in the database fail with a
+	// *NotIndexedError.
 	TraceTransaction(ctx context.Context, txHash common.Hash) ([]*CallFrame, error)
+	UpstreamTraceBlock(ctx context.Context, number rpc.BlockNumber) ([]*CallFrame, error)
+
+	// Upstream state and receipt access
+	CodeAt(ctx context.Context, address common.Address, number rpc.BlockNumber) ([]byte, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	BlockReceipts(ctx context.Context, number rpc.BlockNumber) ([]*types.Receipt, error)
+	BalanceAt(ctx context.Context, address common.Address, number rpc.BlockNumber) (*big.Int, error)
+	StorageAt(ctx context.Context, address common.Address, key common.Hash, number rpc.BlockNumber) ([]byte, error)
+	CallContract(ctx context.Context, to common.Address, data []byte, number rpc.BlockNumber) ([]byte, error)
+
+	// Address centric lookups on the traces table
+	ContractCreations(ctx context.Context, address common.Address) ([]*CallFrame, error)
+	SearchTransactions(ctx context.Context, address common.Address, fromBlock, toBlock uint64, descending bool, limit int) ([]*TransactionRef, error)
+	FilterTraces(ctx context.Context, filter *TraceFilter) ([]*CallFrame, *TraceCursor, error)
+
+	// Materialised balance checkpoints
+	BalanceIndexHead(ctx context.Context) (uint64, bool, error)
+	CheckpointBalances(ctx context.Context, addresses []common.Address, before uint64) (map[common.Address]*big.Int, error)
+	WriteBalanceCheckpoints(ctx context.Context, number uint64, deltas map[common.Address]*big.Int) error
+	SeedBalanceCheckpoints(ctx context.Context, number uint64, balances map[common.Address]*big.Int) error
+	BalanceCheckpoints(ctx context.Context, address common.Address, fromBlock, toBlock uint64) ([]*BalanceCheckpoint, error)
+
+	// Structural quality checks of the traces table
+	TraceStructure(ctx context.Context, fromBlock, toBlock uint64) ([]Trace, error)
+	QualityCheckHead(ctx context.Context) (uint64, bool, error)
+	WriteQualityIssues(ctx context.Context, fromBlock, toBlock uint64, issues []*QualityIssue, advance bool) error
+	QualityIssueCounts(ctx context.Context) (map[string]uint64, error)
+
+	// Bulk export and import of the traces table
+	ScanTraces(ctx context.Context, fromBlock, toBlock uint64, fn func(*Trace) error) error
+	ReplaceTraces(ctx context.Context, fromBlock, toBlock uint64, next func() ([]Trace, error)) error
+
+	// Token transfers
+	TokenTransfers(ctx context.Context, filter *TokenTransferFilter) ([]*TokenTransfer, *TokenCursor, error)
+
+	// ABI registry
+	ContractABI(ctx context.Context, address common.Address) (*ContractABI, error)
+	ContractABIs(ctx context.Context, offset, limit int) ([]*ContractABI, error)
+	PutContractABI(ctx context.Context, address common.Address, name, abi string) error
+	DeleteContractABI(ctx context.Context, address common.Address) (bool, error)
 }
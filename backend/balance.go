@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BalanceCheckpoint is the native balance of an address after a block which
+// changed it. Rows are only written for blocks touching the address, the
+// balance at any other block is the one of the closest checkpoint below.
+type BalanceCheckpoint struct {
+	Address  string          `json:"address" gorm:"column:address;primaryKey"`
+	BlockNum uint64          `json:"blknum" gorm:"column:blknum;primaryKey;autoIncrement:false"`
+	Delta    decimal.Decimal `json:"delta" gorm:"column:delta;type:numeric"`
+	Balance  decimal.Decimal `json:"balance" gorm:"column:balance;type:numeric"`
+}
+
+// Progress records up to which block a derived table has been built.
+type Progress struct {
+	Name     string `gorm:"column:name;primaryKey"`
+	BlockNum uint64 `gorm:"column:blknum"`
+}
+
+// balanceProgress is the progress name of the balance checkpoints table.
+const balanceProgress = "balance_checkpoints"
+
+func (b *mixinBackend) table(name string) string {
+	return fmt.Sprintf("%s.%s", b.chain, name)
+}
+
+// migrateBalances creates the tables maintained by the balance indexer.
+func (b *mixinBackend) migrateBalances(ctx context.Context) error {
+	if err := b.db.WithContext(ctx).Table(b.table("hdt_progress")).AutoMigrate(&Progress{}); err != nil {
+		return err
+	}
+	return b.db.WithContext(ctx).Table(b.table("balance_checkpoints")).AutoMigrate(&BalanceCheckpoint{})
+}
+
+func (b *mixinBackend) BalanceAt(ctx context.Context, address common.Address, number rpc.BlockNumber) (*big.Int, error) {
+	if b.ec == nil {
+		return nil, ErrOffline
+	}
+	var balance hexutil.Big
+	if err := b.ec.Client().CallContext(ctx, &balance, "eth_getBalance", address, number); err != nil {
+		return nil, upstreamError(err)
+	}
+	return balance.ToInt(), nil
+}
+
+func (b *mixinBackend) BalanceIndexHead(ctx context.Context) (uint64, bool, error) {
+	return b.progress(ctx, balanceProgress)
+}
+
+// latestBalances returns the last known balances of the addresses before the
+// given block.
+func latestBalances(db *gorm.DB, table string, addresses []string, before uint64) (map[string]decimal.Decimal, error) {
+	// Pick the last checkpoint of every address without DISTINCT ON, which
+	// SQLite lacks
+	var rows []BalanceCheckpoint
+	last := db.Table(table).
+		Select("address, MAX(blknum)").
+		Where("address IN ?", addresses).
+		Where("blknum < ?", before).
+		Group("address")
+	sql := db.Table(table).
+		Select("address, blknum, balance").
+		Where("(address, blknum) IN (?)", last)
+	err := sql.Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		balances[row.Address] = row.Balance
+	}
+	return balances, nil
+}
+
+func (b *mixinBackend) CheckpointBalances(ctx context.Context, addresses []common.Address, before uint64) (map[common.Address]*big.Int, error) {
+	keys := make([]string, len(addresses))
+	for i, addr := range addresses {
+		keys[i] = addressHex(addr)
+	}
+	rows, err := latestBalances(b.db.WithContext(ctx), b.table("balance_checkpoints"), keys, before)
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[common.Address]*big.Int, len(addresses))
+	for _, addr := range addresses {
+		balances[addr] = new(big.Int)
+		if v, ok := rows[addressHex(addr)]; ok {
+			balances[addr] = v.BigInt()
+		}
+	}
+	return balances, nil
+}
+
+func (b *mixinBackend) WriteBalanceCheckpoints(ctx context.Context, number uint64, deltas map[common.Address]*big.Int) error {
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		table := b.table("balance_checkpoints")
+		if len(deltas) > 0 {
+			addresses := make([]string, 0, len(deltas))
+			for addr := range deltas {
+				addresses = append(addresses, addressHex(addr))
+			}
+			prev, err := latestBalances(tx, table, addresses, number)
+			if err != nil {
+				return err
+			}
+			rows := make([]*BalanceCheckpoint, 0, len(deltas))
+			for addr, delta := range deltas {
+				key := addressHex(addr)
+				d := decimal.NewFromBigInt(delta, 0)
+				rows = append(rows, &BalanceCheckpoint{
+					Address:  key,
+					BlockNum: number,
+					Delta:    d,
+					Balance:  prev[key].Add(d),
+				})
+			}
+			err = tx.Table(table).
+				Clauses(clause.OnConflict{DoNothing: true}).
+				CreateInBatches(rows, 500).
+				Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Table(b.table("hdt_progress")).
+			Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&Progress{Name: balanceProgress, BlockNum: number}).
+			Error
+	})
+}
+
+// SeedBalanceCheckpoints writes the opening balances of accounts whose
+// history starts after the first indexed block. Seeds carry a zero delta, as
+// the block made no change to them, and leave the index head untouched.
+func (b *mixinBackend) SeedBalanceCheckpoints(ctx context.Context, number uint64, balances map[common.Address]*big.Int) error {
+	if len(balances) == 0 {
+		return nil
+	}
+	rows := make([]*BalanceCheckpoint, 0, len(balances))
+	for addr, balance := range balances {
+		rows = append(rows, &BalanceCheckpoint{
+			Address:  addressHex(addr),
+			BlockNum: number,
+			Delta:    decimal.Zero,
+			Balance:  decimal.NewFromBigInt(balance, 0),
+		})
+	}
+	return b.db.WithContext(ctx).Table(b.table("balance_checkpoints")).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(rows, 500).
+		Error
+}
+
+func (b *mixinBackend) BalanceCheckpoints(ctx context.Context, address common.Address, fromBlock, toBlock uint64) ([]*BalanceCheckpoint, error) {
+	var rows []*BalanceCheckpoint
+	err := b.db.WithContext(ctx).Table(b.table("balance_checkpoints")).
+		Where("address = ?", addressHex(address)).
+		Where("blknum BETWEEN ? AND ?", fromBlock, toBlock).
+		Order("blknum ASC").
+		Find(&rows).
+		Error
+	return rows, err
+}
@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// importBatch is the number of rows inserted per statement by ReplaceTraces.
+const importBatch = 1000
+
+func (b *mixinBackend) ScanTraces(ctx context.Context, fromBlock, toBlock uint64, fn func(*Trace) error) error {
+	l := b.layout
+	rows, err := b.traces(ctx).
+		Where(l.col("blknum")+" BETWEEN ? AND ?", fromBlock, toBlock).
+		Order(l.order(false, "blknum", "txpos", "trace_address")).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var trace Trace
+		if err := b.db.ScanRows(rows, &trace); err != nil {
+			return err
+		}
+		if err := fn(&trace); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// traceValues maps a row onto the columns of the table layout, the trace
+// address is written in its text form and converted by the database.
+func (l *traceLayout) traceValues(t *Trace) map[string]interface{} {
+	values := map[string]interface{}{
+		"blknum":          t.BlockNum,
+		"txhash":          t.TransactionHash,
+		"txpos":           t.TransactionPos,
+		"from_address":    t.FromAddress,
+		"to_address":      t.ToAddress,
+		"value":           t.Value,
+		"input":           t.Input,
+		"output":          t.Output,
+		"trace_type":      t.TraceType,
+		"call_type":       t.CallType,
+		"reward_type":     t.RewardType,
+		"gas":             t.Gas,
+		"gas_used":        t.GasUsed,
+		"subtraces":       t.SubTraces,
+		"trace_address":   t.TraceAddress,
+		"error":           t.Error,
+		"block_timestamp": t.Timestamp,
+	}
+	if l.address == TraceAddressArray {
+		address, _ := ParseTraceAddress(t.TraceAddress)
+		values["trace_address"] = arrayLiteral(address)
+	}
+	mapped := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		if column := l.col(name); column != "" {
+			mapped[column] = value
+		}
+	}
+	return mapped
+}
+
+func (b *mixinBackend) ReplaceTraces(ctx context.Context, fromBlock, toBlock uint64, next func() ([]Trace, error)) error {
+	l := b.layout
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(l.table).
+			Where(l.col("blknum")+" BETWEEN ? AND ?", fromBlock, toBlock).
+			Delete(&Trace{}).
+			Error
+		if err != nil {
+			return err
+		}
+		for {
+			rows, err := next()
+			if err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			values := make([]map[string]interface{}, len(rows))
+			for i := range rows {
+				if rows[i].BlockNum < fromBlock || rows[i].BlockNum > toBlock {
+					return fmt.Errorf("row of block %d outside %d-%d", rows[i].BlockNum, fromBlock, toBlock)
+				}
+				values[i] = l.traceValues(&rows[i])
+			}
+			if err := tx.Table(l.table).CreateInBatches(values, importBatch).Error; err != nil {
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package backend
+
+import (
+	"gorm.io/gorm/logger"
+)
+
+// Config contains the settings used to create a backend.
+type Config struct {
+	Chain    string           // Chain name, also the schema holding the chain tables
+	Upstream string           // Upstream JSON-RPC endpoint, unused if offline
+	DBDSN    string           // PostgreSQL connection DSN, or a SQLite database after SQLitePrefix
+	DBLogger logger.Interface // SQL statement logger, discards everything but errors if nil
+
+	TokenSource string       // Source of the token transfers, TokenSourceTable (default) or TokenSourceLogs
+	TraceSchema *TraceSchema // Layout of the traces table, DefaultTraceSchema if nil
+
+	// Offline reads headers, blocks and transactions from the <chain>.blocks
+	// and <chain>.transactions tables instead of the upstream node. Methods
+	// needing the node, such as state and receipt access, fail with ErrOffline.
+	Offline bool
+}
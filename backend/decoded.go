@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Sources of a decoded call, from the most to the least reliable.
+const (
+	DecodedFromABI       = "abi"      // ABI of the callee from the registry
+	DecodedFromSignature = "4byte"    // Text signature matching the selector
+	DecodedFromSelector  = "selector" // Only the selector, the function is unknown
+)
+
+// DecodedCall is the ABI decoding of the input and output of a frame.
+type DecodedCall struct {
+	Selector  hexutil.Bytes  `json:"selector"`
+	Signature string         `json:"signature,omitempty"`
+	Source    string         `json:"source"`
+	Inputs    []DecodedValue `json:"inputs,omitempty"`
+	Outputs   []DecodedValue `json:"outputs,omitempty"`
+	Error     string         `json:"error,omitempty"` // Why the arguments could not be decoded
+	Proxy     *ProxyInfo     `json:"proxy,omitempty"`
+}
+
+// Proxy standards recognised by the decoder.
+const (
+	ProxyEIP1967       = "eip1967"        // Transparent or UUPS proxy, implementation slot
+	ProxyEIP1967Beacon = "eip1967-beacon" // Beacon proxy
+	ProxyEIP1822       = "eip1822"        // Universal upgradeable proxy, PROXIABLE slot
+	ProxySafe          = "safe"           // Gnosis Safe proxy, singleton in slot 0
+	ProxyDelegate      = "delegate"       // Forwards its calldata, standard unknown
+)
+
+// ProxyInfo describes the proxy a call went through, the call is decoded
+// against the ABI of the implementation.
+type ProxyInfo struct {
+	Type           string         `json:"type"`
+	Implementation common.Address `json:"implementation"`
+}
+
+// DecodedValue is a single decoded argument or return value. Integers are
+// rendered as decimal strings, bytes as hex and tuples as objects.
+type DecodedValue struct {
+	Name  string      `json:"name,omitempty"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
@@ -0,0 +1,199 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// JSON-RPC error codes of the backend errors. The first ones follow EIP-1474,
+// the others are specific to hdt.
+const (
+	CodeNotFound            = -32001 // EIP-1474 resource not found
+	CodePending             = -32002 // EIP-1474 resource unavailable
+	CodeRangeTooLarge       = -32005 // EIP-1474 limit exceeded
+	CodeNotIndexed          = -32010
+	CodeUpstreamUnavailable = -32011
+	CodeDBTimeout           = -32012
+)
+
+// pgQueryCanceled is the SQLSTATE of statements cancelled by the
+// statement_timeout of Postgres.
+const pgQueryCanceled = "57014"
+
+// NotFoundError is returned for blocks, transactions and other objects
+// neither the database nor the upstream know.
+type NotFoundError struct {
+	What string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.What == "" {
+		return "not found"
+	}
+	return e.What + " not found"
+}
+
+// ErrorCode is the JSON-RPC code of the error.
+func (e *NotFoundError) ErrorCode() int { return CodeNotFound }
+
+// ErrorData names what wasn't found.
+func (e *NotFoundError) ErrorData() interface{} { return e.What }
+
+// PendingError is returned for transactions the upstream knows but which
+// aren't mined yet, along with the transaction itself.
+type PendingError struct {
+	Hash common.Hash
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("transaction %s not yet mined", e.Hash.Hex())
+}
+
+// ErrorCode is the JSON-RPC code of the error.
+func (e *PendingError) ErrorCode() int { return CodePending }
+
+// ErrorData carries the transaction hash, so clients can retry it.
+func (e *PendingError) ErrorData() interface{} { return e.Hash }
+
+// NotIndexedError is returned for blocks mined by the upstream whose traces
+// aren't in the database yet.
+type NotIndexedError struct {
+	Block uint64
+}
+
+func (e *NotIndexedError) Error() string {
+	return fmt.Sprintf("block %d not indexed yet", e.Block)
+}
+
+// ErrorCode is the JSON-RPC code of the error.
+func (e *NotIndexedError) ErrorCode() int { return CodeNotIndexed }
+
+// ErrorData carries the block number, so clients can retry later.
+func (e *NotIndexedError) ErrorData() interface{} { return e.Block }
+
+// RangeTooLargeError is returned for requests spanning more than a method
+// allows, in blocks or in points.
+type RangeTooLargeError struct {
+	Size uint64
+	Max  uint64
+	What string
+}
+
+func (e *RangeTooLargeError) Error() string {
+	return fmt.Sprintf("range of %d %s exceeds the limit of %d", e.Size, e.What, e.Max)
+}
+
+// ErrorCode is the JSON-RPC code of the error.
+func (e *RangeTooLargeError) ErrorCode() int { return CodeRangeTooLarge }
+
+// ErrorData carries the limit, so clients can split the request.
+func (e *RangeTooLargeError) ErrorData() interface{} {
+	return map[string]interface{}{"size": e.Size, "max": e.Max}
+}
+
+// UpstreamError is returned when the upstream node can't be reached or fails
+// to answer, as opposed to the JSON-RPC errors it answers with.
+type UpstreamError struct {
+	Err error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("upstream unavailable: %v", e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error { return e.Err }
+
+// ErrorCode is the JSON-RPC code of the error.
+func (e *UpstreamError) ErrorCode() int { return CodeUpstreamUnavailable }
+
+// ErrorData is empty, the cause is in the message.
+func (e *UpstreamError) ErrorData() interface{} { return nil }
+
+// DBTimeoutError is returned for database queries running out of time.
+type DBTimeoutError struct {
+	Err error
+}
+
+func (e *DBTimeoutError) Error() string {
+	return fmt.Sprintf("database timeout: %v", e.Err)
+}
+
+func (e *DBTimeoutError) Unwrap() error { return e.Err }
+
+// ErrorCode is the JSON-RPC code of the error.
+func (e *DBTimeoutError) ErrorCode() int { return CodeDBTimeout }
+
+// ErrorData is empty, the cause is in the message.
+func (e *DBTimeoutError) ErrorData() interface{} { return nil }
+
+// upstreamError tags the failures of an upstream call, leaving the JSON-RPC
+// errors of the node and not found untouched.
+func upstreamError(err error) error {
+	if err == nil || errors.Is(err, ethereum.NotFound) {
+		return err
+	}
+	if _, ok := err.(rpc.Error); ok {
+		return err
+	}
+	return &UpstreamError{Err: err}
+}
+
+// registerDBTimeouts tags the statements running out of time as
+// DBTimeoutError where they fail, so that the deadlines of upstream calls
+// and other work aren't mistaken for database timeouts.
+func registerDBTimeouts(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Query().After("gorm:query").Register("hdt:timeout", tagDBTimeout),
+		cb.Row().After("gorm:row").Register("hdt:timeout", tagDBTimeout),
+		cb.Raw().After("gorm:raw").Register("hdt:timeout", tagDBTimeout),
+		cb.Create().After("gorm:create").Register("hdt:timeout", tagDBTimeout),
+		cb.Update().After("gorm:update").Register("hdt:timeout", tagDBTimeout),
+		cb.Delete().After("gorm:delete").Register("hdt:timeout", tagDBTimeout),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tagDBTimeout(db *gorm.DB) {
+	var pgErr *pgconn.PgError
+	switch {
+	case db.Error == nil, errors.As(db.Error, new(*DBTimeoutError)):
+	case errors.Is(db.Error, context.DeadlineExceeded),
+		errors.As(db.Error, &pgErr) && pgErr.Code == pgQueryCanceled:
+		db.Error = &DBTimeoutError{Err: db.Error}
+	}
+}
+
+// RPCError converts a backend error into one carrying a JSON-RPC code, so
+// that the API methods fail the same way across namespaces. The result is
+// returned as is: the RPC server only looks at the error itself for a code,
+// never through wrapping.
+func RPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if rpcErr := rpc.Error(nil); errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, ethereum.NotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return &NotFoundError{}
+	case errors.Is(err, ErrOffline):
+		return &UpstreamError{Err: err}
+	case errors.As(err, &pgErr) && pgErr.Code == pgQueryCanceled:
+		return &DBTimeoutError{Err: err}
+	}
+	return err
+}
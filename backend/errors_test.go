@@ -0,0 +1,86 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+type nodeError struct{}
+
+func (nodeError) Error() string  { return "execution reverted" }
+func (nodeError) ErrorCode() int { return 3 }
+
+func TestRPCError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{ethereum.NotFound, CodeNotFound},
+		{fmt.Errorf("block 1: %w", gorm.ErrRecordNotFound), CodeNotFound},
+		{&PendingError{}, CodePending},
+		{fmt.Errorf("wrapped: %w", &NotIndexedError{Block: 1}), CodeNotIndexed},
+		{ErrOffline, CodeUpstreamUnavailable},
+		{upstreamError(context.DeadlineExceeded), CodeUpstreamUnavailable},
+		{fmt.Errorf("query: %w", &DBTimeoutError{Err: context.DeadlineExceeded}), CodeDBTimeout},
+		{&pgconn.PgError{Code: pgQueryCanceled}, CodeDBTimeout},
+		{upstreamError(nodeError{}), 3},
+	}
+	for i, tt := range tests {
+		err, ok := RPCError(tt.err).(rpc.Error)
+		if !ok {
+			t.Errorf("test %d: %v without a JSON-RPC code", i, tt.err)
+			continue
+		}
+		if err.ErrorCode() != tt.code {
+			t.Errorf("test %d: %v: have code %d, want %d", i, tt.err, err.ErrorCode(), tt.code)
+		}
+	}
+
+	if err := RPCError(nil); err != nil {
+		t.Errorf("nil error converted to %v", err)
+	}
+	plain := errors.New("invalid input")
+	if err := RPCError(plain); err != plain {
+		t.Errorf("plain error converted to %v", err)
+	}
+	// Deadlines outside of the database keep their own error
+	if err := RPCError(context.DeadlineExceeded); err != context.DeadlineExceeded {
+		t.Errorf("deadline converted to %v", err)
+	}
+	if err := upstreamError(ethereum.NotFound); err != ethereum.NotFound {
+		t.Errorf("not found tagged as %v", err)
+	}
+}
+
+func TestDBTimeout(t *testing.T) {
+	db, err := gorm.Open(dialector(SQLitePrefix+":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerDBTimeouts(db); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+
+	var n int
+	err = db.WithContext(ctx).Raw("SELECT 1").Scan(&n).Error
+	if code := RPCError(err).(rpc.Error).ErrorCode(); code != CodeDBTimeout {
+		t.Errorf("query: have code %d, want %d", code, CodeDBTimeout)
+	}
+	err = db.WithContext(ctx).Exec("SELECT 1").Error
+	if code := RPCError(err).(rpc.Error).ErrorCode(); code != CodeDBTimeout {
+		t.Errorf("statement: have code %d, want %d", code, CodeDBTimeout)
+	}
+	if err := db.Raw("SELECT 1").Scan(&n).Error; err != nil {
+		t.Errorf("query in time: %v", err)
+	}
+}
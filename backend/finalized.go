@@ -0,0 +1,27 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// FinalizedNumber returns the highest block number which can be considered
+// final. If confirmations is zero, the upstream finalized tag is used,
+// otherwise blocks that deep below the head are treated as final, for
+// chains lacking the tag.
+func FinalizedNumber(ctx context.Context, b Backend, confirmations uint64) (uint64, error) {
+	tag := rpc.FinalizedBlockNumber
+	if confirmations > 0 {
+		tag = rpc.LatestBlockNumber
+	}
+	header, err := b.HeaderByNumber(ctx, tag)
+	if err != nil {
+		return 0, err
+	}
+	number := header.Number.Uint64()
+	if number < confirmations {
+		return 0, nil
+	}
+	return number - confirmations, nil
+}
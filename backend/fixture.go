@@ -0,0 +1,303 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	"gorm.io/gorm"
+)
+
+// Fixture is a handful of blocks with their transactions and traces, checked
+// in to serve the --dev mode and the integration tests without a node or a
+// populated database.
+type Fixture struct {
+	Chain  string          `json:"chain"`
+	Blocks []*FixtureBlock `json:"blocks"`
+}
+
+// FixtureBlock is a block as returned by eth_getBlockByNumber with full
+// transactions, plus its trace_block frames under "traces".
+type FixtureBlock struct {
+	Header       *types.Header
+	Transactions []*types.Transaction
+	Withdrawals  []*types.Withdrawal
+	Traces       []*CallFrame
+}
+
+type fixtureBody struct {
+	Transactions []*types.Transaction `json:"transactions"`
+	Withdrawals  []*types.Withdrawal  `json:"withdrawals,omitempty"`
+	Traces       []*CallFrame         `json:"traces"`
+}
+
+// MarshalJSON marshals the header fields and the body into one object.
+func (b *FixtureBlock) MarshalJSON() ([]byte, error) {
+	var fields map[string]json.RawMessage
+	for _, part := range []interface{}{b.Header, &fixtureBody{b.Transactions, b.Withdrawals, b.Traces}} {
+		blob, err := json.Marshal(part)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(blob, &fields); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON unmarshals from JSON.
+func (b *FixtureBlock) UnmarshalJSON(input []byte) error {
+	var body fixtureBody
+	if err := json.Unmarshal(input, &body); err != nil {
+		return err
+	}
+	header := new(types.Header)
+	if err := json.Unmarshal(input, header); err != nil {
+		return err
+	}
+	b.Header, b.Transactions, b.Withdrawals, b.Traces = header, body.Transactions, body.Withdrawals, body.Traces
+	return nil
+}
+
+// ReadFixture decodes a JSON fixture.
+func ReadFixture(r io.Reader) (*Fixture, error) {
+	var f Fixture
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid fixture: %v", err)
+	}
+	return &f, nil
+}
+
+// newBlock converts the header into a row of the blocks table.
+func newBlock(header *types.Header) *Block {
+	row := &Block{
+		Timestamp:    time.Unix(int64(header.Time), 0),
+		BlockNum:     header.Number.Uint64(),
+		BlockHash:    header.Hash().Hex(),
+		ParentHash:   header.ParentHash.Hex(),
+		Nonce:        hexutil.Encode(header.Nonce[:]),
+		Sha3Uncles:   header.UncleHash.Hex(),
+		LogsBloom:    hexutil.Encode(header.Bloom.Bytes()),
+		TxsRoot:      header.TxHash.Hex(),
+		StateRoot:    header.Root.Hex(),
+		ReceiptsRoot: header.ReceiptHash.Hex(),
+		Miner:        addressHex(header.Coinbase),
+		MixHash:      header.MixDigest.Hex(),
+		Difficulty:   *bigDecimal(header.Difficulty),
+		ExtraData:    hexutil.Encode(header.Extra),
+		GasLimit:     header.GasLimit,
+		GasUsed:      header.GasUsed,
+	}
+	if header.BaseFee != nil {
+		row.BaseFeePerGas = bigDecimal(header.BaseFee)
+	}
+	if header.WithdrawalsHash != nil {
+		root := header.WithdrawalsHash.Hex()
+		row.WithdrawalsRoot = &root
+	}
+	row.BlobGasUsed, row.ExcessBlobGas = header.BlobGasUsed, header.ExcessBlobGas
+	if header.ParentBeaconRoot != nil {
+		root := header.ParentBeaconRoot.Hex()
+		row.BeaconRoot = &root
+	}
+	return row
+}
+
+// newTransaction converts the transaction into a row of the transactions table.
+func newTransaction(tx *types.Transaction, number, position uint64) (*Transaction, error) {
+	v, r, s := tx.RawSignatureValues()
+	row := &Transaction{
+		BlockNum:        number,
+		TransactionHash: tx.Hash().Hex(),
+		TransactionPos:  position,
+		TxType:          tx.Type(),
+		Nonce:           tx.Nonce(),
+		Value:           *bigDecimal(tx.Value()),
+		Gas:             tx.Gas(),
+		Input:           hexutil.Encode(tx.Data()),
+		V:               *bigDecimal(v),
+		R:               *bigDecimal(r),
+		S:               *bigDecimal(s),
+	}
+	if to := tx.To(); to != nil {
+		addr := addressHex(*to)
+		row.ToAddress = &addr
+	}
+	switch tx.Type() {
+	case types.LegacyTxType, types.AccessListTxType:
+		row.GasPrice = bigDecimal(tx.GasPrice())
+	case types.DynamicFeeTxType:
+		row.MaxFeePerGas = bigDecimal(tx.GasFeeCap())
+		row.MaxPriorityFeePerGas = bigDecimal(tx.GasTipCap())
+	case types.BlobTxType:
+		row.MaxFeePerGas = bigDecimal(tx.GasFeeCap())
+		row.MaxPriorityFeePerGas = bigDecimal(tx.GasTipCap())
+		row.MaxFeePerBlobGas = bigDecimal(tx.BlobGasFeeCap())
+		blob, err := json.Marshal(tx.BlobHashes())
+		if err != nil {
+			return nil, err
+		}
+		hashes := string(blob)
+		row.BlobHashes = &hashes
+	default:
+		return nil, fmt.Errorf("transaction %s: unsupported type %d", tx.Hash().Hex(), tx.Type())
+	}
+	if tx.Type() != types.LegacyTxType {
+		row.ChainID = bigDecimal(tx.ChainId())
+		blob, err := json.Marshal(tx.AccessList())
+		if err != nil {
+			return nil, err
+		}
+		list := string(blob)
+		row.AccessList = &list
+	}
+	return row, nil
+}
+
+// newWithdrawal converts the withdrawal into a row of the withdrawals table.
+func newWithdrawal(w *types.Withdrawal, number uint64) *Withdrawal {
+	return &Withdrawal{
+		BlockNum:       number,
+		Index:          w.Index,
+		ValidatorIndex: w.Validator,
+		Address:        addressHex(w.Address),
+		Amount:         w.Amount,
+	}
+}
+
+// fixtureRows converts a fixture block into table rows, checking the rows
+// read back into the same header, transactions and withdrawals.
+func fixtureRows(block *FixtureBlock) (*Block, []*Transaction, []*Withdrawal, []*Trace, error) {
+	var (
+		header = block.Header
+		number = header.Number.Uint64()
+		row    = newBlock(header)
+	)
+	if _, err := row.Header(); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	txs := make([]*Transaction, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		var err error
+		if txs[i], err = newTransaction(tx, number, uint64(i)); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if _, err := txs[i].Tx(); err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+	if header.WithdrawalsHash != nil {
+		if hash := types.DeriveSha(types.Withdrawals(block.Withdrawals), trie.NewStackTrie(nil)); hash != *header.WithdrawalsHash {
+			return nil, nil, nil, nil, fmt.Errorf("withdrawals of block %d hash to %s instead of %s", number, hash.Hex(), header.WithdrawalsHash.Hex())
+		}
+	}
+	withdrawals := make([]*Withdrawal, len(block.Withdrawals))
+	for i, w := range block.Withdrawals {
+		withdrawals[i] = newWithdrawal(w, number)
+	}
+	traces := make([]*Trace, len(block.Traces))
+	for i, frame := range block.Traces {
+		if frame.BlockNumber != number {
+			return nil, nil, nil, nil, fmt.Errorf("trace of block %d in block %d", frame.BlockNumber, number)
+		}
+		traces[i] = frame.AsTrace(row.Timestamp)
+	}
+	return row, txs, withdrawals, traces, nil
+}
+
+// LoadFixture writes the blocks of the fixture into the chain tables,
+// replacing the rows of blocks already present.
+func (b *mixinBackend) LoadFixture(ctx context.Context, f *Fixture) error {
+	if f.Chain != "" && f.Chain != b.chain {
+		return fmt.Errorf("fixture of chain %s, loading into %s", f.Chain, b.chain)
+	}
+	l := b.layout
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, block := range f.Blocks {
+			row, txs, withdrawals, traces, err := fixtureRows(block)
+			if err != nil {
+				return err
+			}
+			number := row.BlockNum
+			if err := tx.Table(b.table("blocks")).Where("blknum = ?", number).Delete(&Block{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Table(b.table("transactions")).Where("blknum = ?", number).Delete(&Transaction{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Table(b.table("withdrawals")).Where("blknum = ?", number).Delete(&Withdrawal{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Table(l.table).Where(l.col("blknum")+" = ?", number).Delete(&Trace{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Table(b.table("blocks")).Create(row).Error; err != nil {
+				return err
+			}
+			if len(txs) > 0 {
+				if err := tx.Table(b.table("transactions")).Create(txs).Error; err != nil {
+					return err
+				}
+			}
+			if len(withdrawals) > 0 {
+				if err := tx.Table(b.table("withdrawals")).Create(withdrawals).Error; err != nil {
+					return err
+				}
+			}
+			if len(traces) > 0 {
+				values := make([]map[string]interface{}, len(traces))
+				for i, trace := range traces {
+					values[i] = l.traceValues(trace)
+				}
+				if err := tx.Table(l.table).CreateInBatches(values, importBatch).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// NewDevBackend creates an offline backend on SQLite, in memory unless the
+// configuration names a SQLite database, with the fixtures loaded.
+func NewDevBackend(ctx context.Context, cfg *Config, fixtures ...*Fixture) (*mixinBackend, error) {
+	dev := *cfg
+	dev.Offline = true
+	if !strings.HasPrefix(dev.DBDSN, SQLitePrefix) {
+		dev.DBDSN = SQLitePrefix + ":memory:"
+	}
+	b, err := NewMixinBackend(ctx, &dev)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Migrate(ctx, false); err != nil {
+		return nil, err
+	}
+	for _, f := range fixtures {
+		if err := b.LoadFixture(ctx, f); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// FixtureBlock captures a block from the backend as a fixture block.
+func (b *mixinBackend) FixtureBlock(ctx context.Context, number uint64) (*FixtureBlock, error) {
+	block, err := b.BlockByNumber(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		return nil, err
+	}
+	traces, err := b.TraceBlock(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		return nil, err
+	}
+	return &FixtureBlock{Header: block.Header(), Transactions: block.Transactions(), Withdrawals: block.Withdrawals(), Traces: traces}, nil
+}
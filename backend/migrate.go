@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"context"
+	"embed"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// offlineMigrations extend the blocks and transactions tables read by the
+// offline mode, they only run where the ETL created those tables.
+//
+//go:embed migrations/offline/*.sql
+var offlineMigrations embed.FS
+
+// Migrate applies the bundled schema migrations (mostly index
+// recommendations) to the chain tables. All statements are idempotent.
+//
+// Building an index concurrently doesn't block writers, but isn't supported
+// on partitioned tables, hence it's optional. SQLite databases get the whole
+// schema instead, chain tables included.
+func (b *mixinBackend) Migrate(ctx context.Context, concurrently bool) error {
+	if isSQLite(b.db) {
+		return b.migrateSQLite(ctx)
+	}
+	replacer := b.migrationReplacer(concurrently)
+	if err := b.applyMigrations(ctx, migrations, "migrations", replacer); err != nil {
+		return err
+	}
+	offline, err := b.hasTables(ctx, "blocks", "transactions")
+	if err != nil {
+		return err
+	}
+	if offline {
+		if err := b.applyMigrations(ctx, offlineMigrations, "migrations/offline", replacer); err != nil {
+			return err
+		}
+	} else {
+		log.Info("Skipping offline migrations, no blocks and transactions tables", "chain", b.chain)
+	}
+	if err := b.migrateBalances(ctx); err != nil {
+		return err
+	}
+	return b.migrateABIs(ctx)
+}
+
+// applyMigrations runs the migrations of the directory in name order.
+func (b *mixinBackend) applyMigrations(ctx context.Context, fsys embed.FS, dir string, replacer *strings.Replacer) error {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		blob, err := fsys.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		// Concurrent index builds can't run inside a transaction block, so
+		// execute the statements one by one.
+		for _, stmt := range strings.Split(string(blob), ";") {
+			if isComment(stmt) {
+				continue
+			}
+			log.Info("Applying migration", "file", name, "sql", strings.TrimSpace(replacer.Replace(stmt)))
+			if err := b.db.WithContext(ctx).Exec(replacer.Replace(stmt)).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasTables reports whether all the chain tables exist.
+func (b *mixinBackend) hasTables(ctx context.Context, names ...string) (bool, error) {
+	for _, name := range names {
+		var exists bool
+		if err := b.db.WithContext(ctx).Raw("SELECT to_regclass(?) IS NOT NULL", b.table(name)).Scan(&exists).Error; err != nil {
+			return false, err
+		}
+		if !exists {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// migrationReplacer fills in the placeholders of the migrations: the chain,
+// the concurrently keyword and the layout of the traces table.
+func (b *mixinBackend) migrationReplacer(concurrently bool) *strings.Replacer {
+	keyword := ""
+	if concurrently {
+		keyword = "CONCURRENTLY"
+	}
+	pairs := append([]string{"{{chain}}", b.chain, "{{concurrently}}", keyword}, b.layout.placeholders()...)
+	return strings.NewReplacer(pairs...)
+}
+
+// isComment reports whether the statement consists of comments and spaces only.
+func isComment(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,13 @@
+-- Indexes backing the address centric lookups on the traces table:
+-- hdt_getAddressTraces, ots_searchTransactions*, ots_getContractCreator and
+-- the Etherscan txlist/txlistinternal/getcontractcreation endpoints.
+--
+-- Both indexes end with the (blknum, txpos, trace_address) iteration order,
+-- the trace address as its sort key, so cursor pagination becomes a range
+-- scan instead of a sort. The table and columns follow the --traces.schema
+-- layout, jsonb trace addresses are left out as their key isn't indexable.
+CREATE INDEX {{concurrently}} IF NOT EXISTS {{traces.name}}_from_address_idx
+    ON {{traces}} ({{traces.from_address}}, {{traces.blknum}}, {{traces.txpos}}{{traces.trace_address_key}});
+
+CREATE INDEX {{concurrently}} IF NOT EXISTS {{traces.name}}_to_address_idx
+    ON {{traces}} ({{traces.to_address}}, {{traces.blknum}}, {{traces.txpos}}{{traces.trace_address_key}});
@@ -0,0 +1,31 @@
+-- Token transfers served by hdt_getTokenTransfers, one row per transferred
+-- token id (ERC-1155 batches are flattened). The table is expected to be
+-- filled by the ETL, it's only created here so the schema is documented.
+CREATE TABLE IF NOT EXISTS {{chain}}.token_transfers (
+    blknum          BIGINT NOT NULL,
+    txhash          TEXT NOT NULL,
+    txpos           BIGINT NOT NULL,
+    logpos          BIGINT NOT NULL,
+    token_address   TEXT NOT NULL,
+    token_type      TEXT NOT NULL, -- erc20, erc721 or erc1155
+    from_address    TEXT NOT NULL,
+    to_address      TEXT NOT NULL,
+    value           NUMERIC NOT NULL,
+    token_id        NUMERIC,
+    block_timestamp TIMESTAMP
+);
+
+CREATE INDEX {{concurrently}} IF NOT EXISTS token_transfers_blknum_idx
+    ON {{chain}}.token_transfers (blknum, logpos);
+
+CREATE INDEX {{concurrently}} IF NOT EXISTS token_transfers_txhash_idx
+    ON {{chain}}.token_transfers (txhash);
+
+CREATE INDEX {{concurrently}} IF NOT EXISTS token_transfers_token_address_idx
+    ON {{chain}}.token_transfers (token_address, blknum, logpos);
+
+CREATE INDEX {{concurrently}} IF NOT EXISTS token_transfers_from_address_idx
+    ON {{chain}}.token_transfers (from_address, blknum, logpos);
+
+CREATE INDEX {{concurrently}} IF NOT EXISTS token_transfers_to_address_idx
+    ON {{chain}}.token_transfers (to_address, blknum, logpos);
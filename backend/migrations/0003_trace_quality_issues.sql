@@ -0,0 +1,18 @@
+-- Report table of the trace quality checker (--quality.check), one row per
+-- violated invariant. Rows of a block range are replaced when it's checked
+-- again.
+CREATE TABLE IF NOT EXISTS {{chain}}.trace_quality_issues (
+    id            BIGSERIAL PRIMARY KEY,
+    blknum        BIGINT NOT NULL,
+    rule          TEXT NOT NULL, -- subtraces, orphan, duplicate, trace_address, txpos or timestamp
+    txhash        TEXT,
+    trace_address TEXT,
+    detail        TEXT NOT NULL,
+    checked_at    TIMESTAMP
+);
+
+CREATE INDEX {{concurrently}} IF NOT EXISTS trace_quality_issues_blknum_idx
+    ON {{chain}}.trace_quality_issues (blknum);
+
+CREATE INDEX {{concurrently}} IF NOT EXISTS trace_quality_issues_rule_idx
+    ON {{chain}}.trace_quality_issues (rule);
@@ -0,0 +1,26 @@
+-- Cancun (EIP-4844 and EIP-4788) columns the offline mode needs to rebuild
+-- blocks and blob transactions, null before the fork. The blocks and
+-- transactions tables are created by the ETL, Migrate skips this file on
+-- databases without them.
+ALTER TABLE {{chain}}.blocks ADD COLUMN IF NOT EXISTS blob_gas_used BIGINT;
+
+ALTER TABLE {{chain}}.blocks ADD COLUMN IF NOT EXISTS excess_blob_gas BIGINT;
+
+ALTER TABLE {{chain}}.blocks ADD COLUMN IF NOT EXISTS parent_beacon_block_root TEXT;
+
+ALTER TABLE {{chain}}.transactions ADD COLUMN IF NOT EXISTS max_fee_per_blob_gas NUMERIC;
+
+ALTER TABLE {{chain}}.transactions ADD COLUMN IF NOT EXISTS blob_versioned_hashes TEXT; -- JSON encoded
+
+-- Beacon chain withdrawals of the blocks since Shanghai, expected to be
+-- filled by the ETL along with the blocks.
+CREATE TABLE IF NOT EXISTS {{chain}}.withdrawals (
+    blknum           BIGINT NOT NULL,
+    withdrawal_index BIGINT NOT NULL,
+    validator_index  BIGINT NOT NULL,
+    address          TEXT NOT NULL,
+    amount           BIGINT NOT NULL -- gwei
+);
+
+CREATE INDEX {{concurrently}} IF NOT EXISTS withdrawals_blknum_idx
+    ON {{chain}}.withdrawals (blknum, withdrawal_index);
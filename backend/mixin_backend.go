@@ -4,9 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	glog "log"
 	"math/big"
-	"os"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
@@ -17,71 +15,111 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+
+	"github.com/jsvisa/hdt/pkg/logging"
 )
 
 type mixinBackend struct {
-	chain string
-	ec    *ethclient.Client
-	db    *gorm.DB
-	bc    *lru.Cache[int64, *types.Header]
+	chain       string
+	tokenSource string
+	layout      *traceLayout
+	ec          *ethclient.Client
+	db          *gorm.DB
+	bc          *lru.Cache[int64, *types.Header]
 }
 
 const (
 	blockCacheLimit = 90000
 )
 
-var (
-	gormLogger = logger.New(
-		glog.New(os.Stdout, "\r\n", glog.LstdFlags), // io writer
-		logger.Config{
-			SlowThreshold:             100 * time.Millisecond, // Slow SQL threshold
-			LogLevel:                  logger.Info,            // Log level
-			IgnoreRecordNotFoundError: true,                   // Ignore ErrRecordNotFound error for logger
-			ParameterizedQueries:      false,                  // Don't include params in the SQL log
-			Colorful:                  true,                   // Disable color
-		},
-	)
-)
+func NewMixinBackend(ctx context.Context, cfg *Config) (*mixinBackend, error) {
+	// Offline backends read the chain from the database only
+	var ec *ethclient.Client
+	if !cfg.Offline {
+		var err error
+		if ec, err = ethclient.DialContext(ctx, cfg.Upstream); err != nil {
+			return nil, err
+		}
+	}
 
-func NewMixinBackend(ctx context.Context, chain string, rawurl string, dbdsn string) (*mixinBackend, error) {
-	ec, err := ethclient.DialContext(ctx, rawurl)
+	dbLogger := cfg.DBLogger
+	if dbLogger == nil {
+		dbLogger = logging.NewGormLogger(logger.Error, 0)
+	}
+	db, err := gorm.Open(dialector(cfg.DBDSN), &gorm.Config{TranslateError: true, Logger: dbLogger})
 	if err != nil {
 		return nil, err
 	}
+	if err := registerDBTimeouts(db); err != nil {
+		return nil, err
+	}
+	if isSQLite(db) {
+		if err := attachSQLite(db, cfg.DBDSN, cfg.Chain); err != nil {
+			return nil, err
+		}
+	}
 
-	dialect := postgres.New(postgres.Config{DSN: dbdsn, PreferSimpleProtocol: true})
-	db, err := gorm.Open(dialect, &gorm.Config{TranslateError: true, Logger: gormLogger})
+	switch cfg.TokenSource {
+	case "", TokenSourceTable, TokenSourceLogs:
+	default:
+		return nil, fmt.Errorf("unknown token transfer source %q", cfg.TokenSource)
+	}
+	layout, err := newTraceLayout(cfg.TraceSchema, cfg.Chain)
 	if err != nil {
 		return nil, err
 	}
-
+	if isSQLite(db) && layout.address != TraceAddressString {
+		return nil, fmt.Errorf("trace address encoding %q not supported by SQLite", layout.address)
+	}
+	layout.sqlite = isSQLite(db)
 	b := &mixinBackend{
-		chain: chain,
-		ec:    ec,
-		db:    db,
-		bc:    lru.NewCache[int64, *types.Header](blockCacheLimit),
+		chain:       cfg.Chain,
+		tokenSource: cfg.TokenSource,
+		layout:      layout,
+		ec:          ec,
+		db:          db,
+		bc:          lru.NewCache[int64, *types.Header](blockCacheLimit),
 	}
 	return b, nil
 }
 
 func (b *mixinBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
-	blknum := big.NewInt(number.Int64())
 	if cached, ok := b.bc.Get(number.Int64()); ok {
 		return cached, nil
 	}
-	block, err := b.ec.BlockByNumber(ctx, blknum)
+	var (
+		block *types.Block
+		err   error
+	)
+	if b.ec == nil {
+		block, err = b.offlineBlock(ctx, number, false)
+	} else {
+		block, err = b.BlockByNumber(ctx, number)
+	}
 	if err != nil {
 		return nil, err
 	}
-	b.bc.Add(number.Int64(), block.Header())
+	// Block tags (latest, finalized, ...) resolve to different blocks over time
+	if number >= 0 {
+		b.bc.Add(number.Int64(), block.Header())
+	}
 	return block.Header(), nil
 }
 
 func (b *mixinBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
-	return b.ec.BlockByNumber(ctx, big.NewInt(number.Int64()))
+	if b.ec == nil {
+		return b.offlineBlock(ctx, number, true)
+	}
+	start := time.Now()
+	block, err := b.ec.BlockByNumber(ctx, big.NewInt(number.Int64()))
+	if err = upstreamError(err); err != nil {
+		logging.Ctx(ctx).Warn("Failed to fetch block from upstream", "number", number, "elapsed", time.Since(start), "err", err)
+		return nil, err
+	}
+	logging.Ctx(ctx).Debug("Fetched block from upstream", "number", number, "elapsed", time.Since(start))
+	return block, nil
 }
 
 func (b *mixinBackend) BlockTimestamp(ctx context.Context, number rpc.BlockNumber) (uint64, error) {
@@ -110,25 +148,37 @@ func (tx *rpcTransaction) UnmarshalJSON(msg []byte) error {
 	return json.Unmarshal(msg, &tx.txExtraInfo)
 }
 
-func (b *mixinBackend) TransactionByHash(ctx context.Context, txHash common.Hash) (tx *types.Transaction, number uint64, time uint64, err error) {
-	var resp *rpcTransaction
-	err = b.ec.Client().CallContext(ctx, &resp, "eth_getTransactionByHash", txHash)
+func (b *mixinBackend) TransactionByHash(ctx context.Context, txHash common.Hash) (tx *types.Transaction, number uint64, timestamp uint64, err error) {
+	if b.ec == nil {
+		if tx, number, err = b.offlineTransaction(ctx, txHash); err != nil {
+			return
+		}
+		timestamp, err = b.BlockTimestamp(ctx, rpc.BlockNumber(number))
+		return
+	}
+	var (
+		resp  *rpcTransaction
+		start = time.Now()
+	)
+	err = upstreamError(b.ec.Client().CallContext(ctx, &resp, "eth_getTransactionByHash", txHash))
 	if err != nil {
+		logging.Ctx(ctx).Warn("Failed to fetch transaction from upstream", "hash", txHash, "elapsed", time.Since(start), "err", err)
 		return
 	} else if resp == nil {
 		err = ethereum.NotFound
 		return
 	}
+	logging.Ctx(ctx).Debug("Fetched transaction from upstream", "hash", txHash, "elapsed", time.Since(start))
 	blknum := resp.BlockNumber
 	if blknum == nil {
-		return nil, 0, 0, fmt.Errorf("transaction is pending")
+		return resp.tx, 0, 0, &PendingError{Hash: txHash}
 	}
 	number = hexutil.MustDecodeUint64(*blknum)
-	time, err = b.BlockTimestamp(ctx, rpc.BlockNumber(number))
+	timestamp, err = b.BlockTimestamp(ctx, rpc.BlockNumber(number))
 	if err != nil {
 		return
 	}
-	return resp.tx, number, time, nil
+	return resp.tx, number, timestamp, nil
 }
 
 func (b *mixinBackend) TraceBlock(ctx context.Context, number rpc.BlockNumber) ([]*CallFrame, error) {
@@ -148,20 +198,124 @@ func (b *mixinBackend) TraceTransaction(ctx context.Context, txHash common.Hash)
 	if err != nil {
 		return nil, err
 	}
-	return b.trace(ctx, header, &txHash)
+	frames, err := b.trace(ctx, header, &txHash)
+	if err != nil {
+		return nil, err
+	}
+	// Every mined transaction has at least its top-level frame
+	if len(frames) == 0 {
+		return nil, &NotIndexedError{Block: number}
+	}
+	return frames, nil
+}
+
+func (b *mixinBackend) CodeAt(ctx context.Context, address common.Address, number rpc.BlockNumber) ([]byte, error) {
+	if b.ec == nil {
+		return nil, ErrOffline
+	}
+	var code hexutil.Bytes
+	err := b.ec.Client().CallContext(ctx, &code, "eth_getCode", address, number)
+	return code, upstreamError(err)
+}
+
+func (b *mixinBackend) StorageAt(ctx context.Context, address common.Address, key common.Hash, number rpc.BlockNumber) ([]byte, error) {
+	if b.ec == nil {
+		return nil, ErrOffline
+	}
+	var value hexutil.Bytes
+	err := b.ec.Client().CallContext(ctx, &value, "eth_getStorageAt", address, key, number)
+	return value, upstreamError(err)
+}
+
+func (b *mixinBackend) CallContract(ctx context.Context, to common.Address, data []byte, number rpc.BlockNumber) ([]byte, error) {
+	if b.ec == nil {
+		return nil, ErrOffline
+	}
+	var (
+		result hexutil.Bytes
+		args   = map[string]interface{}{"to": to, "data": hexutil.Bytes(data)}
+	)
+	err := b.ec.Client().CallContext(ctx, &result, "eth_call", args, number)
+	return result, upstreamError(err)
+}
+
+func (b *mixinBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	if b.ec == nil {
+		return nil, ErrOffline
+	}
+	receipt, err := b.ec.TransactionReceipt(ctx, txHash)
+	return receipt, upstreamError(err)
+}
+
+func (b *mixinBackend) BlockReceipts(ctx context.Context, number rpc.BlockNumber) ([]*types.Receipt, error) {
+	if b.ec == nil {
+		return nil, ErrOffline
+	}
+	var receipts []*types.Receipt
+	err := b.ec.Client().CallContext(ctx, &receipts, "eth_getBlockReceipts", number)
+	if err == nil {
+		return receipts, nil
+	}
+	// Not every upstream offers eth_getBlockReceipts, collect them one by one
+	logging.Ctx(ctx).Debug("Falling back to per transaction receipts", "number", number, "err", err)
+	block, err := b.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	receipts = make([]*types.Receipt, len(txs))
+	for i, tx := range txs {
+		if receipts[i], err = b.ec.TransactionReceipt(ctx, tx.Hash()); err != nil {
+			return nil, upstreamError(err)
+		}
+	}
+	return receipts, nil
+}
+
+// traces returns a query builder on the traces table of the chain, reading
+// every column into the Trace fields. Selecting other columns replaces them.
+func (b *mixinBackend) traces(ctx context.Context) *gorm.DB {
+	return b.db.WithContext(ctx).Table(b.layout.table).Select(b.layout.selects())
+}
+
+// callFrames converts the trace rows into call frames, resolving their block
+// hashes along the way.
+func (b *mixinBackend) callFrames(ctx context.Context, traces []Trace) ([]*CallFrame, error) {
+	var (
+		callFrames = make([]*CallFrame, len(traces))
+		blockHash  common.Hash
+		blockNum   = uint64(0)
+	)
+	for i, trace := range traces {
+		if i == 0 || trace.BlockNum != blockNum {
+			header, err := b.HeaderByNumber(ctx, rpc.BlockNumber(trace.BlockNum))
+			if err != nil {
+				return nil, err
+			}
+			blockHash, blockNum = header.Hash(), trace.BlockNum
+		}
+		cf := trace.AsCallFrame()
+		hash := blockHash
+		cf.BlockHash = &hash
+		callFrames[i] = cf
+	}
+	return callFrames, nil
 }
 
 func (b *mixinBackend) trace(ctx context.Context, header *types.Header, txHash *common.Hash) ([]*CallFrame, error) {
 	var traces []Trace
-	sql := b.db.Table(fmt.Sprintf("%s.%s", b.chain, "traces")).
-		Where("block_timestamp = ?", time.Unix(int64(header.Time), 0)).
-		Where("blknum = ?", header.Number)
+	l := b.layout
+	sql := b.traces(ctx).Where(l.col("blknum")+" = ?", header.Number.Uint64())
+	if l.hasTimestamp() {
+		// The partitioning column, prunes the scan down to one partition
+		sql = sql.Where(l.col("block_timestamp")+" = ?", time.Unix(int64(header.Time), 0))
+	}
 	if txHash != nil {
-		sql = sql.Where("txhash = ?", txHash.Hex())
+		sql = sql.Where(l.col("txhash")+" = ?", txHash.Hex())
 	}
 	err := sql.
+		Order(l.order(false, "txpos", "trace_address")).
 		Find(&traces).
-		Order("txpos ASC, trace_address ASC").
 		Error
 	if err != nil {
 		return nil, err
@@ -176,3 +330,14 @@ func (b *mixinBackend) trace(ctx context.Context, header *types.Header, txHash *
 	}
 	return callFrames, nil
 }
+
+// UpstreamTraceBlock returns the traces of a block as produced by the
+// upstream trace_block, bypassing the database.
+func (b *mixinBackend) UpstreamTraceBlock(ctx context.Context, number rpc.BlockNumber) ([]*CallFrame, error) {
+	if b.ec == nil {
+		return nil, ErrOffline
+	}
+	var frames []*CallFrame
+	err := b.ec.Client().CallContext(ctx, &frames, "trace_block", number)
+	return frames, upstreamError(err)
+}
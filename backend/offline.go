@@ -0,0 +1,298 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// ErrOffline is returned by the methods needing the upstream node when the
+// backend runs in offline mode.
+var ErrOffline = errors.New("not available in offline mode")
+
+// Block is a row of the <chain>.blocks table. Every header field is needed
+// to reproduce the block hash, the optional ones are null before the fork
+// introducing them.
+type Block struct {
+	Timestamp       time.Time        `gorm:"column:block_timestamp"`
+	BlockNum        uint64           `gorm:"column:blknum"`
+	BlockHash       string           `gorm:"column:blkhash"`
+	ParentHash      string           `gorm:"column:parent_hash"`
+	Nonce           string           `gorm:"column:nonce"`
+	Sha3Uncles      string           `gorm:"column:sha3_uncles"`
+	LogsBloom       string           `gorm:"column:logs_bloom"`
+	TxsRoot         string           `gorm:"column:txs_root"`
+	StateRoot       string           `gorm:"column:state_root"`
+	ReceiptsRoot    string           `gorm:"column:receipts_root"`
+	Miner           string           `gorm:"column:miner"`
+	MixHash         string           `gorm:"column:mix_hash"`
+	Difficulty      decimal.Decimal  `gorm:"column:difficulty"`
+	ExtraData       string           `gorm:"column:extra_data"`
+	GasLimit        uint64           `gorm:"column:gas_limit"`
+	GasUsed         uint64           `gorm:"column:gas_used"`
+	BaseFeePerGas   *decimal.Decimal `gorm:"column:base_fee_per_gas"`
+	WithdrawalsRoot *string          `gorm:"column:withdrawals_root"`
+	BlobGasUsed     *uint64          `gorm:"column:blob_gas_used"`
+	ExcessBlobGas   *uint64          `gorm:"column:excess_blob_gas"`
+	BeaconRoot      *string          `gorm:"column:parent_beacon_block_root"`
+}
+
+// Transaction is a row of the <chain>.transactions table, including the
+// signature needed to reproduce the transaction hash.
+type Transaction struct {
+	BlockNum             uint64           `gorm:"column:blknum"`
+	TransactionHash      string           `gorm:"column:txhash"`
+	TransactionPos       uint64           `gorm:"column:txpos"`
+	TxType               uint8            `gorm:"column:tx_type"`
+	Nonce                uint64           `gorm:"column:nonce"`
+	ToAddress            *string          `gorm:"column:to_address"`
+	Value                decimal.Decimal  `gorm:"column:value"`
+	Gas                  uint64           `gorm:"column:gas"`
+	GasPrice             *decimal.Decimal `gorm:"column:gas_price"`
+	MaxFeePerGas         *decimal.Decimal `gorm:"column:max_fee_per_gas"`
+	MaxPriorityFeePerGas *decimal.Decimal `gorm:"column:max_priority_fee_per_gas"`
+	Input                string           `gorm:"column:input"`
+	ChainID              *decimal.Decimal `gorm:"column:chain_id"`
+	AccessList           *string          `gorm:"column:access_list"` // JSON encoded
+	MaxFeePerBlobGas     *decimal.Decimal `gorm:"column:max_fee_per_blob_gas"`
+	BlobHashes           *string          `gorm:"column:blob_versioned_hashes"` // JSON encoded
+	V                    decimal.Decimal  `gorm:"column:v"`
+	R                    decimal.Decimal  `gorm:"column:r"`
+	S                    decimal.Decimal  `gorm:"column:s"`
+}
+
+// Withdrawal is a row of the <chain>.withdrawals table, the beacon chain
+// withdrawals of a block in their order.
+type Withdrawal struct {
+	BlockNum       uint64 `gorm:"column:blknum"`
+	Index          uint64 `gorm:"column:withdrawal_index"`
+	ValidatorIndex uint64 `gorm:"column:validator_index"`
+	Address        string `gorm:"column:address"`
+	Amount         uint64 `gorm:"column:amount"` // gwei
+}
+
+func decimalBig(d *decimal.Decimal) *big.Int {
+	if d == nil {
+		return nil
+	}
+	return d.BigInt()
+}
+
+func decimalUint256(d *decimal.Decimal) *uint256.Int {
+	if d == nil {
+		return nil
+	}
+	return uint256.MustFromBig(d.BigInt())
+}
+
+// Header rebuilds the block header, checking it hashes to the stored hash.
+func (b *Block) Header() (*types.Header, error) {
+	header := &types.Header{
+		ParentHash:  common.HexToHash(b.ParentHash),
+		UncleHash:   common.HexToHash(b.Sha3Uncles),
+		Coinbase:    common.HexToAddress(b.Miner),
+		Root:        common.HexToHash(b.StateRoot),
+		TxHash:      common.HexToHash(b.TxsRoot),
+		ReceiptHash: common.HexToHash(b.ReceiptsRoot),
+		Bloom:       types.BytesToBloom(common.FromHex(b.LogsBloom)),
+		Difficulty:  b.Difficulty.BigInt(),
+		Number:      new(big.Int).SetUint64(b.BlockNum),
+		GasLimit:    b.GasLimit,
+		GasUsed:     b.GasUsed,
+		Time:        uint64(b.Timestamp.Unix()),
+		Extra:       common.FromHex(b.ExtraData),
+		MixDigest:   common.HexToHash(b.MixHash),
+		Nonce:       types.EncodeNonce(new(big.Int).SetBytes(common.FromHex(b.Nonce)).Uint64()),
+		BaseFee:     decimalBig(b.BaseFeePerGas),
+	}
+	if b.WithdrawalsRoot != nil {
+		root := common.HexToHash(*b.WithdrawalsRoot)
+		header.WithdrawalsHash = &root
+	}
+	header.BlobGasUsed, header.ExcessBlobGas = b.BlobGasUsed, b.ExcessBlobGas
+	if b.BeaconRoot != nil {
+		root := common.HexToHash(*b.BeaconRoot)
+		header.ParentBeaconRoot = &root
+	}
+	if hash := header.Hash(); hash != common.HexToHash(b.BlockHash) {
+		return nil, fmt.Errorf("block %d hashes to %s instead of %s, header fields missing from the blocks table", b.BlockNum, hash.Hex(), b.BlockHash)
+	}
+	return header, nil
+}
+
+// Tx rebuilds the signed transaction, checking it hashes to the stored hash.
+func (t *Transaction) Tx() (*types.Transaction, error) {
+	var (
+		to    *common.Address
+		input = common.FromHex(t.Input)
+		value = t.Value.BigInt()
+		v     = t.V.BigInt()
+		r     = t.R.BigInt()
+		s     = t.S.BigInt()
+	)
+	if t.ToAddress != nil {
+		addr := common.HexToAddress(*t.ToAddress)
+		to = &addr
+	}
+	var accessList types.AccessList
+	if t.AccessList != nil && *t.AccessList != "" {
+		if err := json.Unmarshal([]byte(*t.AccessList), &accessList); err != nil {
+			return nil, fmt.Errorf("transaction %s: invalid access list: %v", t.TransactionHash, err)
+		}
+	}
+	var blobHashes []common.Hash
+	if t.BlobHashes != nil && *t.BlobHashes != "" {
+		if err := json.Unmarshal([]byte(*t.BlobHashes), &blobHashes); err != nil {
+			return nil, fmt.Errorf("transaction %s: invalid blob hashes: %v", t.TransactionHash, err)
+		}
+	}
+	var data types.TxData
+	switch t.TxType {
+	case types.LegacyTxType:
+		data = &types.LegacyTx{Nonce: t.Nonce, GasPrice: decimalBig(t.GasPrice), Gas: t.Gas, To: to, Value: value, Data: input, V: v, R: r, S: s}
+	case types.AccessListTxType:
+		data = &types.AccessListTx{ChainID: decimalBig(t.ChainID), Nonce: t.Nonce, GasPrice: decimalBig(t.GasPrice), Gas: t.Gas, To: to, Value: value, Data: input, AccessList: accessList, V: v, R: r, S: s}
+	case types.DynamicFeeTxType:
+		data = &types.DynamicFeeTx{ChainID: decimalBig(t.ChainID), Nonce: t.Nonce, GasTipCap: decimalBig(t.MaxPriorityFeePerGas), GasFeeCap: decimalBig(t.MaxFeePerGas), Gas: t.Gas, To: to, Value: value, Data: input, AccessList: accessList, V: v, R: r, S: s}
+	case types.BlobTxType:
+		// Blob transactions can't create contracts
+		if to == nil {
+			return nil, fmt.Errorf("blob transaction %s without recipient", t.TransactionHash)
+		}
+		data = &types.BlobTx{ChainID: decimalUint256(t.ChainID), Nonce: t.Nonce, GasTipCap: decimalUint256(t.MaxPriorityFeePerGas), GasFeeCap: decimalUint256(t.MaxFeePerGas), Gas: t.Gas, To: *to, Value: uint256.MustFromBig(value), Data: input, AccessList: accessList, BlobFeeCap: decimalUint256(t.MaxFeePerBlobGas), BlobHashes: blobHashes, V: uint256.MustFromBig(v), R: uint256.MustFromBig(r), S: uint256.MustFromBig(s)}
+	default:
+		return nil, fmt.Errorf("transaction %s: unsupported type %d", t.TransactionHash, t.TxType)
+	}
+	tx := types.NewTx(data)
+	if hash := tx.Hash(); hash != common.HexToHash(t.TransactionHash) {
+		return nil, fmt.Errorf("transaction %s hashes to %s, fields missing from the transactions table", t.TransactionHash, hash.Hex())
+	}
+	return tx, nil
+}
+
+// offlineNumber resolves block tags against the highest stored block.
+func (b *mixinBackend) offlineNumber(ctx context.Context, number rpc.BlockNumber) (uint64, error) {
+	switch number {
+	case rpc.PendingBlockNumber:
+		return 0, ErrOffline
+	case rpc.EarliestBlockNumber:
+		return 0, nil
+	case rpc.LatestBlockNumber, rpc.SafeBlockNumber, rpc.FinalizedBlockNumber:
+		var head *uint64
+		err := b.db.WithContext(ctx).Table(b.table("blocks")).Select("MAX(blknum)").Scan(&head).Error
+		if err != nil {
+			return 0, err
+		}
+		if head == nil {
+			return 0, ethereum.NotFound
+		}
+		return *head, nil
+	}
+	return uint64(number), nil
+}
+
+// offlineBlock reads a block and, if requested, its transactions.
+func (b *mixinBackend) offlineBlock(ctx context.Context, number rpc.BlockNumber, withTxs bool) (*types.Block, error) {
+	n, err := b.offlineNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	var row Block
+	err = b.db.WithContext(ctx).Table(b.table("blocks")).Where("blknum = ?", n).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ethereum.NotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	header, err := row.Header()
+	if err != nil {
+		return nil, err
+	}
+	if !withTxs {
+		return types.NewBlockWithHeader(header), nil
+	}
+	var rows []Transaction
+	err = b.db.WithContext(ctx).Table(b.table("transactions")).
+		Where("blknum = ?", n).
+		Order("txpos ASC").
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*types.Transaction, len(rows))
+	for i := range rows {
+		if txs[i], err = rows[i].Tx(); err != nil {
+			return nil, err
+		}
+	}
+	block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+	if header.WithdrawalsHash == nil {
+		return block, nil
+	}
+	withdrawals, err := b.offlineWithdrawals(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	if hash := types.DeriveSha(types.Withdrawals(withdrawals), trie.NewStackTrie(nil)); hash != *header.WithdrawalsHash {
+		return nil, fmt.Errorf("withdrawals of block %d hash to %s instead of %s, rows missing from the withdrawals table", n, hash.Hex(), header.WithdrawalsHash.Hex())
+	}
+	return block.WithWithdrawals(withdrawals), nil
+}
+
+// offlineWithdrawals reads the withdrawals of a block.
+func (b *mixinBackend) offlineWithdrawals(ctx context.Context, number uint64) ([]*types.Withdrawal, error) {
+	var rows []Withdrawal
+	err := b.db.WithContext(ctx).Table(b.table("withdrawals")).
+		Where("blknum = ?", number).
+		Order("withdrawal_index ASC").
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	withdrawals := make([]*types.Withdrawal, len(rows))
+	for i, row := range rows {
+		withdrawals[i] = &types.Withdrawal{
+			Index:     row.Index,
+			Validator: row.ValidatorIndex,
+			Address:   common.HexToAddress(row.Address),
+			Amount:    row.Amount,
+		}
+	}
+	return withdrawals, nil
+}
+
+// offlineTransaction reads a transaction along with its block number.
+func (b *mixinBackend) offlineTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, uint64, error) {
+	var row Transaction
+	err := b.db.WithContext(ctx).Table(b.table("transactions")).
+		Where("txhash = ?", hexutil.Encode(txHash[:])).
+		Take(&row).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, ethereum.NotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	tx, err := row.Tx()
+	if err != nil {
+		return nil, 0, err
+	}
+	return tx, row.BlockNum, nil
+}
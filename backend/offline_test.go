@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
+)
+
+func TestOfflineRows(t *testing.T) {
+	var (
+		baseFee = big.NewInt(7)
+		header  = &types.Header{
+			ParentHash: common.HexToHash("0x01"),
+			UncleHash:  types.EmptyUncleHash,
+			Coinbase:   common.HexToAddress("0xee"),
+			Root:       common.HexToHash("0x02"),
+			TxHash:     types.EmptyTxsHash,
+			Difficulty: big.NewInt(0),
+			Number:     big.NewInt(17000000),
+			GasLimit:   30000000,
+			GasUsed:    21000,
+			Time:       1681338455,
+			Extra:      []byte("hdt"),
+			MixDigest:  common.HexToHash("0x03"),
+			Nonce:      types.EncodeNonce(42),
+			BaseFee:    baseFee,
+		}
+		fee = decimal.NewFromBigInt(baseFee, 0)
+	)
+	row := Block{
+		Timestamp:     time.Unix(int64(header.Time), 0),
+		BlockNum:      header.Number.Uint64(),
+		BlockHash:     header.Hash().Hex(),
+		ParentHash:    header.ParentHash.Hex(),
+		Nonce:         hexutil.Encode(header.Nonce[:]),
+		Sha3Uncles:    header.UncleHash.Hex(),
+		LogsBloom:     hexutil.Encode(header.Bloom[:]),
+		TxsRoot:       header.TxHash.Hex(),
+		StateRoot:     header.Root.Hex(),
+		ReceiptsRoot:  header.ReceiptHash.Hex(),
+		Miner:         strings.ToLower(header.Coinbase.Hex()),
+		MixHash:       header.MixDigest.Hex(),
+		Difficulty:    decimal.Zero,
+		ExtraData:     hexutil.Encode(header.Extra),
+		GasLimit:      header.GasLimit,
+		GasUsed:       header.GasUsed,
+		BaseFeePerGas: &fee,
+	}
+	if _, err := row.Header(); err != nil {
+		t.Fatal(err)
+	}
+	row.MixHash = ""
+	if _, err := row.Header(); err == nil {
+		t.Error("expected hash mismatch without mix hash")
+	}
+
+	key, _ := crypto.GenerateKey()
+	to := common.HexToAddress("0xbb")
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(1)), &types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		Nonce:     3,
+		GasTipCap: big.NewInt(2),
+		GasFeeCap: big.NewInt(20),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(1e18),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, r, s := tx.RawSignatureValues()
+	var (
+		toHex    = to.Hex()
+		chainID  = decimal.NewFromInt(1)
+		tip      = decimal.NewFromInt(2)
+		feeCap   = decimal.NewFromInt(20)
+		emptyACL = "[]"
+	)
+	txRow := Transaction{
+		TransactionHash:      tx.Hash().Hex(),
+		TxType:               types.DynamicFeeTxType,
+		Nonce:                3,
+		ToAddress:            &toHex,
+		Value:                decimal.NewFromBigInt(tx.Value(), 0),
+		Gas:                  21000,
+		MaxFeePerGas:         &feeCap,
+		MaxPriorityFeePerGas: &tip,
+		Input:                "0x",
+		ChainID:              &chainID,
+		AccessList:           &emptyACL,
+		V:                    decimal.NewFromBigInt(v, 0),
+		R:                    decimal.NewFromBigInt(r, 0),
+		S:                    decimal.NewFromBigInt(s, 0),
+	}
+	if _, err := txRow.Tx(); err != nil {
+		t.Fatal(err)
+	}
+	txRow.Nonce = 4
+	if _, err := txRow.Tx(); err == nil {
+		t.Error("expected hash mismatch with a wrong nonce")
+	}
+}
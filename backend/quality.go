@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QualityIssue is a violation of a structural invariant of the traces table.
+type QualityIssue struct {
+	ID              uint64    `json:"-" gorm:"column:id;primaryKey"`
+	BlockNum        uint64    `json:"blknum" gorm:"column:blknum"`
+	Rule            string    `json:"rule" gorm:"column:rule"`
+	TransactionHash *string   `json:"txhash,omitempty" gorm:"column:txhash"`
+	TraceAddress    *string   `json:"trace_address,omitempty" gorm:"column:trace_address"`
+	Detail          string    `json:"detail" gorm:"column:detail"`
+	CheckedAt       time.Time `json:"checked_at" gorm:"column:checked_at"`
+}
+
+// qualityProgress is the progress name of the quality checker.
+const qualityProgress = "trace_quality"
+
+// progress returns the block a derived table has been built up to.
+func (b *mixinBackend) progress(ctx context.Context, name string) (uint64, bool, error) {
+	var progress Progress
+	err := b.db.WithContext(ctx).Table(b.table("hdt_progress")).
+		Where("name = ?", name).
+		Take(&progress).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return progress.BlockNum, true, nil
+}
+
+func (b *mixinBackend) TraceStructure(ctx context.Context, fromBlock, toBlock uint64) ([]Trace, error) {
+	var rows []Trace
+	l := b.layout
+	err := b.traces(ctx).
+		Select(l.selects("block_timestamp", "blknum", "txhash", "txpos", "trace_type", "subtraces", "trace_address")).
+		Where(l.col("blknum")+" BETWEEN ? AND ?", fromBlock, toBlock).
+		Order(l.order(false, "blknum", "txpos")).
+		Find(&rows).
+		Error
+	return rows, err
+}
+
+func (b *mixinBackend) QualityCheckHead(ctx context.Context) (uint64, bool, error) {
+	return b.progress(ctx, qualityProgress)
+}
+
+func (b *mixinBackend) WriteQualityIssues(ctx context.Context, fromBlock, toBlock uint64, issues []*QualityIssue, advance bool) error {
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		table := b.table("trace_quality_issues")
+		// A range checked again replaces its previous findings
+		err := tx.Table(table).
+			Where("blknum BETWEEN ? AND ?", fromBlock, toBlock).
+			Delete(&QualityIssue{}).
+			Error
+		if err != nil {
+			return err
+		}
+		if len(issues) > 0 {
+			if err := tx.Table(table).CreateInBatches(issues, 500).Error; err != nil {
+				return err
+			}
+		}
+		if !advance {
+			return nil
+		}
+		return tx.Table(b.table("hdt_progress")).
+			Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&Progress{Name: qualityProgress, BlockNum: toBlock}).
+			Error
+	})
+}
+
+func (b *mixinBackend) QualityIssueCounts(ctx context.Context) (map[string]uint64, error) {
+	var rows []struct {
+		Rule  string
+		Count uint64
+	}
+	err := b.db.WithContext(ctx).Table(b.table("trace_quality_issues")).
+		Select("rule, COUNT(*) AS count").
+		Group("rule").
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]uint64, len(rows))
+	for _, row := range rows {
+		counts[row.Rule] = row.Count
+	}
+	return counts, nil
+}
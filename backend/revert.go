@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Kinds of revert reasons.
+const (
+	RevertError   = "error"   // Error(string), as raised by require and revert
+	RevertPanic   = "panic"   // Panic(uint256), as raised by the compiler checks
+	RevertCustom  = "custom"  // Custom error decoded with the ABI registry
+	RevertUnknown = "unknown" // Undecodable revert data, e.g. an unknown custom error
+	RevertEmpty   = "empty"   // No revert data at all
+)
+
+var (
+	errorSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+	panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+)
+
+// panicReasons explains the panic codes raised by solidity.
+var panicReasons = map[uint64]string{
+	0x00: "generic compiler inserted panic",
+	0x01: "assertion failed",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesN",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// RevertReason is the decoding of the revert data of a failed frame.
+type RevertReason struct {
+	Kind      string          `json:"kind"`
+	Message   string          `json:"message,omitempty"` // Reason string or explanation of the panic code
+	PanicCode *hexutil.Uint64 `json:"panicCode,omitempty"`
+	Selector  hexutil.Bytes   `json:"selector,omitempty"`
+	Signature string          `json:"signature,omitempty"` // Signature of a custom error
+	Inputs    []DecodedValue  `json:"inputs,omitempty"`    // Arguments of a custom error
+}
+
+// DecodeRevert decodes the standard Error(string) and Panic(uint256) revert
+// data. Any other data is reported as unknown, carrying its selector.
+func DecodeRevert(data []byte) *RevertReason {
+	switch {
+	case len(data) == 0:
+		return &RevertReason{Kind: RevertEmpty}
+	case len(data) < 4:
+		return &RevertReason{Kind: RevertUnknown}
+	case bytes.Equal(data[:4], errorSelector):
+		if reason, err := abi.UnpackRevert(data); err == nil {
+			return &RevertReason{Kind: RevertError, Message: reason, Selector: data[:4]}
+		}
+	case bytes.Equal(data[:4], panicSelector) && len(data) == 4+32:
+		code := new(big.Int).SetBytes(data[4:])
+		if !code.IsUint64() {
+			break
+		}
+		pc := hexutil.Uint64(code.Uint64())
+		message, ok := panicReasons[code.Uint64()]
+		if !ok {
+			message = fmt.Sprintf("unknown panic code %#x", code)
+		}
+		return &RevertReason{Kind: RevertPanic, Message: message, PanicCode: &pc, Selector: data[:4]}
+	}
+	return &RevertReason{Kind: RevertUnknown, Selector: data[:4]}
+}
@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestDecodeRevert(t *testing.T) {
+	tests := []struct {
+		data    string
+		kind    string
+		message string
+	}{
+		{"0x", RevertEmpty, ""},
+		// revert("Ownable: caller is not the owner")
+		{"0x08c379a0" +
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+			"4f776e61626c653a2063616c6c6572206973206e6f7420746865206f776e6572", RevertError, "Ownable: caller is not the owner"},
+		{"0x4e487b710000000000000000000000000000000000000000000000000000000000000011", RevertPanic, "arithmetic underflow or overflow"},
+		{"0x4e487b7100000000000000000000000000000000000000000000000000000000000000ff", RevertPanic, "unknown panic code 0xff"},
+		{"0xe450d38c" + common.Bytes2Hex(make([]byte, 96)), RevertUnknown, ""},
+	}
+	for i, tt := range tests {
+		reason := DecodeRevert(hexutil.MustDecode(tt.data))
+		if reason.Kind != tt.kind || reason.Message != tt.message {
+			t.Errorf("test %d: have %s %q, want %s %q", i, reason.Kind, reason.Message, tt.kind, tt.message)
+		}
+	}
+}
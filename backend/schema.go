@@ -0,0 +1,248 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Trace address encodings of the traces table.
+const (
+	TraceAddressString = "string" // Text such as "[1, 2]" or "1,2"
+	TraceAddressArray  = "array"  // Integer array, int[]
+	TraceAddressJSONB  = "jsonb"  // JSON array, jsonb
+)
+
+// traceColumns are the columns of the default traces layout, which the
+// column mapping is keyed by.
+var traceColumns = []string{
+	"block_timestamp", "blknum", "txhash", "txpos", "from_address", "to_address",
+	"value", "input", "output", "trace_type", "call_type", "reward_type", "gas",
+	"gas_used", "subtraces", "trace_address", "error",
+}
+
+// TraceSchema describes the layout of the traces table, so tables written by
+// different ETLs can be read.
+type TraceSchema struct {
+	// Table is the table name template, {{chain}} is replaced by the chain.
+	Table string `json:"table"`
+
+	// Columns renames the columns of the default layout, keyed by their
+	// default name. A column mapped to "" is absent, only block_timestamp
+	// may be, blocks are then looked up by number only.
+	Columns map[string]string `json:"columns"`
+
+	// TraceAddress is the encoding of the trace address column.
+	TraceAddress string `json:"traceAddress"`
+}
+
+// DefaultTraceSchema is the layout of the <chain>.traces table.
+func DefaultTraceSchema() *TraceSchema {
+	return &TraceSchema{Table: "{{chain}}.traces", TraceAddress: TraceAddressString}
+}
+
+// LoadTraceSchema reads a JSON trace schema, unset fields keep their defaults.
+func LoadTraceSchema(path string) (*TraceSchema, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schema := DefaultTraceSchema()
+	if err := json.Unmarshal(blob, schema); err != nil {
+		return nil, fmt.Errorf("invalid trace schema %s: %v", path, err)
+	}
+	return schema, nil
+}
+
+// traceLayout is a validated trace schema resolved for a chain.
+type traceLayout struct {
+	table   string
+	columns map[string]string
+	address string
+	sqlite  bool // SQLite development database, see SQLitePrefix
+}
+
+func newTraceLayout(schema *TraceSchema, chain string) (*traceLayout, error) {
+	if schema == nil {
+		schema = DefaultTraceSchema()
+	}
+	if schema.Table == "" {
+		return nil, fmt.Errorf("trace schema without table")
+	}
+	l := &traceLayout{
+		table:   strings.ReplaceAll(schema.Table, "{{chain}}", chain),
+		columns: make(map[string]string, len(traceColumns)),
+		address: schema.TraceAddress,
+	}
+	switch l.address {
+	case "":
+		l.address = TraceAddressString
+	case TraceAddressString, TraceAddressArray, TraceAddressJSONB:
+	default:
+		return nil, fmt.Errorf("unknown trace address encoding %q", schema.TraceAddress)
+	}
+	for _, name := range traceColumns {
+		l.columns[name] = name
+	}
+	for name, column := range schema.Columns {
+		if _, ok := l.columns[name]; !ok {
+			return nil, fmt.Errorf("unknown trace column %q", name)
+		}
+		if column == "" && name != "block_timestamp" {
+			return nil, fmt.Errorf("trace column %q can't be absent", name)
+		}
+		l.columns[name] = column
+	}
+	return l, nil
+}
+
+// col returns the column holding a field of the default layout.
+func (l *traceLayout) col(name string) string {
+	return l.columns[name]
+}
+
+// hasTimestamp reports whether the table carries the block timestamps.
+func (l *traceLayout) hasTimestamp() bool {
+	return l.columns["block_timestamp"] != ""
+}
+
+// selects returns the select list reading the requested fields, all if none,
+// into the columns of the Trace struct, the trace address in its text form.
+func (l *traceLayout) selects(names ...string) []string {
+	if len(names) == 0 {
+		names = traceColumns
+	}
+	selects := make([]string, 0, len(names))
+	for _, name := range names {
+		column := l.columns[name]
+		switch {
+		case column == "":
+			continue
+		case name == "trace_address":
+			selects = append(selects, l.traceAddressText()+" AS trace_address")
+		case column == name:
+			selects = append(selects, column)
+		default:
+			selects = append(selects, column+" AS "+name)
+		}
+	}
+	return selects
+}
+
+// traceAddressText converts the trace address column into text like "[1, 2]".
+func (l *traceLayout) traceAddressText() string {
+	column := l.columns["trace_address"]
+	switch l.address {
+	case TraceAddressArray:
+		return "'[' || array_to_string(" + column + ", ', ') || ']'"
+	case TraceAddressJSONB:
+		return column + "::text"
+	}
+	return column
+}
+
+// traceAddressKey is the expression sorting the trace addresses in
+// depth-first order, position by position: [1, 2] before [1, 10]. The text
+// forms sort wrongly, they are parsed into integer arrays.
+func (l *traceLayout) traceAddressKey() string {
+	column := l.columns["trace_address"]
+	switch {
+	case l.sqlite:
+		return "trace_address_key(" + column + ")"
+	case l.address == TraceAddressArray:
+		return column
+	case l.address == TraceAddressJSONB:
+		return "ARRAY(SELECT e::int FROM jsonb_array_elements_text(" + column + ") WITH ORDINALITY AS t(e, i) ORDER BY i)"
+	}
+	return "string_to_array(btrim(" + column + ", '[] '), ',')::int[]"
+}
+
+// traceAddressIndexKey returns the index element matching traceAddressKey,
+// empty if the key can't be indexed: the jsonb one needs a subquery.
+func (l *traceLayout) traceAddressIndexKey() string {
+	switch l.address {
+	case TraceAddressArray:
+		return l.columns["trace_address"]
+	case TraceAddressJSONB:
+		return ""
+	}
+	return "(" + l.traceAddressKey() + ")"
+}
+
+// placeholders returns the migration placeholders of the traces table and
+// their values: {{traces}} is the table, {{traces.name}} its unqualified
+// name, {{traces.<column>}} a column of the default layout and
+// {{traces.trace_address_key}} the trace address index element, prefixed
+// with a comma unless it can't be indexed.
+func (l *traceLayout) placeholders() []string {
+	name := l.table[strings.LastIndex(l.table, ".")+1:]
+	key := l.traceAddressIndexKey()
+	if key != "" {
+		key = ", " + key
+	}
+	pairs := []string{
+		"{{traces}}", l.table,
+		"{{traces.name}}", strings.Trim(name, `"`),
+		"{{traces.trace_address_key}}", key,
+	}
+	for _, column := range traceColumns {
+		pairs = append(pairs, "{{traces."+column+"}}", l.columns[column])
+	}
+	return pairs
+}
+
+// traceAddressCursor returns the placeholder and argument comparing the key
+// against the text form of a trace address.
+func (l *traceLayout) traceAddressCursor(text string) (string, interface{}) {
+	address, _ := ParseTraceAddress(text)
+	if l.sqlite {
+		return "?", traceAddressSortKey(address)
+	}
+	return "?::int[]", arrayLiteral(address)
+}
+
+// arrayLiteral formats a trace address as a Postgres array literal, "{1,2}".
+func arrayLiteral(address []int) string {
+	elems := make([]string, len(address))
+	for i, pos := range address {
+		elems[i] = fmt.Sprint(pos)
+	}
+	return "{" + strings.Join(elems, ",") + "}"
+}
+
+// topLevel returns the condition matching the top-level (or internal) frames.
+func (l *traceLayout) topLevel(top bool) string {
+	column := l.columns["trace_address"]
+	var cond string
+	switch l.address {
+	case TraceAddressArray:
+		cond = "cardinality(" + column + ") = 0"
+	case TraceAddressJSONB:
+		cond = "jsonb_array_length(" + column + ") = 0"
+	default:
+		cond = column + " IN ('[]', '')"
+	}
+	if !top {
+		cond = "NOT " + cond
+	}
+	return cond
+}
+
+// order returns the ORDER BY clause of the given fields, with the trace
+// address sorted by its key.
+func (l *traceLayout) order(desc bool, names ...string) string {
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		column := l.columns[name]
+		if name == "trace_address" {
+			column = l.traceAddressKey()
+		}
+		parts[i] = column + dir
+	}
+	return strings.Join(parts, ", ")
+}
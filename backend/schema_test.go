@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTraceLayout(t *testing.T) {
+	l, err := newTraceLayout(&TraceSchema{
+		Table:        "{{chain}}_etl.traces",
+		Columns:      map[string]string{"blknum": "block_number", "trace_address": "path", "block_timestamp": ""},
+		TraceAddress: TraceAddressArray,
+	}, "ethereum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.table != "ethereum_etl.traces" {
+		t.Errorf("table mismatch: have %s", l.table)
+	}
+	selects := strings.Join(l.selects(), ", ")
+	for _, want := range []string{"block_number AS blknum", "'[' || array_to_string(path, ', ') || ']' AS trace_address", "txhash"} {
+		if !strings.Contains(selects, want) {
+			t.Errorf("select %q missing from %s", want, selects)
+		}
+	}
+	if strings.Contains(selects, "block_timestamp") || l.hasTimestamp() {
+		t.Errorf("absent timestamp selected: %s", selects)
+	}
+	if placeholder, arg := l.traceAddressCursor("[1, 10]"); placeholder != "?::int[]" || arg != "{1,10}" {
+		t.Errorf("cursor mismatch: have %s %v", placeholder, arg)
+	}
+	if have := l.order(true, "blknum", "trace_address"); have != "block_number DESC, path DESC" {
+		t.Errorf("order mismatch: have %s", have)
+	}
+
+	for _, schema := range []*TraceSchema{
+		{Table: "t", TraceAddress: "bytea"},
+		{Table: "t", Columns: map[string]string{"nonexistent": "x"}},
+		{Table: "t", Columns: map[string]string{"blknum": ""}},
+		{},
+	} {
+		if _, err := newTraceLayout(schema, "ethereum"); err == nil {
+			t.Errorf("expected error for schema %+v", schema)
+		}
+	}
+	l, _ = newTraceLayout(nil, "ethereum")
+	if l.table != "ethereum.traces" || l.topLevel(false) != "NOT trace_address IN ('[]', '')" {
+		t.Errorf("default layout mismatch: %s %s", l.table, l.topLevel(false))
+	}
+	// Text addresses are compared as integer arrays, [2] before [10]
+	if key := l.traceAddressKey(); key != "string_to_array(btrim(trace_address, '[] '), ',')::int[]" {
+		t.Errorf("key mismatch: have %s", key)
+	}
+	if placeholder, arg := l.traceAddressCursor("[1, 10]"); placeholder != "?::int[]" || arg != "{1,10}" {
+		t.Errorf("cursor mismatch: have %s %v", placeholder, arg)
+	}
+	l.sqlite = true
+	if placeholder, arg := l.traceAddressCursor("[1, 10]"); placeholder != "?" || arg != sqliteTraceAddressKey("1,10") {
+		t.Errorf("SQLite cursor mismatch: have %s %v", placeholder, arg)
+	}
+	if a, b := sqliteTraceAddressKey("[2]"), sqliteTraceAddressKey("[10]"); a >= b || sqliteTraceAddressKey("[]") >= a {
+		t.Errorf("SQLite keys out of order: [] %q, [2] %q, [10] %q", sqliteTraceAddressKey("[]"), a, b)
+	}
+}
+
+func TestMigrationLayout(t *testing.T) {
+	blob, err := migrations.ReadFile("migrations/0001_traces_address_indexes.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		schema *TraceSchema
+		want   []string
+	}{
+		{
+			nil,
+			[]string{
+				"CREATE INDEX CONCURRENTLY IF NOT EXISTS traces_from_address_idx\n    ON ethereum.traces (from_address, blknum, txpos, (string_to_array(btrim(trace_address, '[] '), ',')::int[]));",
+				"CREATE INDEX CONCURRENTLY IF NOT EXISTS traces_to_address_idx\n    ON ethereum.traces (to_address, blknum, txpos, (string_to_array(btrim(trace_address, '[] '), ',')::int[]));",
+			},
+		},
+		{
+			&TraceSchema{
+				Table:        "{{chain}}_etl.call_traces",
+				Columns:      map[string]string{"blknum": "block_number", "from_address": "sender", "trace_address": "path"},
+				TraceAddress: TraceAddressArray,
+			},
+			[]string{"CREATE INDEX CONCURRENTLY IF NOT EXISTS call_traces_from_address_idx\n    ON ethereum_etl.call_traces (sender, block_number, txpos, path);"},
+		},
+		{
+			&TraceSchema{Table: "traces", TraceAddress: TraceAddressJSONB},
+			[]string{"CREATE INDEX CONCURRENTLY IF NOT EXISTS traces_to_address_idx\n    ON traces (to_address, blknum, txpos);"},
+		},
+	}
+	for _, tt := range tests {
+		layout, err := newTraceLayout(tt.schema, "ethereum")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := &mixinBackend{chain: "ethereum", layout: layout}
+		sql := b.migrationReplacer(true).Replace(string(blob))
+		if strings.Contains(sql, "{{") {
+			t.Errorf("placeholders left in %s", sql)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(sql, want) {
+				t.Errorf("statement %q missing from %s", want, sql)
+			}
+		}
+	}
+}
+
+// TestMigrationTables checks the migrations run on every database leave the
+// tables of the offline mode alone, traces-only deployments don't have them.
+func TestMigrationTables(t *testing.T) {
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		blob, err := migrations.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"{{chain}}.blocks", "{{chain}}.transactions", "{{chain}}.withdrawals"} {
+			if strings.Contains(string(blob), table) {
+				t.Errorf("%s references %s, move it to migrations/offline", entry.Name(), table)
+			}
+		}
+	}
+	if _, err := offlineMigrations.ReadFile("migrations/offline/0001_cancun_columns.sql"); err != nil {
+		t.Fatal(err)
+	}
+}
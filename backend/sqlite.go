@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"strings"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SQLitePrefix marks a DBDSN as a SQLite database, e.g. "sqlite:hdt.db" or
+// "sqlite::memory:". Meant for development and tests, see NewDevBackend.
+const SQLitePrefix = "sqlite:"
+
+// sqliteDriver is the SQLite driver with the functions of the backend queries.
+const sqliteDriver = "sqlite3_hdt"
+
+//go:embed sqlite/schema.sql
+var sqliteSchema embed.FS
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("trace_address_key", sqliteTraceAddressKey, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("split_part", sqliteSplitPart, true)
+		},
+	})
+}
+
+// sqliteTraceAddressKey is the SQLite trace_address_key(text) function.
+func sqliteTraceAddressKey(text string) string {
+	address, _ := ParseTraceAddress(text)
+	return traceAddressSortKey(address)
+}
+
+// sqliteSplitPart is the PostgreSQL split_part(text, delimiter, n) function,
+// for positive n: the n-th field, or an empty string if there are fewer.
+func sqliteSplitPart(text, delimiter string, n int) string {
+	fields := strings.Split(text, delimiter)
+	if n < 1 || n > len(fields) {
+		return ""
+	}
+	return fields[n-1]
+}
+
+// traceAddressSortKey encodes a trace address as text sorting in depth-first
+// order, each position as fixed width hex.
+func traceAddressSortKey(address []int) string {
+	var key strings.Builder
+	for _, pos := range address {
+		fmt.Fprintf(&key, "%08x", pos)
+	}
+	return key.String()
+}
+
+// dialector returns the gorm dialect of the DSN.
+func dialector(dsn string) gorm.Dialector {
+	if strings.HasPrefix(dsn, SQLitePrefix) {
+		// The chain database is attached once the connection is open
+		return &sqlite.Dialector{DriverName: sqliteDriver, DSN: ":memory:"}
+	}
+	return postgres.New(postgres.Config{DSN: dsn, PreferSimpleProtocol: true})
+}
+
+// isSQLite reports whether the connection is a SQLite one.
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// attachSQLite attaches the database holding the chain tables under the
+// chain name, so <chain>.traces resolves as it does in PostgreSQL.
+//
+// Attached and in-memory databases are per connection, the pool is limited
+// to one connection which is never recycled.
+func attachSQLite(db *gorm.DB, dsn, chain string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+
+	path := strings.TrimPrefix(dsn, SQLitePrefix)
+	if path == "" {
+		path = ":memory:"
+	}
+	return db.Exec(fmt.Sprintf("ATTACH DATABASE ? AS %q", chain), path).Error
+}
+
+// migrateSQLite creates every table read or written by the backend, the
+// ones filled by the ETL on PostgreSQL included.
+func (b *mixinBackend) migrateSQLite(ctx context.Context) error {
+	blob, err := sqliteSchema.ReadFile("sqlite/schema.sql")
+	if err != nil {
+		return err
+	}
+	replacer := strings.NewReplacer("{{chain}}", b.chain)
+	for _, stmt := range strings.Split(string(blob), ";") {
+		if isComment(stmt) {
+			continue
+		}
+		if err := b.db.WithContext(ctx).Exec(replacer.Replace(stmt)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
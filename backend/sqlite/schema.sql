@@ -0,0 +1,164 @@
+-- Chain tables of the SQLite development backend, mirroring the columns the
+-- ETL writes into PostgreSQL. Big integers (wei amounts, gas, signatures)
+-- are stored as TEXT: NUMERIC would turn anything above 2^63 into a lossy
+-- REAL. Tables live in the database attached under the chain name.
+CREATE TABLE IF NOT EXISTS {{chain}}.blocks (
+    block_timestamp          TIMESTAMP NOT NULL,
+    blknum                   INTEGER NOT NULL PRIMARY KEY,
+    blkhash                  TEXT NOT NULL,
+    parent_hash              TEXT NOT NULL,
+    nonce                    TEXT NOT NULL,
+    sha3_uncles              TEXT NOT NULL,
+    logs_bloom               TEXT NOT NULL,
+    txs_root                 TEXT NOT NULL,
+    state_root               TEXT NOT NULL,
+    receipts_root            TEXT NOT NULL,
+    miner                    TEXT NOT NULL,
+    mix_hash                 TEXT NOT NULL,
+    difficulty               TEXT NOT NULL,
+    extra_data               TEXT NOT NULL,
+    gas_limit                INTEGER NOT NULL,
+    gas_used                 INTEGER NOT NULL,
+    base_fee_per_gas         TEXT,
+    withdrawals_root         TEXT,
+    blob_gas_used            INTEGER,
+    excess_blob_gas          INTEGER,
+    parent_beacon_block_root TEXT
+);
+
+CREATE TABLE IF NOT EXISTS {{chain}}.transactions (
+    blknum                   INTEGER NOT NULL,
+    txhash                   TEXT NOT NULL PRIMARY KEY,
+    txpos                    INTEGER NOT NULL,
+    tx_type                  INTEGER NOT NULL,
+    nonce                    INTEGER NOT NULL,
+    to_address               TEXT,
+    value                    TEXT NOT NULL,
+    gas                      INTEGER NOT NULL,
+    gas_price                TEXT,
+    max_fee_per_gas          TEXT,
+    max_priority_fee_per_gas TEXT,
+    input                    TEXT NOT NULL,
+    chain_id                 TEXT,
+    access_list              TEXT,
+    max_fee_per_blob_gas     TEXT,
+    blob_versioned_hashes    TEXT,
+    v                        TEXT NOT NULL,
+    r                        TEXT NOT NULL,
+    s                        TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.transactions_blknum_idx
+    ON transactions (blknum, txpos);
+
+CREATE TABLE IF NOT EXISTS {{chain}}.withdrawals (
+    blknum           INTEGER NOT NULL,
+    withdrawal_index INTEGER NOT NULL PRIMARY KEY,
+    validator_index  INTEGER NOT NULL,
+    address          TEXT NOT NULL,
+    amount           INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.withdrawals_blknum_idx
+    ON withdrawals (blknum, withdrawal_index);
+
+CREATE TABLE IF NOT EXISTS {{chain}}.traces (
+    block_timestamp TIMESTAMP,
+    blknum          INTEGER NOT NULL,
+    txhash          TEXT,
+    txpos           INTEGER,
+    from_address    TEXT,
+    to_address      TEXT,
+    value           TEXT,
+    input           TEXT,
+    output          TEXT,
+    trace_type      TEXT NOT NULL,
+    call_type       TEXT,
+    reward_type     TEXT,
+    gas             TEXT,
+    gas_used        INTEGER,
+    subtraces       INTEGER,
+    trace_address   TEXT,
+    error           TEXT
+);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.traces_blknum_idx
+    ON traces (blknum, txpos, trace_address);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.traces_txhash_idx
+    ON traces (txhash);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.traces_from_address_idx
+    ON traces (from_address, blknum, txpos, trace_address);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.traces_to_address_idx
+    ON traces (to_address, blknum, txpos, trace_address);
+
+CREATE TABLE IF NOT EXISTS {{chain}}.token_transfers (
+    blknum          INTEGER NOT NULL,
+    txhash          TEXT NOT NULL,
+    txpos           INTEGER NOT NULL,
+    logpos          INTEGER NOT NULL,
+    token_address   TEXT NOT NULL,
+    token_type      TEXT NOT NULL,
+    from_address    TEXT NOT NULL,
+    to_address      TEXT NOT NULL,
+    value           TEXT NOT NULL,
+    token_id        TEXT,
+    block_timestamp TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.token_transfers_blknum_idx
+    ON token_transfers (blknum, logpos);
+
+CREATE TABLE IF NOT EXISTS {{chain}}.logs (
+    blknum          INTEGER NOT NULL,
+    txhash          TEXT NOT NULL,
+    txpos           INTEGER NOT NULL,
+    logpos          INTEGER NOT NULL,
+    address         TEXT NOT NULL,
+    topics          TEXT NOT NULL,
+    data            TEXT NOT NULL,
+    block_timestamp TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.logs_blknum_idx
+    ON logs (blknum, logpos);
+
+-- Tables maintained by hdt itself, created by AutoMigrate on PostgreSQL.
+CREATE TABLE IF NOT EXISTS {{chain}}.hdt_progress (
+    name   TEXT NOT NULL PRIMARY KEY,
+    blknum INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS {{chain}}.balance_checkpoints (
+    address TEXT NOT NULL,
+    blknum  INTEGER NOT NULL,
+    delta   TEXT NOT NULL,
+    balance TEXT NOT NULL,
+    PRIMARY KEY (address, blknum)
+);
+
+CREATE TABLE IF NOT EXISTS {{chain}}.abis (
+    address    TEXT NOT NULL PRIMARY KEY,
+    name       TEXT,
+    abi        TEXT,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{chain}}.trace_quality_issues (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    blknum        INTEGER NOT NULL,
+    rule          TEXT NOT NULL,
+    txhash        TEXT,
+    trace_address TEXT,
+    detail        TEXT,
+    checked_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.trace_quality_issues_blknum_idx
+    ON trace_quality_issues (blknum);
+
+CREATE INDEX IF NOT EXISTS {{chain}}.trace_quality_issues_rule_idx
+    ON trace_quality_issues (rule);
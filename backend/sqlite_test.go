@@ -0,0 +1,234 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/fixtures"
+)
+
+// readTestFixture reads a bundled fixture. The tests of other packages use
+// upstreamtest, which can't be imported from here.
+func readTestFixture(t *testing.T, name string) *Fixture {
+	t.Helper()
+	r, err := fixtures.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	fixture, err := ReadFixture(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fixture
+}
+
+// newTestDevBackend creates a dev backend on the named fixture.
+func newTestDevBackend(t *testing.T, name string) (*mixinBackend, *Fixture) {
+	t.Helper()
+	fixture := readTestFixture(t, name)
+	b, err := NewDevBackend(context.Background(), &Config{Chain: fixture.Chain}, fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, fixture
+}
+
+func TestDevBackendBlocks(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		b, fixture = newTestDevBackend(t, "ethereum.json")
+	)
+	for _, want := range fixture.Blocks {
+		number := rpc.BlockNumber(want.Header.Number.Int64())
+		block, err := b.BlockByNumber(ctx, number)
+		if err != nil {
+			t.Fatalf("block %d: %v", number, err)
+		}
+		if block.Hash() != want.Header.Hash() {
+			t.Errorf("block %d: hash %s, want %s", number, block.Hash(), want.Header.Hash())
+		}
+		if len(block.Transactions()) != len(want.Transactions) {
+			t.Fatalf("block %d: %d transactions, want %d", number, len(block.Transactions()), len(want.Transactions))
+		}
+		for i, tx := range want.Transactions {
+			if block.Transactions()[i].Hash() != tx.Hash() {
+				t.Errorf("block %d: transaction %d hash mismatch", number, i)
+			}
+			_, n, timestamp, err := b.TransactionByHash(ctx, tx.Hash())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != uint64(number) || timestamp != want.Header.Time {
+				t.Errorf("transaction %s: block %d at %d, want %d at %d", tx.Hash(), n, timestamp, number, want.Header.Time)
+			}
+		}
+	}
+	last := fixture.Blocks[len(fixture.Blocks)-1].Header
+	head, err := b.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash() != last.Hash() {
+		t.Errorf("latest block %d, want %d", head.Number, last.Number)
+	}
+	if _, err := b.BlockReceipts(ctx, rpc.BlockNumber(last.Number.Int64())); !errors.Is(err, ErrOffline) {
+		t.Errorf("receipts: have %v, want %v", err, ErrOffline)
+	}
+}
+
+// TestDevBackendCancun reads back a block with a blob transaction and
+// withdrawals, which only hashes right with every Cancun field stored.
+func TestDevBackendCancun(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		b, fixture = newTestDevBackend(t, "cancun.json")
+		want       = fixture.Blocks[0]
+	)
+	block, err := b.BlockByNumber(ctx, rpc.BlockNumber(want.Header.Number.Int64()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Hash() != want.Header.Hash() {
+		t.Errorf("hash %s, want %s", block.Hash(), want.Header.Hash())
+	}
+	if len(block.Transactions()) != 1 || block.Transactions()[0].Hash() != want.Transactions[0].Hash() {
+		t.Fatalf("transactions %v, want the blob transaction", block.Transactions())
+	}
+	if tx := block.Transactions()[0]; tx.Type() != types.BlobTxType || len(tx.BlobHashes()) != 2 {
+		t.Errorf("transaction of type %d with %d blobs", tx.Type(), len(tx.BlobHashes()))
+	}
+	if !reflect.DeepEqual(block.Withdrawals(), types.Withdrawals(want.Withdrawals)) {
+		t.Errorf("withdrawals %v, want %v", block.Withdrawals(), want.Withdrawals)
+	}
+	tx, _, err := b.offlineTransaction(ctx, want.Transactions[0].Hash())
+	if err != nil || tx.Hash() != want.Transactions[0].Hash() {
+		t.Errorf("transaction by hash: %v", err)
+	}
+
+	// Blocks without their withdrawals don't pass for complete
+	if err := b.db.Table(b.table("withdrawals")).Where("withdrawal_index = ?", want.Withdrawals[1].Index).Delete(&Withdrawal{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.BlockByNumber(ctx, rpc.BlockNumber(want.Header.Number.Int64())); err == nil {
+		t.Error("block read without one of its withdrawals")
+	}
+}
+
+func TestDevBackendTraces(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		b, fixture = newTestDevBackend(t, "ethereum.json")
+	)
+	for _, block := range fixture.Blocks {
+		number := rpc.BlockNumber(block.Header.Number.Int64())
+		frames, err := b.TraceBlock(ctx, number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(frames) != len(block.Traces) {
+			t.Fatalf("block %d: %d frames, want %d", number, len(frames), len(block.Traces))
+		}
+		for i, want := range block.Traces {
+			have := frames[i]
+			if *have.BlockHash != block.Header.Hash() || *have.TransactionHash != *want.TransactionHash {
+				t.Errorf("block %d frame %d: hashes mismatch", number, i)
+			}
+			if !reflect.DeepEqual(have.TraceAddress, want.TraceAddress) {
+				t.Errorf("block %d frame %d: trace address %v, want %v", number, i, have.TraceAddress, want.TraceAddress)
+			}
+			// Every column survives the round trip through the tables
+			ts := time.Unix(int64(block.Header.Time), 0)
+			haveRow, _ := json.Marshal(have.AsTrace(ts))
+			wantRow, _ := json.Marshal(want.AsTrace(ts))
+			if string(haveRow) != string(wantRow) {
+				t.Errorf("block %d frame %d:\nhave %s\nwant %s", number, i, haveRow, wantRow)
+			}
+		}
+	}
+
+	// Reloading replaces the rows instead of duplicating them
+	if err := b.LoadFixture(ctx, fixture); err != nil {
+		t.Fatal(err)
+	}
+	tx := fixture.Blocks[1].Transactions[0]
+	frames, err := b.TraceTransaction(ctx, tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("have %d frames, want 3", len(frames))
+	}
+	if frames[2].RevertReason == nil {
+		t.Error("revert reason of the failed sub call not decoded")
+	}
+
+	top := true
+	to := common.HexToAddress("0x7a250d5630b4cf539739df2c5dacb4c659f2488d")
+	frames, _, err = b.FilterTraces(ctx, &TraceFilter{Address: &to, FromBlock: 0, ToBlock: 20000000, TopLevel: &top})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || *frames[0].TransactionHash != tx.Hash() {
+		t.Errorf("filtered %d frames, want the top-level call of %s", len(frames), tx.Hash())
+	}
+}
+
+func TestDevBackendBalances(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		b, _ = newTestDevBackend(t, "ethereum.json")
+		addr = common.HexToAddress("0xb0b0")
+		wei  = new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil) // Beyond int64
+	)
+	if err := b.WriteBalanceCheckpoints(ctx, 10, map[common.Address]*big.Int{addr: wei}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WriteBalanceCheckpoints(ctx, 20, map[common.Address]*big.Int{addr: big.NewInt(-1)}); err != nil {
+		t.Fatal(err)
+	}
+	balances, err := b.CheckpointBalances(ctx, []common.Address{addr}, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := new(big.Int).Sub(wei, big.NewInt(1)); balances[addr].Cmp(want) != 0 {
+		t.Errorf("balance %v, want %v", balances[addr], want)
+	}
+	head, ok, err := b.BalanceIndexHead(ctx)
+	if err != nil || !ok || head != 20 {
+		t.Errorf("index head %d %v %v, want 20", head, ok, err)
+	}
+}
+
+func TestDevBackendFile(t *testing.T) {
+	var (
+		ctx = context.Background()
+		cfg = &Config{Chain: "ethereum", DBDSN: SQLitePrefix + filepath.Join(t.TempDir(), "hdt.db")}
+	)
+	_, fixture := newTestDevBackend(t, "ethereum.json")
+	if _, err := NewDevBackend(ctx, cfg, fixture); err != nil {
+		t.Fatal(err)
+	}
+	// Reopening keeps the rows and migrates again without failing
+	b, err := NewDevBackend(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := b.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fixture.Blocks[len(fixture.Blocks)-1].Header.Hash(); header.Hash() != want {
+		t.Errorf("latest block %s, want %s", header.Hash(), want)
+	}
+}
@@ -0,0 +1,384 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Sources of the token transfers.
+const (
+	TokenSourceTable = "table" // The <chain>.token_transfers table
+	TokenSourceLogs  = "logs"  // Decoded on the fly from the <chain>.logs table
+)
+
+// Token standards.
+const (
+	TokenERC20   = "erc20"
+	TokenERC721  = "erc721"
+	TokenERC1155 = "erc1155"
+)
+
+var (
+	transferTopic       = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	transferSingleTopic = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	transferBatchTopic  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+)
+
+// TokenTransfer is a single ERC-20, ERC-721 or ERC-1155 token transfer. A
+// TransferBatch event yields one transfer per token id.
+type TokenTransfer struct {
+	BlockNumber         hexutil.Uint64  `json:"blockNumber"`
+	TransactionHash     common.Hash     `json:"transactionHash"`
+	TransactionPosition hexutil.Uint64  `json:"transactionPosition"`
+	LogIndex            hexutil.Uint64  `json:"logIndex"`
+	Token               common.Address  `json:"token"`
+	TokenType           string          `json:"tokenType"`
+	From                common.Address  `json:"from"`
+	To                  common.Address  `json:"to"`
+	Value               *hexutil.Big    `json:"value"`
+	TokenID             *hexutil.Big    `json:"tokenId,omitempty"`
+	Operator            *common.Address `json:"operator,omitempty"`
+}
+
+// TokenCursor is the position of a transfer in the (blknum, logpos) order,
+// Index counts the transfers of that log already returned.
+type TokenCursor struct {
+	BlockNumber uint64 `json:"b"`
+	LogIndex    uint64 `json:"l"`
+	Index       int    `json:"i"`
+}
+
+// TokenTransferFilter selects token transfers.
+type TokenTransferFilter struct {
+	Token           *common.Address // Only transfers of this token contract
+	Address         *common.Address // Only transfers sent from or to the address
+	Direction       Direction       // Side of the transfers the address is matched against
+	TransactionHash *common.Hash    // Only transfers of this transaction
+	FromBlock       uint64          // First block of the range (inclusive)
+	ToBlock         uint64          // Last block of the range (inclusive)
+	Descending      bool            // Newest transfers first
+	After           *TokenCursor    // Only transfers strictly after this position
+	Limit           int             // Maximum number of transfers to return, 0 for no limit
+}
+
+// tokenTransferRow is a row of the token_transfers table.
+type tokenTransferRow struct {
+	BlockNum        uint64           `gorm:"column:blknum"`
+	TransactionHash string           `gorm:"column:txhash"`
+	TransactionPos  uint64           `gorm:"column:txpos"`
+	LogPos          uint64           `gorm:"column:logpos"`
+	TokenAddress    string           `gorm:"column:token_address"`
+	TokenType       string           `gorm:"column:token_type"`
+	FromAddress     string           `gorm:"column:from_address"`
+	ToAddress       string           `gorm:"column:to_address"`
+	Value           decimal.Decimal  `gorm:"column:value"`
+	TokenID         *decimal.Decimal `gorm:"column:token_id"`
+}
+
+func (r *tokenTransferRow) transfer() *TokenTransfer {
+	t := &TokenTransfer{
+		BlockNumber:         hexutil.Uint64(r.BlockNum),
+		TransactionHash:     common.HexToHash(r.TransactionHash),
+		TransactionPosition: hexutil.Uint64(r.TransactionPos),
+		LogIndex:            hexutil.Uint64(r.LogPos),
+		Token:               common.HexToAddress(r.TokenAddress),
+		TokenType:           r.TokenType,
+		From:                common.HexToAddress(r.FromAddress),
+		To:                  common.HexToAddress(r.ToAddress),
+		Value:               (*hexutil.Big)(r.Value.BigInt()),
+	}
+	if r.TokenID != nil {
+		t.TokenID = (*hexutil.Big)(r.TokenID.BigInt())
+	}
+	return t
+}
+
+// logRow is a row of the logs table, topics are comma separated.
+type logRow struct {
+	BlockNum        uint64 `gorm:"column:blknum"`
+	TransactionHash string `gorm:"column:txhash"`
+	TransactionPos  uint64 `gorm:"column:txpos"`
+	LogPos          uint64 `gorm:"column:logpos"`
+	Address         string `gorm:"column:address"`
+	Topics          string `gorm:"column:topics"`
+	Data            string `gorm:"column:data"`
+}
+
+// transfers decodes the token transfers of a log, nil if it isn't one.
+func (r *logRow) transfers() []*TokenTransfer {
+	var topics []common.Hash
+	for _, topic := range strings.Split(r.Topics, ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, common.HexToHash(topic))
+		}
+	}
+	data, err := hexutil.Decode(r.Data)
+	if err != nil || len(topics) == 0 {
+		return nil
+	}
+	base := TokenTransfer{
+		BlockNumber:         hexutil.Uint64(r.BlockNum),
+		TransactionHash:     common.HexToHash(r.TransactionHash),
+		TransactionPosition: hexutil.Uint64(r.TransactionPos),
+		LogIndex:            hexutil.Uint64(r.LogPos),
+		Token:               common.HexToAddress(r.Address),
+	}
+	word := func(i int) *big.Int { return new(big.Int).SetBytes(data[32*i : 32*(i+1)]) }
+	switch {
+	case topics[0] == transferTopic && len(topics) == 3 && len(data) == 32:
+		t := base
+		t.TokenType, t.From, t.To = TokenERC20, common.BytesToAddress(topics[1][:]), common.BytesToAddress(topics[2][:])
+		t.Value = (*hexutil.Big)(word(0))
+		return []*TokenTransfer{&t}
+	case topics[0] == transferTopic && len(topics) == 4 && len(data) == 0:
+		t := base
+		t.TokenType, t.From, t.To = TokenERC721, common.BytesToAddress(topics[1][:]), common.BytesToAddress(topics[2][:])
+		t.Value = (*hexutil.Big)(big.NewInt(1))
+		t.TokenID = (*hexutil.Big)(new(big.Int).SetBytes(topics[3][:]))
+		return []*TokenTransfer{&t}
+	case topics[0] == transferSingleTopic && len(topics) == 4 && len(data) == 64:
+		t := base
+		operator := common.BytesToAddress(topics[1][:])
+		t.TokenType, t.Operator = TokenERC1155, &operator
+		t.From, t.To = common.BytesToAddress(topics[2][:]), common.BytesToAddress(topics[3][:])
+		t.TokenID, t.Value = (*hexutil.Big)(word(0)), (*hexutil.Big)(word(1))
+		return []*TokenTransfer{&t}
+	case topics[0] == transferBatchTopic && len(topics) == 4:
+		ids, values, err := decodeBatch(data)
+		if err != nil {
+			return nil
+		}
+		operator := common.BytesToAddress(topics[1][:])
+		transfers := make([]*TokenTransfer, len(ids))
+		for i := range ids {
+			t := base
+			t.TokenType, t.Operator = TokenERC1155, &operator
+			t.From, t.To = common.BytesToAddress(topics[2][:]), common.BytesToAddress(topics[3][:])
+			t.TokenID, t.Value = (*hexutil.Big)(ids[i]), (*hexutil.Big)(values[i])
+			transfers[i] = &t
+		}
+		return transfers
+	}
+	return nil
+}
+
+// decodeBatch decodes the (uint256[] ids, uint256[] values) data of a
+// TransferBatch event.
+func decodeBatch(data []byte) ([]*big.Int, []*big.Int, error) {
+	array := func(head int) ([]*big.Int, error) {
+		if len(data) < head+32 {
+			return nil, fmt.Errorf("short data")
+		}
+		offset := new(big.Int).SetBytes(data[head : head+32])
+		if !offset.IsInt64() || offset.Int64()+32 > int64(len(data)) {
+			return nil, fmt.Errorf("invalid offset")
+		}
+		start := int(offset.Int64())
+		length := new(big.Int).SetBytes(data[start : start+32])
+		if !length.IsInt64() || int64(start)+32+32*length.Int64() > int64(len(data)) {
+			return nil, fmt.Errorf("invalid length")
+		}
+		values := make([]*big.Int, length.Int64())
+		for i := range values {
+			pos := start + 32 + 32*i
+			values[i] = new(big.Int).SetBytes(data[pos : pos+32])
+		}
+		return values, nil
+	}
+	ids, err := array(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := array(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ids) != len(values) {
+		return nil, nil, fmt.Errorf("mismatching ids and values")
+	}
+	return ids, values, nil
+}
+
+// topicOf returns the address padded into a topic, as stored in the logs table.
+func topicOf(address common.Address) string {
+	return strings.ToLower(common.BytesToHash(address[:]).Hex())
+}
+
+func (b *mixinBackend) TokenTransfers(ctx context.Context, filter *TokenTransferFilter) ([]*TokenTransfer, *TokenCursor, error) {
+	var (
+		op, order = ">=", "ASC"
+		skip      int
+		sql       *gorm.DB
+		transfers []*TokenTransfer
+		resume    *TokenCursor
+	)
+	if filter.Descending {
+		op, order = "<=", "DESC"
+	}
+	if c := filter.After; c != nil {
+		skip = c.Index
+	}
+	switch b.tokenSource {
+	case TokenSourceLogs:
+		sql = b.tokenLogsQuery(ctx, filter)
+	default:
+		sql = b.tokenTableQuery(ctx, filter)
+	}
+	if c := filter.After; c != nil {
+		sql = sql.Where("(blknum, logpos) "+op+" (?, ?)", c.BlockNumber, c.LogIndex)
+	}
+	sql = sql.Order(fmt.Sprintf("blknum %s, logpos %s", order, order))
+
+	if b.tokenSource == TokenSourceLogs {
+		if filter.Limit > 0 {
+			// Every matching log holds at least one transfer
+			sql = sql.Limit(filter.Limit + 2)
+		}
+		var rows []logRow
+		if err := sql.Find(&rows).Error; err != nil {
+			return nil, nil, err
+		}
+		// Undecodable logs yield no transfers, so a page may come up short
+		// although more logs follow: then resume after the last fetched one.
+		if filter.Limit > 0 && len(rows) == filter.Limit+2 {
+			last := rows[len(rows)-1]
+			resume = &TokenCursor{BlockNumber: last.BlockNum, LogIndex: last.LogPos, Index: len(last.transfers())}
+		}
+		for i := range rows {
+			decoded := rows[i].transfers()
+			if filter.Descending {
+				for l, r := 0, len(decoded)-1; l < r; l, r = l+1, r-1 {
+					decoded[l], decoded[r] = decoded[r], decoded[l]
+				}
+			}
+			for _, t := range decoded {
+				if matchTransfer(t, filter) {
+					transfers = append(transfers, t)
+				}
+			}
+		}
+	} else {
+		if filter.Limit > 0 {
+			sql = sql.Limit(filter.Limit + 1 + skip)
+		}
+		if filter.Descending {
+			sql = sql.Order("token_id DESC")
+		} else {
+			sql = sql.Order("token_id ASC")
+		}
+		var rows []tokenTransferRow
+		if err := sql.Find(&rows).Error; err != nil {
+			return nil, nil, err
+		}
+		for i := range rows {
+			transfers = append(transfers, rows[i].transfer())
+		}
+	}
+	// Skip the transfers of the cursor's log returned by the previous page
+	if c := filter.After; c != nil {
+		n := 0
+		for n < len(transfers) && uint64(transfers[n].BlockNumber) == c.BlockNumber && uint64(transfers[n].LogIndex) == c.LogIndex {
+			n++
+		}
+		if n > skip {
+			n = skip
+		}
+		transfers = transfers[n:]
+	}
+	if filter.Limit <= 0 || len(transfers) <= filter.Limit {
+		return transfers, resume, nil
+	}
+	transfers = transfers[:filter.Limit]
+	last := transfers[len(transfers)-1]
+	cursor := &TokenCursor{BlockNumber: uint64(last.BlockNumber), LogIndex: uint64(last.LogIndex)}
+	for _, t := range transfers {
+		if t.BlockNumber == last.BlockNumber && t.LogIndex == last.LogIndex {
+			cursor.Index++
+		}
+	}
+	if filter.After != nil && cursor.BlockNumber == filter.After.BlockNumber && cursor.LogIndex == filter.After.LogIndex {
+		cursor.Index += skip
+	}
+	return transfers, cursor, nil
+}
+
+// matchTransfer applies the address filter to a decoded transfer, the logs
+// query only narrows it down to the candidate logs.
+func matchTransfer(t *TokenTransfer, filter *TokenTransferFilter) bool {
+	if filter.Address == nil {
+		return true
+	}
+	switch filter.Direction {
+	case DirectionFrom:
+		return t.From == *filter.Address
+	case DirectionTo:
+		return t.To == *filter.Address
+	default:
+		return t.From == *filter.Address || t.To == *filter.Address
+	}
+}
+
+func (b *mixinBackend) tokenTableQuery(ctx context.Context, filter *TokenTransferFilter) *gorm.DB {
+	sql := b.db.WithContext(ctx).Table(b.table("token_transfers")).
+		Where("blknum BETWEEN ? AND ?", filter.FromBlock, filter.ToBlock)
+	if filter.Token != nil {
+		sql = sql.Where("token_address = ?", addressHex(*filter.Token))
+	}
+	if filter.TransactionHash != nil {
+		sql = sql.Where("txhash = ?", filter.TransactionHash.Hex())
+	}
+	if filter.Address != nil {
+		addr := addressHex(*filter.Address)
+		switch filter.Direction {
+		case DirectionFrom:
+			sql = sql.Where("from_address = ?", addr)
+		case DirectionTo:
+			sql = sql.Where("to_address = ?", addr)
+		default:
+			sql = sql.Where("(from_address = ? OR to_address = ?)", addr, addr)
+		}
+	}
+	return sql
+}
+
+func (b *mixinBackend) tokenLogsQuery(ctx context.Context, filter *TokenTransferFilter) *gorm.DB {
+	var (
+		transfer = transferTopic.Hex()
+		multi    = []string{transferSingleTopic.Hex(), transferBatchTopic.Hex()}
+	)
+	sql := b.db.WithContext(ctx).Table(b.table("logs")).
+		Select("blknum, txhash, txpos, logpos, address, topics, data").
+		Where("blknum BETWEEN ? AND ?", filter.FromBlock, filter.ToBlock).
+		Where("split_part(topics, ',', 1) IN ?", append(multi, transfer))
+	if filter.Token != nil {
+		sql = sql.Where("address = ?", addressHex(*filter.Token))
+	}
+	if filter.TransactionHash != nil {
+		sql = sql.Where("txhash = ?", filter.TransactionHash.Hex())
+	}
+	if filter.Address != nil {
+		// ERC-20/721 index (from, to) as topics 1 and 2, ERC-1155 as 2 and 3
+		var (
+			topic = topicOf(*filter.Address)
+			from  = "((split_part(topics, ',', 1) = ? AND split_part(topics, ',', 2) = ?) OR (split_part(topics, ',', 1) IN ? AND split_part(topics, ',', 3) = ?))"
+			to    = "((split_part(topics, ',', 1) = ? AND split_part(topics, ',', 3) = ?) OR (split_part(topics, ',', 1) IN ? AND split_part(topics, ',', 4) = ?))"
+		)
+		switch filter.Direction {
+		case DirectionFrom:
+			sql = sql.Where(from, transfer, topic, multi, topic)
+		case DirectionTo:
+			sql = sql.Where(to, transfer, topic, multi, topic)
+		default:
+			sql = sql.Where("("+from+" OR "+to+")", transfer, topic, multi, topic, transfer, topic, multi, topic)
+		}
+	}
+	return sql
+}
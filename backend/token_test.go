@@ -0,0 +1,182 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func word(v uint64) string {
+	return common.BigToHash(new(big.Int).SetUint64(v)).Hex()[2:]
+}
+
+// topic pads the address into an indexed event argument.
+func topic(addr common.Address) common.Hash {
+	return common.BytesToHash(addr.Bytes())
+}
+
+func TestLogTransfers(t *testing.T) {
+	var (
+		token    = "0x00000000000000000000000000000000000000aa"
+		from     = common.HexToAddress("0xbb")
+		to       = common.HexToAddress("0xcc")
+		operator = common.HexToAddress("0xdd")
+	)
+	topics := func(hashes ...common.Hash) string {
+		s := make([]string, len(hashes))
+		for i, h := range hashes {
+			s[i] = h.Hex()
+		}
+		return strings.Join(s, ",")
+	}
+	tests := []struct {
+		row    logRow
+		typ    string
+		ids    []uint64
+		values []uint64
+	}{
+		{
+			row: logRow{Topics: topics(transferTopic, topic(from), topic(to)), Data: "0x" + word(1000)},
+			typ: TokenERC20, values: []uint64{1000},
+		},
+		{
+			row: logRow{Topics: topics(transferTopic, topic(from), topic(to), common.BigToHash(big.NewInt(7))), Data: "0x"},
+			typ: TokenERC721, ids: []uint64{7}, values: []uint64{1},
+		},
+		{
+			row: logRow{Topics: topics(transferSingleTopic, topic(operator), topic(from), topic(to)), Data: "0x" + word(3) + word(5)},
+			typ: TokenERC1155, ids: []uint64{3}, values: []uint64{5},
+		},
+		{
+			row: logRow{
+				Topics: topics(transferBatchTopic, topic(operator), topic(from), topic(to)),
+				Data:   "0x" + word(64) + word(160) + word(2) + word(1) + word(2) + word(2) + word(10) + word(20),
+			},
+			typ: TokenERC1155, ids: []uint64{1, 2}, values: []uint64{10, 20},
+		},
+	}
+	for i, tt := range tests {
+		tt.row.Address = token
+		transfers := tt.row.transfers()
+		if len(transfers) != len(tt.values) {
+			t.Fatalf("test %d: have %d transfers, want %d", i, len(transfers), len(tt.values))
+		}
+		for j, tr := range transfers {
+			if tr.TokenType != tt.typ || tr.From != from || tr.To != to || tr.Token != common.HexToAddress(token) {
+				t.Errorf("test %d: unexpected transfer %+v", i, tr)
+			}
+			if tr.Value.ToInt().Uint64() != tt.values[j] {
+				t.Errorf("test %d: have value %v, want %d", i, tr.Value, tt.values[j])
+			}
+			if tt.ids != nil && (tr.TokenID == nil || tr.TokenID.ToInt().Uint64() != tt.ids[j]) {
+				t.Errorf("test %d: have token id %v, want %d", i, tr.TokenID, tt.ids[j])
+			}
+		}
+	}
+	// Logs of other events sharing the topic layout are ignored
+	if got := (&logRow{Topics: topics(transferTopic, topic(from)), Data: hexutil.Encode(nil)}).transfers(); got != nil {
+		t.Errorf("unexpected transfers %v", got)
+	}
+}
+
+// TestTokenTransfersPages pages through the same transfers stored in the
+// logs and in the token_transfers table, one of the logs holding a batch of
+// three transfers which a page boundary splits.
+func TestTokenTransfersPages(t *testing.T) {
+	var (
+		token    = common.HexToAddress("0xaa")
+		alice    = common.HexToAddress("0xbb")
+		bob      = common.HexToAddress("0xcc")
+		operator = common.HexToAddress("0xdd")
+		other    = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+	)
+	topics := func(hashes ...common.Hash) string {
+		s := make([]string, len(hashes))
+		for i, h := range hashes {
+			s[i] = strings.ToLower(h.Hex())
+		}
+		return strings.Join(s, ",")
+	}
+	logs := []logRow{
+		{BlockNum: 10, LogPos: 0, Topics: topics(transferTopic, topic(alice), topic(bob)), Data: "0x" + word(1)},
+		{BlockNum: 10, LogPos: 1, Topics: topics(transferBatchTopic, topic(operator), topic(alice), topic(bob)),
+			Data: "0x" + word(64) + word(192) + word(3) + word(1) + word(2) + word(3) + word(3) + word(10) + word(20) + word(30)},
+		{BlockNum: 11, LogPos: 0, Topics: topics(other, topic(alice), topic(bob)), Data: "0x" + word(5)},
+		{BlockNum: 11, LogPos: 2, Topics: topics(transferTopic, topic(bob), topic(alice), common.BigToHash(big.NewInt(7))), Data: "0x"},
+		{BlockNum: 12, LogPos: 0, Topics: topics(transferTopic, topic(alice), topic(bob)), Data: "0x" + word(2)},
+	}
+	for _, source := range []string{TokenSourceLogs, TokenSourceTable} {
+		b, err := NewDevBackend(context.Background(), &Config{Chain: "ethereum", TokenSource: source})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range logs {
+			row := logs[i]
+			row.TransactionHash = common.BigToHash(big.NewInt(int64(row.BlockNum))).Hex()
+			row.Address = addressHex(token)
+			if err := b.db.Table(b.table("logs")).Create(&row).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, tr := range row.transfers() {
+				transfer := map[string]interface{}{
+					"blknum": row.BlockNum, "txhash": row.TransactionHash, "txpos": 0, "logpos": row.LogPos,
+					"token_address": row.Address, "token_type": tr.TokenType,
+					"from_address": addressHex(tr.From), "to_address": addressHex(tr.To), "value": tr.Value.ToInt().String(),
+				}
+				if tr.TokenID != nil {
+					transfer["token_id"] = tr.TokenID.ToInt().String()
+				}
+				if err := b.db.Table(b.table("token_transfers")).Create(transfer).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		for _, descending := range []bool{false, true} {
+			for _, address := range []*common.Address{nil, &bob} {
+				name := fmt.Sprintf("%s descending=%v address=%v", source, descending, address)
+				filter := &TokenTransferFilter{Address: address, Direction: DirectionFrom, FromBlock: 0, ToBlock: 100, Descending: descending}
+				all, cursor, err := b.TokenTransfers(context.Background(), filter)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				want := 6
+				if address != nil {
+					want = 1
+				}
+				if len(all) != want || cursor != nil {
+					t.Fatalf("%s: have %d transfers and cursor %v, want %d", name, len(all), cursor, want)
+				}
+				var paged []*TokenTransfer
+				for page := 0; ; page++ {
+					if page > len(all) {
+						t.Fatalf("%s: no end of pages", name)
+					}
+					filter.Limit = 2
+					transfers, next, err := b.TokenTransfers(context.Background(), filter)
+					if err != nil {
+						t.Fatalf("%s: %v", name, err)
+					}
+					paged = append(paged, transfers...)
+					if next == nil {
+						break
+					}
+					filter.After = next
+				}
+				if len(paged) != len(all) {
+					t.Fatalf("%s: have %d paged transfers, want %d", name, len(paged), len(all))
+				}
+				for i := range all {
+					if have, want := paged[i], all[i]; have.BlockNumber != want.BlockNumber || have.LogIndex != want.LogIndex || have.Value.ToInt().Cmp(want.Value.ToInt()) != 0 {
+						t.Errorf("%s: transfer %d: have %d/%d %v, want %d/%d %v", name, i, have.BlockNumber, have.LogIndex, have.Value, want.BlockNumber, want.LogIndex, want.Value)
+					}
+				}
+			}
+		}
+	}
+}
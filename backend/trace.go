@@ -15,16 +15,44 @@ import (
 )
 
 type CallFrame struct {
-	Action              CallAction   `json:"action"`
-	BlockHash           *common.Hash `json:"blockHash,omitempty"`
-	BlockNumber         uint64       `json:"blockNumber"`
-	Error               string       `json:"error,omitempty"`
-	Result              *CallResult  `json:"result,omitempty"`
-	Subtraces           int          `json:"subtraces"`
-	TraceAddress        []int        `json:"traceAddress"`
-	TransactionHash     *common.Hash `json:"transactionHash"`
-	TransactionPosition uint64       `json:"transactionPosition"`
-	Type                string       `json:"type"`
+	Action              CallAction    `json:"action"`
+	BlockHash           *common.Hash  `json:"blockHash,omitempty"`
+	BlockNumber         uint64        `json:"blockNumber"`
+	Error               string        `json:"error,omitempty"`
+	Result              *CallResult   `json:"result,omitempty"`
+	Subtraces           int           `json:"subtraces"`
+	TraceAddress        []int         `json:"traceAddress"`
+	TransactionHash     *common.Hash  `json:"transactionHash"`
+	TransactionPosition uint64        `json:"transactionPosition"`
+	Type                string        `json:"type"`
+	Decoded             *DecodedCall  `json:"decoded,omitempty"`
+	RevertReason        *RevertReason `json:"revertReason,omitempty"`
+}
+
+// CompareTraceAddress orders trace addresses depth-first, a frame before its
+// subcalls, returning -1, 0 or +1.
+func CompareTraceAddress(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// isRevert reports whether the error is a revert, as named by geth and by
+// parity style tracers.
+func isRevert(err string) bool {
+	return err == vm.ErrExecutionReverted.Error() || err == "Reverted"
 }
 
 type CallAction struct {
@@ -211,6 +239,28 @@ type Trace struct {
 	// Status          int              `json:"status" gorm:"column:status" example:"0"`
 }
 
+// ParseTraceAddress parses the text form of a trace address, e.g. "[0, 2]".
+// Unparsable positions are returned as zero along with the error.
+func ParseTraceAddress(s string) ([]int, error) {
+	s = strings.NewReplacer("[", "", "]", "", " ", "").Replace(s)
+	if s == "" {
+		return []int{}, nil
+	}
+	var (
+		parts   = strings.Split(s, ",")
+		address = make([]int, len(parts))
+		err     error
+	)
+	for i, part := range parts {
+		pos, e := strconv.Atoi(part)
+		if e != nil && err == nil {
+			err = e
+		}
+		address[i] = pos
+	}
+	return address, err
+}
+
 func (t *Trace) AsCallFrame() *CallFrame {
 	// common fields
 	var txHash common.Hash
@@ -226,24 +276,11 @@ func (t *Trace) AsCallFrame() *CallFrame {
 		Type:                t.TraceType,
 	}
 
-	traceAddress := t.TraceAddress
-	traceAddress = strings.ReplaceAll(traceAddress, "[", "")
-	traceAddress = strings.ReplaceAll(traceAddress, "]", "")
-	traceAddress = strings.ReplaceAll(traceAddress, " ", "")
-	if traceAddress == "" {
-		frame.TraceAddress = []int{}
-	} else {
-		traceAddresses := strings.Split(traceAddress, ",")
-		traceIntAddresses := make([]int, len(traceAddresses))
-		for i, s := range traceAddresses {
-			pos, e := strconv.Atoi(s)
-			if e != nil {
-				log.Error("failed to parse traceAddress", "s", s, "e", e)
-			}
-			traceIntAddresses[i] = pos
-		}
-		frame.TraceAddress = traceIntAddresses
+	traceAddress, err := ParseTraceAddress(t.TraceAddress)
+	if err != nil {
+		log.Error("failed to parse traceAddress", "s", t.TraceAddress, "e", err)
 	}
+	frame.TraceAddress = traceAddress
 
 	var (
 		from      common.Address
@@ -263,10 +300,11 @@ func (t *Trace) AsCallFrame() *CallFrame {
 		gas := uint64(t.Gas.BigInt().Int64())
 		gasUsed := t.GasUsed
 		frame.Action = CallAction{
-			From:  &from,
-			Gas:   &gas,
-			Value: t.Value.BigInt(),
-			Init:  &input,
+			From:           &from,
+			Gas:            &gas,
+			Value:          t.Value.BigInt(),
+			Init:           &input,
+			CreationMethod: strings.ToLower(t.TraceType),
 		}
 		frame.Result = &CallResult{
 			GasUsed: &gasUsed,
@@ -294,15 +332,126 @@ func (t *Trace) AsCallFrame() *CallFrame {
 			GasUsed: &gasUsed,
 			Output:  &output,
 		}
+	case "REWARD":
+		frame.Action = CallAction{
+			Author:     &to,
+			Value:      t.Value.BigInt(),
+			RewardType: t.RewardType,
+		}
+	case "GENESIS", "DAOFORK":
+		// Irregular state changes exported as traces: the genesis allocation
+		// credits the to address, the DAO fork moves the drained balances.
+		frame.Action = CallAction{
+			To:    &to,
+			Value: t.Value.BigInt(),
+		}
+		if t.FromAddress != nil {
+			frame.Action.From = &from
+		}
 	default:
 		log.Error("unrecognized call frame", "traceType", t.TraceType)
 	}
 
 	// Revert output contains useful information (revert reason).
 	// Otherwise discard result.
-	if t.Error != "" && t.Error != vm.ErrExecutionReverted.Error() {
+	if isRevert(t.Error) {
+		frame.RevertReason = DecodeRevert(output)
+	} else if t.Error != "" {
 		frame.Result = nil
 	}
 
 	return frame
 }
+
+// FormatTraceAddress formats a trace address in the text form of the traces
+// table, e.g. "[0, 2]".
+func FormatTraceAddress(address []int) string {
+	parts := make([]string, len(address))
+	for i, pos := range address {
+		parts[i] = strconv.Itoa(pos)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// bigDecimal converts an amount into a column value, absent amounts are zero.
+func bigDecimal(v *big.Int) *decimal.Decimal {
+	d := decimal.Zero
+	if v != nil {
+		d = decimal.NewFromBigInt(v, 0)
+	}
+	return &d
+}
+
+// AsTrace converts the frame into a row of the traces table, the inverse of
+// AsCallFrame.
+func (f *CallFrame) AsTrace(timestamp time.Time) *Trace {
+	t := &Trace{
+		Timestamp:      timestamp,
+		BlockNum:       f.BlockNumber,
+		TransactionPos: f.TransactionPosition,
+		TraceType:      f.Type,
+		SubTraces:      f.Subtraces,
+		TraceAddress:   FormatTraceAddress(f.TraceAddress),
+		Error:          f.Error,
+		Input:          "0x",
+		Output:         "0x",
+	}
+	if f.TransactionHash != nil && *f.TransactionHash != (common.Hash{}) {
+		hash := f.TransactionHash.Hex()
+		t.TransactionHash = &hash
+	}
+	address := func(addr *common.Address) *string {
+		if addr == nil {
+			return nil
+		}
+		hex := addressHex(*addr)
+		return &hex
+	}
+	bytes := func(b *[]byte) string {
+		if b == nil {
+			return "0x"
+		}
+		return hexutil.Encode(*b)
+	}
+	action, result := &f.Action, f.Result
+	if result == nil {
+		result = new(CallResult)
+	}
+	if action.Gas != nil {
+		t.Gas = bigDecimal(new(big.Int).SetUint64(*action.Gas))
+	}
+	if result.GasUsed != nil {
+		t.GasUsed = *result.GasUsed
+	}
+	switch strings.ToUpper(f.Type) {
+	case vm.CREATE.String(), vm.CREATE2.String():
+		if action.CreationMethod != "" {
+			t.TraceType = action.CreationMethod
+		}
+		t.FromAddress, t.ToAddress = address(action.From), address(result.Address)
+		t.Value = bigDecimal(action.Value)
+		t.Input, t.Output = bytes(action.Init), bytes(result.Code)
+		if t.Gas == nil {
+			t.Gas = bigDecimal(nil)
+		}
+	case vm.SELFDESTRUCT.String(), "SUICIDE":
+		t.FromAddress, t.ToAddress = address(action.SelfDestructed), address(action.RefundAddress)
+		t.Value = bigDecimal(action.Balance)
+	case "REWARD":
+		t.ToAddress = address(action.Author)
+		t.Value = bigDecimal(action.Value)
+		t.RewardType = action.RewardType
+	case "GENESIS", "DAOFORK":
+		t.FromAddress, t.ToAddress = address(action.From), address(action.To)
+		t.Value = bigDecimal(action.Value)
+	default:
+		t.FromAddress, t.ToAddress = address(action.From), address(action.To)
+		t.Value = bigDecimal(action.Value)
+		t.Input, t.Output = bytes(action.Input), bytes(result.Output)
+		t.CallType = action.CallType
+		if t.Gas == nil {
+			t.Gas = bigDecimal(nil)
+		}
+	}
+	return t
+}
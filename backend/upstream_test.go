@@ -0,0 +1,120 @@
+package backend_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+// newUpstreamBackend creates an online backend on the fake upstream, the
+// tables on SQLite, both serving the bundled fixture.
+func newUpstreamBackend(t *testing.T) (backend.Backend, *upstreamtest.Server, *backend.Fixture) {
+	t.Helper()
+	fixture := upstreamtest.Fixture(t, "ethereum.json")
+	upstream := upstreamtest.NewServer(fixture)
+	t.Cleanup(upstream.Close)
+	return upstreamtest.NewBackend(t, upstream, fixture.Chain, fixture), upstream, fixture
+}
+
+func TestUpstreamHeaderCache(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		b, upstream, fixture = newUpstreamBackend(t)
+		number               = rpc.BlockNumber(fixture.Blocks[0].Header.Number.Int64())
+	)
+	for i := 0; i < 3; i++ {
+		header, err := b.HeaderByNumber(ctx, number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Hash() != fixture.Blocks[0].Header.Hash() {
+			t.Fatalf("header %s, want %s", header.Hash(), fixture.Blocks[0].Header.Hash())
+		}
+	}
+	if n := upstream.Calls("eth_getBlockByNumber"); n != 1 {
+		t.Errorf("fetched the header %d times, want once", n)
+	}
+
+	// Tags aren't cached, the head moves
+	for i := 0; i < 2; i++ {
+		if _, err := b.HeaderByNumber(ctx, rpc.LatestBlockNumber); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := upstream.Calls("eth_getBlockByNumber"); n != 3 {
+		t.Errorf("fetched %d headers, want 3", n)
+	}
+}
+
+func TestUpstreamTransactionTraces(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		b, upstream, fixture = newUpstreamBackend(t)
+		block                = fixture.Blocks[1]
+		tx                   = block.Transactions[1]
+	)
+	_, number, timestamp, err := b.TransactionByHash(ctx, tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != block.Header.Number.Uint64() || timestamp != block.Header.Time {
+		t.Errorf("transaction at block %d time %d, want %d time %d", number, timestamp, block.Header.Number, block.Header.Time)
+	}
+	frames, err := b.TraceTransaction(ctx, tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0].Type != "create" || *frames[0].BlockHash != block.Header.Hash() {
+		t.Errorf("traced %d frames, want the creation of %s", len(frames), tx.Hash())
+	}
+
+	// Upstream failures surface to the caller
+	upstream.Fail("eth_getTransactionByHash", 1, &upstreamtest.Error{Code: -32000, Message: "header not found"})
+	if _, _, _, err := b.TransactionByHash(ctx, tx.Hash()); err == nil || err.Error() != "header not found" {
+		t.Errorf("have %v, want the upstream error", err)
+	}
+}
+
+func TestUpstreamReceiptsFallback(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		b, upstream, fixture = newUpstreamBackend(t)
+		block                = fixture.Blocks[1]
+	)
+	// No eth_getBlockReceipts upstream, receipts are collected one by one
+	upstream.Handle("eth_getTransactionReceipt", func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		var hash common.Hash
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return nil, err
+		}
+		return &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: hash, Logs: []*types.Log{}}, nil
+	})
+	receipts, err := b.BlockReceipts(ctx, rpc.BlockNumber(block.Header.Number.Int64()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != len(block.Transactions) {
+		t.Fatalf("have %d receipts, want %d", len(receipts), len(block.Transactions))
+	}
+	for i, tx := range block.Transactions {
+		if receipts[i].TxHash != tx.Hash() {
+			t.Errorf("receipt %d of %s, want %s", i, receipts[i].TxHash, tx.Hash())
+		}
+	}
+	if n := upstream.Calls("eth_getBlockReceipts"); n != 1 {
+		t.Errorf("tried eth_getBlockReceipts %d times, want once", n)
+	}
+
+	upstream.Fail("eth_getTransactionReceipt", -1, errors.New("unavailable"))
+	if _, err := b.BlockReceipts(ctx, rpc.BlockNumber(block.Header.Number.Int64())); err == nil {
+		t.Error("receipts served while the upstream fails")
+	}
+}
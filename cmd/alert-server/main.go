@@ -13,6 +13,7 @@ import (
 
 	"github.com/jsvisa/hdt/pkg/db"
 	"github.com/jsvisa/hdt/pkg/handlers"
+	"github.com/jsvisa/hdt/pkg/logging"
 )
 
 var app = cli.NewApp()
@@ -43,6 +44,7 @@ var (
 func init() {
 	// Initialize the CLI app and start web server
 	app.Action = run
+	app.Before = logging.Setup
 	app.Flags = []cli.Flag{
 		utils.HTTPListenAddrFlag,
 		utils.HTTPPortFlag,
@@ -51,6 +53,7 @@ func init() {
 		slackChannelFlag,
 		slackSeverityFlag,
 	}
+	app.Flags = append(app.Flags, logging.Flags...)
 }
 
 func main() {
@@ -68,9 +71,14 @@ func run(ctx *cli.Context) error {
 		return fmt.Errorf("invalid command: %q", args[0])
 	}
 
-	DB := db.Init(ctx.String(upstreamDBDSNFlag.Name))
+	dbLogger, err := logging.DBLogger(ctx)
+	if err != nil {
+		return err
+	}
+	DB := db.Init(ctx.String(upstreamDBDSNFlag.Name), dbLogger)
 	h := handlers.New(DB, ctx.String(slackWebhookURLFlag.Name), ctx.String(slackChannelFlag.Name), ctx.String(slackSeverityFlag.Name))
 	router := mux.NewRouter()
+	router.Use(logging.Handler)
 
 	router.HandleFunc("/webhook/alerts", h.AddAlert).Methods(http.MethodPost)
 
@@ -79,13 +87,3 @@ func run(ctx *cli.Context) error {
 	http.ListenAndServe(addr, router)
 	return nil
 }
-
-var (
-	glogger *log.GlogHandler
-)
-
-func init() {
-	glogger = log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
-	glogger.Verbosity(log.LvlInfo)
-	log.Root().SetHandler(glogger)
-}
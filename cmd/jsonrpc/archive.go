@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/urfave/cli/v2"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/archive"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+// importBatch is the number of archived rows inserted per statement.
+const importBatch = 1000
+
+var (
+	archiveDirFlag = &cli.StringFlag{
+		Name:     "dir",
+		Usage:    "Directory of the archive",
+		Required: true,
+	}
+	archiveFormatFlag = &cli.StringFlag{
+		Name:  "format",
+		Usage: "Archive file format: jsonl (zstd compressed) or parquet",
+		Value: archive.FormatJSONL,
+	}
+	archiveKindFlag = &cli.StringFlag{
+		Name:  "kind",
+		Usage: "Archive contents: rows of the traces table (importable) or frames as served by trace_block",
+		Value: archive.KindRows,
+	}
+	archiveBlocksFlag = &cli.Uint64Flag{
+		Name:  "blocks-per-file",
+		Usage: "Number of blocks per archive file",
+		Value: 1000,
+	}
+	exportCommand = &cli.Command{
+		Action: exportTraces,
+		Name:   "export",
+		Usage:  "Export the traces of a block range into an archive with a checksummed manifest",
+		Flags: []cli.Flag{
+			chainFlag,
+			upstreamJSONRPCFlag,
+			upstreamDBDSNFlag,
+			traceSchemaFlag,
+			offlineFlag,
+			fromBlockFlag,
+			toBlockFlag,
+			archiveDirFlag,
+			archiveFormatFlag,
+			archiveKindFlag,
+			archiveBlocksFlag,
+		},
+	}
+	importCommand = &cli.Command{
+		Action: importTraces,
+		Name:   "import",
+		Usage:  "Import an archive of rows into the traces table, replacing the block ranges it covers",
+		Flags: []cli.Flag{
+			chainFlag,
+			upstreamDBDSNFlag,
+			traceSchemaFlag,
+			archiveDirFlag,
+		},
+	}
+)
+
+func exportTraces(ctx *cli.Context) error {
+	from, to := ctx.Uint64(fromBlockFlag.Name), ctx.Uint64(toBlockFlag.Name)
+	if from > to {
+		return fmt.Errorf("--%s is after --%s", fromBlockFlag.Name, toBlockFlag.Name)
+	}
+	manifest, err := archive.NewManifest(ctx.String(chainFlag.Name), ctx.String(archiveKindFlag.Name), ctx.String(archiveFormatFlag.Name), from, to, ctx.Uint64(archiveBlocksFlag.Name))
+	if err != nil {
+		return err
+	}
+	dir := ctx.String(archiveDirFlag.Name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	dbLogger, err := logging.DBLogger(ctx)
+	if err != nil {
+		return err
+	}
+	schema, err := traceSchema(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := backend.NewMixinBackend(context.Background(), &backend.Config{
+		Chain:       ctx.String(chainFlag.Name),
+		Upstream:    ctx.String(upstreamJSONRPCFlag.Name),
+		DBDSN:       ctx.String(upstreamDBDSNFlag.Name),
+		DBLogger:    dbLogger,
+		TraceSchema: schema,
+		Offline:     ctx.Bool(offlineFlag.Name),
+	})
+	if err != nil {
+		return err
+	}
+	for start := from; start <= to; start += manifest.BlocksPerFile {
+		end := start + manifest.BlocksPerFile - 1
+		if end > to || end < start {
+			end = to
+		}
+		w, err := archive.NewFileWriter(dir, manifest, start, end)
+		if err != nil {
+			return err
+		}
+		if manifest.Kind == archive.KindRows {
+			err = b.ScanTraces(ctx.Context, start, end, w.WriteRow)
+		} else {
+			// Frames carry the block hashes, resolved block by block
+			for number := start; number <= end && err == nil; number++ {
+				var frames []*backend.CallFrame
+				if frames, err = b.TraceBlock(ctx.Context, rpc.BlockNumber(number)); err != nil {
+					break
+				}
+				for _, frame := range frames {
+					if err = w.WriteFrame(frame); err != nil {
+						break
+					}
+				}
+			}
+		}
+		if err != nil {
+			w.Close()
+			return fmt.Errorf("blocks %d-%d: %w", start, end, err)
+		}
+		file, err := w.Close()
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, file)
+		log.Info("Exported traces", "from", start, "to", end, "rows", file.Rows, "file", file.Name)
+		if end == to {
+			break
+		}
+	}
+	return manifest.Write(dir)
+}
+
+func importTraces(ctx *cli.Context) error {
+	dir := ctx.String(archiveDirFlag.Name)
+	manifest, err := archive.ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+	if manifest.Kind != archive.KindRows {
+		return fmt.Errorf("only archives of %s can be imported, not %s", archive.KindRows, manifest.Kind)
+	}
+	if chain := ctx.String(chainFlag.Name); manifest.Chain != chain {
+		return fmt.Errorf("archive of chain %s, importing into %s", manifest.Chain, chain)
+	}
+	// Check every file before touching the table
+	for _, file := range manifest.Files {
+		if err := archive.Verify(dir, file); err != nil {
+			return err
+		}
+	}
+	dbLogger, err := logging.DBLogger(ctx)
+	if err != nil {
+		return err
+	}
+	schema, err := traceSchema(ctx)
+	if err != nil {
+		return err
+	}
+	// Importing only needs the database
+	b, err := backend.NewMixinBackend(context.Background(), &backend.Config{
+		Chain:       ctx.String(chainFlag.Name),
+		DBDSN:       ctx.String(upstreamDBDSNFlag.Name),
+		DBLogger:    dbLogger,
+		TraceSchema: schema,
+		Offline:     true,
+	})
+	if err != nil {
+		return err
+	}
+	for _, file := range manifest.Files {
+		r, err := archive.NewRowReader(dir, manifest, file)
+		if err != nil {
+			return err
+		}
+		err = b.ReplaceTraces(ctx.Context, file.FromBlock, file.ToBlock, func() ([]backend.Trace, error) {
+			rows, err := r.Read(importBatch)
+			if err == io.EOF {
+				return nil, nil
+			}
+			return rows, err
+		})
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name, err)
+		}
+		log.Info("Imported traces", "from", file.FromBlock, "to", file.ToBlock, "rows", file.Rows)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/cli/v2"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+	"github.com/jsvisa/hdt/service/decoder"
+	"github.com/jsvisa/hdt/service/hdt"
+)
+
+var (
+	calltreeFormatFlag = &cli.StringFlag{
+		Name:  "format",
+		Usage: "Output format (text, dot, mermaid or json)",
+		Value: hdt.FormatText,
+	}
+	calltreeCommand = &cli.Command{
+		Action:    calltree,
+		Name:      "calltree",
+		Usage:     "Render the call tree of a transaction",
+		ArgsUsage: "<txhash>",
+		Flags: []cli.Flag{
+			chainFlag,
+			upstreamJSONRPCFlag,
+			upstreamDBDSNFlag,
+			traceSchemaFlag,
+			offlineFlag,
+			abiDirFlag,
+			abiSignaturesFlag,
+			calltreeFormatFlag,
+		},
+	}
+)
+
+func calltree(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("expected a transaction hash")
+	}
+	arg := ctx.Args().First()
+	if len(arg) != 2+2*common.HashLength || !strings.HasPrefix(arg, "0x") {
+		return fmt.Errorf("invalid transaction hash %q", arg)
+	}
+	dbLogger, err := logging.DBLogger(ctx)
+	if err != nil {
+		return err
+	}
+	schema, err := traceSchema(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := backend.NewMixinBackend(context.Background(), &backend.Config{
+		Chain:       ctx.String(chainFlag.Name),
+		Upstream:    ctx.String(upstreamJSONRPCFlag.Name),
+		DBDSN:       ctx.String(upstreamDBDSNFlag.Name),
+		DBLogger:    dbLogger,
+		TraceSchema: schema,
+		Offline:     ctx.Bool(offlineFlag.Name),
+	})
+	if err != nil {
+		return err
+	}
+	abiDecoder, err := newDecoder(ctx, b, decoder.NewDBRegistry(b))
+	if err != nil {
+		return err
+	}
+	tree, err := hdt.NewAPI(b, abiDecoder).GetCallTree(ctx.Context, common.HexToHash(arg))
+	if err != nil {
+		return err
+	}
+	switch format := strings.ToLower(ctx.String(calltreeFormatFlag.Name)); format {
+	case hdt.FormatText:
+		fmt.Print(tree.Text())
+	case hdt.FormatDOT:
+		fmt.Print(tree.DOT())
+	case hdt.FormatMermaid:
+		fmt.Print(tree.Mermaid())
+	case hdt.FormatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tree)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+	"github.com/jsvisa/hdt/service/verify"
+)
+
+// checkBatch is the number of blocks loaded and checked at once.
+const checkBatch = 100
+
+var checkCommand = &cli.Command{
+	Action: checkTraces,
+	Name:   "check",
+	Usage:  "Check the structural invariants of the traces table over a block range, exits non-zero on issues",
+	Flags: []cli.Flag{
+		chainFlag,
+		upstreamJSONRPCFlag,
+		upstreamDBDSNFlag,
+		traceSchemaFlag,
+		offlineFlag,
+		fromBlockFlag,
+		toBlockFlag,
+	},
+}
+
+func checkTraces(ctx *cli.Context) error {
+	from, to := ctx.Uint64(fromBlockFlag.Name), ctx.Uint64(toBlockFlag.Name)
+	if from > to {
+		return fmt.Errorf("--%s is after --%s", fromBlockFlag.Name, toBlockFlag.Name)
+	}
+	dbLogger, err := logging.DBLogger(ctx)
+	if err != nil {
+		return err
+	}
+	schema, err := traceSchema(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := backend.NewMixinBackend(context.Background(), &backend.Config{
+		Chain:       ctx.String(chainFlag.Name),
+		Upstream:    ctx.String(upstreamJSONRPCFlag.Name),
+		DBDSN:       ctx.String(upstreamDBDSNFlag.Name),
+		DBLogger:    dbLogger,
+		TraceSchema: schema,
+		Offline:     ctx.Bool(offlineFlag.Name),
+	})
+	if err != nil {
+		return err
+	}
+	var issues []*backend.QualityIssue
+	for start := from; start <= to; start += checkBatch {
+		end := start + checkBatch - 1
+		if end > to {
+			end = to
+		}
+		found, err := verify.CheckRange(ctx.Context, b, start, end)
+		if err != nil {
+			return err
+		}
+		// One-off checks record their findings without moving the checker
+		if err := b.WriteQualityIssues(ctx.Context, start, end, found, false); err != nil {
+			return err
+		}
+		issues = append(issues, found...)
+		log.Info("Checked trace quality", "from", start, "to", end, "issues", len(found))
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(issues); err != nil {
+		return err
+	}
+	if len(issues) > 0 {
+		return cli.Exit(fmt.Sprintf("%d trace quality issues found", len(issues)), 1)
+	}
+	return nil
+}
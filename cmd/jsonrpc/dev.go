@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/fixtures"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+var (
+	devFlag = &cli.BoolFlag{
+		Name:  "dev",
+		Usage: "Development mode: serve the bundled fixtures from an in-memory SQLite database, without a node or PostgreSQL",
+	}
+	devFixturesFlag = &cli.StringSliceFlag{
+		Name:  "dev.fixtures",
+		Usage: "Fixture files served in development mode instead of the bundled ones",
+	}
+	fixtureOutputFlag = &cli.StringFlag{
+		Name:  "output",
+		Usage: "File to write the fixture to (default: stdout)",
+	}
+	fixtureCommand = &cli.Command{
+		Action: captureFixture,
+		Name:   "fixture",
+		Usage:  "Capture a block range with its transactions and traces as a fixture for the --dev mode and the tests",
+		Flags: []cli.Flag{
+			chainFlag,
+			upstreamJSONRPCFlag,
+			upstreamDBDSNFlag,
+			traceSchemaFlag,
+			offlineFlag,
+			fromBlockFlag,
+			toBlockFlag,
+			fixtureOutputFlag,
+		},
+	}
+)
+
+// devFixtures loads the fixtures of the development mode, the bundled ones
+// unless files are given.
+func devFixtures(ctx *cli.Context) ([]*backend.Fixture, error) {
+	var loaded []*backend.Fixture
+	if paths := ctx.StringSlice(devFixturesFlag.Name); len(paths) > 0 {
+		for _, path := range paths {
+			r, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			f, err := backend.ReadFixture(r)
+			r.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			loaded = append(loaded, f)
+		}
+		return loaded, nil
+	}
+	chain := ctx.String(chainFlag.Name)
+	for _, name := range fixtures.Names() {
+		r, err := fixtures.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := backend.ReadFixture(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		if f.Chain == chain {
+			loaded = append(loaded, f)
+		}
+	}
+	return loaded, nil
+}
+
+// newBackend creates the backend of the node, a SQLite one loaded with the
+// fixtures in development mode.
+func newBackend(ctx *cli.Context, cfg *backend.Config) (backend.Backend, error) {
+	if !ctx.Bool(devFlag.Name) {
+		return backend.NewMixinBackend(context.Background(), cfg)
+	}
+	loaded, err := devFixtures(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blocks := 0
+	for _, f := range loaded {
+		blocks += len(f.Blocks)
+	}
+	log.Warn("Running in development mode, serving fixtures only", "chain", cfg.Chain, "fixtures", len(loaded), "blocks", blocks)
+	return backend.NewDevBackend(context.Background(), cfg, loaded...)
+}
+
+func captureFixture(ctx *cli.Context) error {
+	dbLogger, err := logging.DBLogger(ctx)
+	if err != nil {
+		return err
+	}
+	schema, err := traceSchema(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := backend.NewMixinBackend(context.Background(), &backend.Config{
+		Chain:       ctx.String(chainFlag.Name),
+		Upstream:    ctx.String(upstreamJSONRPCFlag.Name),
+		DBDSN:       ctx.String(upstreamDBDSNFlag.Name),
+		DBLogger:    dbLogger,
+		TraceSchema: schema,
+		Offline:     ctx.Bool(offlineFlag.Name),
+	})
+	if err != nil {
+		return err
+	}
+	fixture := &backend.Fixture{Chain: ctx.String(chainFlag.Name)}
+	for number := ctx.Uint64(fromBlockFlag.Name); number <= ctx.Uint64(toBlockFlag.Name); number++ {
+		block, err := b.FixtureBlock(ctx.Context, number)
+		if err != nil {
+			return err
+		}
+		fixture.Blocks = append(fixture.Blocks, block)
+	}
+	out := os.Stdout
+	if path := ctx.String(fixtureOutputFlag.Name); path != "" {
+		if out, err = os.Create(path); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(fixture)
+}
@@ -1,19 +1,30 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/prometheus"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/urfave/cli/v2"
 
 	"github.com/jsvisa/hdt/backend"
 	"github.com/jsvisa/hdt/node"
+	"github.com/jsvisa/hdt/pkg/logging"
+	"github.com/jsvisa/hdt/service/cache"
+	"github.com/jsvisa/hdt/service/decoder"
 	"github.com/jsvisa/hdt/service/eth"
+	"github.com/jsvisa/hdt/service/etherscan"
+	"github.com/jsvisa/hdt/service/hdt"
+	"github.com/jsvisa/hdt/service/ots"
 	"github.com/jsvisa/hdt/service/trace"
+	"github.com/jsvisa/hdt/service/verify"
 )
 
 const (
@@ -39,6 +50,90 @@ var (
 		Value:   "postgres://postgres:@127.0.0.1:5432/postgres?sslmode=disable",
 		EnvVars: []string{"UPSTREAM_DBDSN"},
 	}
+	tokenSourceFlag = &cli.StringFlag{
+		Name:  "tokens.source",
+		Usage: "Source of the token transfers: table (<chain>.token_transfers) or logs (decoded from <chain>.logs)",
+		Value: backend.TokenSourceTable,
+	}
+	offlineFlag = &cli.BoolFlag{
+		Name:  "offline",
+		Usage: "Serve headers, blocks and transactions from the <chain>.blocks and <chain>.transactions tables, without an upstream node",
+	}
+	traceSchemaFlag = &cli.StringFlag{
+		Name:  "traces.schema",
+		Usage: "JSON file mapping the traces table name, columns and trace_address encoding (string, array or jsonb) of non default layouts",
+	}
+	cacheTypeFlag = &cli.StringFlag{
+		Name:  "cache.type",
+		Usage: "Response cache for finalized results: memory or disk (empty disables it)",
+	}
+	cacheDirFlag = &cli.StringFlag{
+		Name:  "cache.dir",
+		Usage: "Directory of the disk response cache (default: <datadir>/rpccache)",
+	}
+	cacheSizeFlag = &cli.Uint64Flag{
+		Name:  "cache.size",
+		Usage: "Maximum size of the response cache in megabytes",
+		Value: 1024,
+	}
+	cacheConfirmationsFlag = &cli.Uint64Flag{
+		Name:  "cache.confirmations",
+		Usage: "Treat blocks this deep below the head as final, for chains without the finalized tag (0 uses the tag)",
+	}
+	balanceIndexFlag = &cli.BoolFlag{
+		Name:  "balance.index",
+		Usage: "Maintain the balance checkpoints serving hdt_getBalanceHistory (tables are created by the migrate command)",
+	}
+	balanceConfirmationsFlag = &cli.Uint64Flag{
+		Name:  "balance.confirmations",
+		Usage: "Index blocks this deep below the head, for chains without the finalized tag (0 uses the tag)",
+	}
+	balanceStartBlockFlag = &cli.Uint64Flag{
+		Name:  "balance.startblock",
+		Usage: "First block to index into an empty balance checkpoints table, later accounts are seeded from an archive upstream",
+	}
+	qualityCheckFlag = &cli.BoolFlag{
+		Name:  "quality.check",
+		Usage: "Check the structural invariants of the finalized traces into <chain>.trace_quality_issues (created by the migrate command)",
+	}
+	qualityConfirmationsFlag = &cli.Uint64Flag{
+		Name:  "quality.confirmations",
+		Usage: "Check blocks this deep below the head, for chains without the finalized tag (0 uses the tag)",
+	}
+	qualityStartBlockFlag = &cli.Uint64Flag{
+		Name:  "quality.startblock",
+		Usage: "First block to check when the quality report is empty",
+	}
+	metricsFlag = &cli.BoolFlag{
+		Name:  "metrics",
+		Usage: "Enable metrics collection, served in Prometheus format at /debug/metrics/prometheus",
+	}
+	abiDirFlag = &cli.StringFlag{
+		Name:  "abi.dir",
+		Usage: "Directory of contract ABIs used for decoding, files are named <address>.json",
+	}
+	abiHTTPFlag = &cli.BoolFlag{
+		Name:  "abi.http",
+		Usage: "Serve the ABI registry API over plain HTTP at /abi/ (the RPC methods need the abi module enabled)",
+	}
+	abiUploadFlag = &cli.BoolFlag{
+		Name:  "abi.upload",
+		Usage: "Allow uploading and deleting ABIs through the registry APIs, which are unauthenticated",
+	}
+	abiSignaturesFlag = &cli.StringFlag{
+		Name:  "abi.signatures",
+		Usage: "File of text signatures extending the bundled 4-byte database, one per line",
+	}
+	fromBlockFlag = &cli.Uint64Flag{
+		Name:     "from",
+		Usage:    "First block of the range",
+		Required: true,
+	}
+	toBlockFlag = &cli.Uint64Flag{
+		Name:     "to",
+		Usage:    "Last block of the range (inclusive)",
+		Required: true,
+	}
 	pprofFlag = &cli.BoolFlag{
 		Name:  "pprof",
 		Usage: "Enable the pprof HTTP server",
@@ -71,6 +166,7 @@ var (
 func init() {
 	// Initialize the CLI app and start web server
 	app.Action = run
+	app.Before = logging.Setup
 	app.Flags = []cli.Flag{
 		utils.HTTPEnabledFlag,
 		utils.HTTPListenAddrFlag,
@@ -88,6 +184,26 @@ func init() {
 		chainFlag,
 		upstreamJSONRPCFlag,
 		upstreamDBDSNFlag,
+		offlineFlag,
+		devFlag,
+		devFixturesFlag,
+		tokenSourceFlag,
+		traceSchemaFlag,
+		cacheTypeFlag,
+		cacheDirFlag,
+		cacheSizeFlag,
+		cacheConfirmationsFlag,
+		balanceIndexFlag,
+		balanceConfirmationsFlag,
+		balanceStartBlockFlag,
+		qualityCheckFlag,
+		qualityConfirmationsFlag,
+		qualityStartBlockFlag,
+		metricsFlag,
+		abiDirFlag,
+		abiSignaturesFlag,
+		abiHTTPFlag,
+		abiUploadFlag,
 		pprofFlag,
 		pprofAddrFlag,
 		pprofPortFlag,
@@ -95,6 +211,85 @@ func init() {
 		blockprofilerateFlag,
 		cpuprofileFlag,
 	}
+	app.Flags = append(app.Flags, logging.Flags...)
+	app.Commands = []*cli.Command{
+		migrateCommand,
+		calltreeCommand,
+		verifyCommand,
+		checkCommand,
+		exportCommand,
+		importCommand,
+		fixtureCommand,
+	}
+}
+
+// traceSchema loads the layout of the traces table, nil for the default one.
+func traceSchema(ctx *cli.Context) (*backend.TraceSchema, error) {
+	path := ctx.String(traceSchemaFlag.Name)
+	if path == "" {
+		return nil, nil
+	}
+	return backend.LoadTraceSchema(path)
+}
+
+// newDecoder creates the ABI decoder from the bundled signatures, the
+// registry and the optional local ABIs and signatures.
+func newDecoder(ctx *cli.Context, backend backend.Backend, dbRegistry *decoder.DBRegistry) (*decoder.Decoder, error) {
+	signatures := decoder.NewSignatures()
+	if path := ctx.String(abiSignaturesFlag.Name); path != "" {
+		if err := signatures.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	// Local files take precedence over the uploaded ABIs
+	var registry decoder.Registry = dbRegistry
+	if dir := ctx.String(abiDirFlag.Name); dir != "" {
+		dirRegistry, err := decoder.NewDirRegistry(dir)
+		if err != nil {
+			return nil, err
+		}
+		registry = decoder.NewMultiRegistry(dirRegistry, dbRegistry)
+	}
+	log.Info("Loaded ABI decoder", "signatures", signatures.Len())
+	return decoder.New(backend, registry, signatures), nil
+}
+
+// chainConfigs are the fork schedules of the chains known by name.
+var chainConfigs = map[string]*params.ChainConfig{
+	"ethereum": params.MainnetChainConfig,
+	"goerli":   params.GoerliChainConfig,
+	"sepolia":  params.SepoliaChainConfig,
+	"holesky":  params.HoleskyChainConfig,
+}
+
+// chainConfig returns the fork schedule of the chain, used to recover the
+// senders and price the pending transactions. Other chains are assumed to
+// have every fork active from genesis.
+func chainConfig(ctx *cli.Context) *params.ChainConfig {
+	chain := ctx.String(chainFlag.Name)
+	if config, ok := chainConfigs[chain]; ok {
+		return config
+	}
+	log.Warn("Fork schedule unknown, assuming every fork from genesis", "chain", chain)
+	return params.AllDevChainProtocolChanges
+}
+
+// indexerConfig returns the balance indexer configuration, the irregular
+// state changes are only known for Ethereum mainnet.
+func indexerConfig(ctx *cli.Context) *hdt.IndexerConfig {
+	config := &hdt.IndexerConfig{
+		Confirmations: ctx.Uint64(balanceConfirmationsFlag.Name),
+		StartBlock:    ctx.Uint64(balanceStartBlockFlag.Name),
+	}
+	if chain := ctx.String(chainFlag.Name); chain == "ethereum" {
+		config.Genesis = core.DefaultGenesisBlock().Alloc
+		config.DAOForkBlock = params.MainnetChainConfig.DAOForkBlock
+		config.DAODrainList = params.DAODrainList()
+		config.DAORefund = params.DAORefundContract
+	} else {
+		log.Warn("Genesis allocation unknown, relying on genesis traces", "chain", chain)
+	}
+	return config
 }
 
 func main() {
@@ -112,24 +307,76 @@ func run(ctx *cli.Context) error {
 		return fmt.Errorf("invalid command: %q", args[0])
 	}
 
+	// Metrics are no-ops unless enabled before they are created
+	metrics.Enabled = ctx.Bool(metricsFlag.Name)
+
 	cfg := loadBaseConfig(ctx)
 	stack, err := node.New(&cfg.Node)
 	if err != nil {
 		log.Crit("Failed to create the protocol stack", "err", err)
 	}
 
-	cctx := context.Background()
-	backend, err := backend.NewMixinBackend(
-		cctx,
-		ctx.String(chainFlag.Name),
-		ctx.String(upstreamJSONRPCFlag.Name),
-		ctx.String(upstreamDBDSNFlag.Name),
-	)
+	dbLogger, err := logging.DBLogger(ctx)
+	if err != nil {
+		return err
+	}
+	schema, err := traceSchema(ctx)
+	if err != nil {
+		return err
+	}
+	backend, err := newBackend(ctx, &backend.Config{
+		Chain:    ctx.String(chainFlag.Name),
+		Upstream: ctx.String(upstreamJSONRPCFlag.Name),
+		DBDSN:    ctx.String(upstreamDBDSNFlag.Name),
+		DBLogger: dbLogger,
+
+		TokenSource: ctx.String(tokenSourceFlag.Name),
+		TraceSchema: schema,
+		Offline:     ctx.Bool(offlineFlag.Name),
+	})
 	if err != nil {
 		log.Crit("Failed to register the Ethereum service", "err", err)
 	}
-	stack.RegisterAPIs(trace.APIs(backend))
-	stack.RegisterAPIs(eth.APIs(backend))
+	cacheDir := ctx.String(cacheDirFlag.Name)
+	if cacheDir == "" {
+		cacheDir = filepath.Join(stack.Config().DataDir, "rpccache")
+	}
+	rpcCache, err := cache.New(&cache.Config{
+		Type:          ctx.String(cacheTypeFlag.Name),
+		Dir:           cacheDir,
+		MaxSize:       ctx.Uint64(cacheSizeFlag.Name) * 1024 * 1024,
+		Confirmations: ctx.Uint64(cacheConfirmationsFlag.Name),
+	}, backend)
+	if err != nil {
+		log.Crit("Failed to create the response cache", "err", err)
+	}
+	abiRegistry := decoder.NewDBRegistry(backend)
+	abiDecoder, err := newDecoder(ctx, backend, abiRegistry)
+	if err != nil {
+		log.Crit("Failed to create the ABI decoder", "err", err)
+	}
+	config := chainConfig(ctx)
+	stack.RegisterAPIs(trace.APIs(backend, rpcCache, abiDecoder))
+	stack.RegisterAPIs(eth.APIs(backend, rpcCache, config))
+	stack.RegisterAPIs(ots.APIs(backend, config))
+	hdtAPI := hdt.NewAPI(backend, abiDecoder)
+	stack.RegisterAPIs(hdt.APIs(hdtAPI))
+	stack.RegisterAPIs(cache.APIs(rpcCache))
+	stack.RegisterAPIs(decoder.APIs(abiRegistry, ctx.Bool(abiUploadFlag.Name)))
+	stack.RegisterHandler("Etherscan API", "/api", etherscan.NewHandler(backend))
+	stack.RegisterHandler("hdt graphs", "/hdt/", hdt.NewHandler(hdtAPI, "/hdt/"))
+	if ctx.Bool(abiHTTPFlag.Name) {
+		stack.RegisterHandler("ABI registry", "/abi/", decoder.NewHandler(abiRegistry, "/abi/", ctx.Bool(abiUploadFlag.Name)))
+	}
+	if ctx.Bool(balanceIndexFlag.Name) {
+		stack.RegisterLifecycle(hdt.NewIndexer(backend, indexerConfig(ctx)))
+	}
+	if ctx.Bool(qualityCheckFlag.Name) {
+		stack.RegisterLifecycle(verify.NewChecker(backend, ctx.Uint64(qualityConfirmationsFlag.Name), ctx.Uint64(qualityStartBlockFlag.Name)))
+	}
+	if metrics.Enabled {
+		stack.RegisterHandler("Metrics", "/debug/metrics/prometheus", prometheus.Handler(metrics.DefaultRegistry))
+	}
 	defer stack.Close()
 
 	if err := stack.Start(); err != nil {
@@ -138,13 +385,3 @@ func run(ctx *cli.Context) error {
 	stack.Wait()
 	return nil
 }
-
-var (
-	glogger *log.GlogHandler
-)
-
-func init() {
-	glogger = log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
-	glogger.Verbosity(log.LvlInfo)
-	log.Root().SetHandler(glogger)
-}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+var (
+	concurrentlyFlag = &cli.BoolFlag{
+		Name:  "concurrently",
+		Usage: "Build indexes without blocking writes (unsupported on partitioned tables)",
+	}
+	migrateCommand = &cli.Command{
+		Action: migrate,
+		Name:   "migrate",
+		Usage:  "Apply the recommended indexes and schema migrations to the chain tables",
+		Flags: []cli.Flag{
+			chainFlag,
+			upstreamJSONRPCFlag,
+			upstreamDBDSNFlag,
+			traceSchemaFlag,
+			concurrentlyFlag,
+		},
+	}
+)
+
+func migrate(ctx *cli.Context) error {
+	dbLogger, err := logging.DBLogger(ctx)
+	if err != nil {
+		return err
+	}
+	schema, err := traceSchema(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := backend.NewMixinBackend(context.Background(), &backend.Config{
+		Chain:       ctx.String(chainFlag.Name),
+		Upstream:    ctx.String(upstreamJSONRPCFlag.Name),
+		DBDSN:       ctx.String(upstreamDBDSNFlag.Name),
+		DBLogger:    dbLogger,
+		TraceSchema: schema,
+	})
+	if err != nil {
+		return err
+	}
+	return b.Migrate(ctx.Context, ctx.Bool(concurrentlyFlag.Name))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/urfave/cli/v2"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+	"github.com/jsvisa/hdt/service/verify"
+)
+
+var (
+	verifySampleFlag = &cli.Uint64Flag{
+		Name:  "sample",
+		Usage: "Number of randomly sampled blocks to verify, 0 sweeps the whole range",
+	}
+	verifySeedFlag = &cli.Int64Flag{
+		Name:  "seed",
+		Usage: "Seed of the block sampling, the current time if 0",
+	}
+	verifyConcurrencyFlag = &cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "Number of blocks verified in parallel",
+		Value: 4,
+	}
+	verifyOutputFlag = &cli.StringFlag{
+		Name:  "output",
+		Usage: "File receiving the JSON report, stdout if empty",
+	}
+	verifyCommand = &cli.Command{
+		Action: verifyTraces,
+		Name:   "verify",
+		Usage:  "Compare the traces table against the upstream trace_block, exits non-zero on mismatch",
+		Flags: []cli.Flag{
+			chainFlag,
+			upstreamJSONRPCFlag,
+			upstreamDBDSNFlag,
+			traceSchemaFlag,
+			fromBlockFlag,
+			toBlockFlag,
+			verifySampleFlag,
+			verifySeedFlag,
+			verifyConcurrencyFlag,
+			verifyOutputFlag,
+		},
+	}
+)
+
+// verifyBlocks returns the blocks to verify: the whole range, or a sorted
+// random sample of it.
+func verifyBlocks(from, to, sample uint64, seed int64) []uint64 {
+	size := to - from + 1
+	if sample == 0 || sample >= size {
+		blocks := make([]uint64, 0, size)
+		for n := from; n <= to; n++ {
+			blocks = append(blocks, n)
+		}
+		return blocks
+	}
+	var (
+		rng    = rand.New(rand.NewSource(seed))
+		picked = make(map[uint64]struct{}, sample)
+		blocks = make([]uint64, 0, sample)
+	)
+	for uint64(len(blocks)) < sample {
+		n := from + uint64(rng.Int63n(int64(size)))
+		if _, ok := picked[n]; ok {
+			continue
+		}
+		picked[n] = struct{}{}
+		blocks = append(blocks, n)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	return blocks
+}
+
+func verifyTraces(ctx *cli.Context) error {
+	from, to := ctx.Uint64(fromBlockFlag.Name), ctx.Uint64(toBlockFlag.Name)
+	if from > to {
+		return fmt.Errorf("--%s is after --%s", fromBlockFlag.Name, toBlockFlag.Name)
+	}
+	dbLogger, err := logging.DBLogger(ctx)
+	if err != nil {
+		return err
+	}
+	schema, err := traceSchema(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := backend.NewMixinBackend(context.Background(), &backend.Config{
+		Chain:       ctx.String(chainFlag.Name),
+		Upstream:    ctx.String(upstreamJSONRPCFlag.Name),
+		DBDSN:       ctx.String(upstreamDBDSNFlag.Name),
+		DBLogger:    dbLogger,
+		TraceSchema: schema,
+	})
+	if err != nil {
+		return err
+	}
+	// Also keeps the range size from overflowing
+	head, err := b.HeaderByNumber(ctx.Context, rpc.LatestBlockNumber)
+	if err != nil {
+		return err
+	}
+	if to > head.Number.Uint64() {
+		return fmt.Errorf("--%s is after the upstream head %d", toBlockFlag.Name, head.Number)
+	}
+	seed := ctx.Int64(verifySeedFlag.Name)
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	var (
+		blocks  = verifyBlocks(from, to, ctx.Uint64(verifySampleFlag.Name), seed)
+		report  = &verify.Report{FromBlock: from, ToBlock: to}
+		queue   = make(chan uint64)
+		lock    sync.Mutex
+		wg      sync.WaitGroup
+		workers = ctx.Int(verifyConcurrencyFlag.Name)
+	)
+	log.Info("Verifying traces", "from", from, "to", to, "blocks", len(blocks), "seed", seed)
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range queue {
+				block := verify.Block(ctx.Context, b, number)
+				if !block.OK() {
+					log.Warn("Block verification failed", "number", number, "mismatches", len(block.Mismatches), "err", block.Error)
+				}
+				lock.Lock()
+				report.Add(block)
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, number := range blocks {
+		queue <- number
+	}
+	close(queue)
+	wg.Wait()
+
+	var out io.Writer = os.Stdout
+	if path := ctx.String(verifyOutputFlag.Name); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	if !report.OK() {
+		return cli.Exit(fmt.Sprintf("verification failed: %d blocks mismatched, %d errors", report.Mismatched, report.Errors), 1)
+	}
+	log.Info("Traces verified", "blocks", report.Blocks, "frames", report.Frames)
+	return nil
+}
@@ -0,0 +1,26 @@
+// Package fixtures bundles the chain fixtures served by the --dev mode and
+// loaded by the integration tests, see backend.Fixture for the format.
+package fixtures
+
+import (
+	"embed"
+	"io"
+)
+
+//go:embed *.json
+var files embed.FS
+
+// Open opens a bundled fixture, e.g. "ethereum.json".
+func Open(name string) (io.ReadCloser, error) {
+	return files.Open(name)
+}
+
+// Names returns the names of the bundled fixtures.
+func Names() []string {
+	entries, _ := files.ReadDir(".")
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names
+}
@@ -0,0 +1,146 @@
+// Package archive reads and writes trace archives: a directory of files,
+// each holding the traces of a block range, described by a manifest with
+// the checksum of every file.
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Archive file formats.
+const (
+	FormatJSONL   = "jsonl"   // zstd compressed JSON lines
+	FormatParquet = "parquet" // Parquet with zstd compressed pages, rows only
+)
+
+// Archive contents.
+const (
+	KindRows   = "rows"   // Raw rows of the traces table, importable
+	KindFrames = "frames" // Call frames as served by trace_block
+)
+
+// ManifestName is the file name of the manifest within an archive.
+const ManifestName = "manifest.json"
+
+// manifestVersion is bumped on incompatible layout changes.
+const manifestVersion = 1
+
+// File describes an archive file.
+type File struct {
+	Name      string `json:"name"`
+	FromBlock uint64 `json:"fromBlock"`
+	ToBlock   uint64 `json:"toBlock"`
+	Rows      uint64 `json:"rows"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+}
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version       int     `json:"version"`
+	Chain         string  `json:"chain"`
+	Kind          string  `json:"kind"`
+	Format        string  `json:"format"`
+	FromBlock     uint64  `json:"fromBlock"`
+	ToBlock       uint64  `json:"toBlock"`
+	BlocksPerFile uint64  `json:"blocksPerFile"`
+	Files         []*File `json:"files"`
+}
+
+// NewManifest creates the manifest of an archive, checking the format can
+// hold the kind of contents.
+func NewManifest(chain, kind, format string, fromBlock, toBlock, blocksPerFile uint64) (*Manifest, error) {
+	switch kind {
+	case KindRows, KindFrames:
+	default:
+		return nil, fmt.Errorf("unknown archive kind %q", kind)
+	}
+	switch format {
+	case FormatJSONL:
+	case FormatParquet:
+		if kind != KindRows {
+			return nil, fmt.Errorf("%s archives only hold %s", FormatParquet, KindRows)
+		}
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+	if blocksPerFile == 0 {
+		return nil, fmt.Errorf("blocks per file must be positive")
+	}
+	return &Manifest{
+		Version:       manifestVersion,
+		Chain:         chain,
+		Kind:          kind,
+		Format:        format,
+		FromBlock:     fromBlock,
+		ToBlock:       toBlock,
+		BlocksPerFile: blocksPerFile,
+	}, nil
+}
+
+// FileName returns the name of the file holding a block range.
+func (m *Manifest) FileName(fromBlock, toBlock uint64) string {
+	ext := ".jsonl.zst"
+	if m.Format == FormatParquet {
+		ext = ".parquet"
+	}
+	return fmt.Sprintf("traces-%s-%010d-%010d%s", m.Kind, fromBlock, toBlock, ext)
+}
+
+// ReadManifest reads the manifest of the archive in dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	blob, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(blob, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// Write writes the manifest into dir, through a temporary file so a partial
+// archive never carries a complete looking manifest.
+func (m *Manifest) Write(dir string) error {
+	blob, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, ManifestName+".tmp")
+	if err := os.WriteFile(tmp, append(blob, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, ManifestName))
+}
+
+// Verify checks the size and checksum of an archive file.
+func Verify(dir string, file *File) error {
+	f, err := os.Open(filepath.Join(dir, file.Name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return err
+	}
+	if size != file.Size {
+		return fmt.Errorf("%s: size %d, manifest says %d", file.Name, size, file.Size)
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != file.SHA256 {
+		return fmt.Errorf("%s: checksum %s, manifest says %s", file.Name, sum, file.SHA256)
+	}
+	return nil
+}
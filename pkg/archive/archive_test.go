@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+func testTraces() []backend.Trace {
+	var (
+		hash  = "0xaae3c030ee04b1ef071e00198818a113a3ac20db252fbfba4f78572aa59f5226"
+		from  = "0x1dc907d55f1be2bc4370feb0f01fb89324b8941c"
+		to    = "0x7a250d5630b4cf539739df2c5dacb4c659f2488d"
+		value = decimal.RequireFromString("250000000000000000")
+		gas   = decimal.NewFromInt(477212)
+	)
+	return []backend.Trace{
+		{
+			Timestamp: time.Unix(1681338455, 0).UTC(), BlockNum: 100, TransactionHash: &hash,
+			FromAddress: &from, ToAddress: &to, Value: &value, Input: "0x12", Output: "0x",
+			TraceType: "call", CallType: "call", Gas: &gas, GasUsed: 91903, SubTraces: 1, TraceAddress: "[]",
+		},
+		{
+			Timestamp: time.Unix(1681338455, 0).UTC(), BlockNum: 100, TransactionHash: &hash,
+			FromAddress: &to, Input: "0x", Output: "0x", TraceType: "call", CallType: "staticcall",
+			TraceAddress: "[0]", Error: "Reverted",
+		},
+		{
+			Timestamp: time.Unix(1681338467, 0).UTC(), BlockNum: 101, ToAddress: &from,
+			Value: &value, TraceType: "reward", RewardType: "block", TraceAddress: "[]",
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatJSONL, FormatParquet} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			m, err := NewManifest("ethereum", KindRows, format, 100, 101, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, err := NewFileWriter(dir, m, 100, 101)
+			if err != nil {
+				t.Fatal(err)
+			}
+			traces := testTraces()
+			for i := range traces {
+				if err := w.WriteRow(&traces[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			file, err := w.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Rows != uint64(len(traces)) {
+				t.Fatalf("rows: have %d, want %d", file.Rows, len(traces))
+			}
+			m.Files = append(m.Files, file)
+			if err := m.Write(dir); err != nil {
+				t.Fatal(err)
+			}
+			if m, err = ReadManifest(dir); err != nil {
+				t.Fatal(err)
+			}
+			if err := Verify(dir, m.Files[0]); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewRowReader(dir, m, m.Files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			var have []backend.Trace
+			for {
+				rows, err := r.Read(2)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				have = append(have, rows...)
+			}
+			if len(have) != len(traces) {
+				t.Fatalf("read %d rows, want %d", len(have), len(traces))
+			}
+			for i, want := range traces {
+				got := have[i]
+				if !got.Timestamp.Equal(want.Timestamp) || got.BlockNum != want.BlockNum || got.TraceAddress != want.TraceAddress ||
+					got.CallType != want.CallType || got.Error != want.Error || got.GasUsed != want.GasUsed {
+					t.Errorf("row %d: have %+v, want %+v", i, got, want)
+				}
+				if (got.Value == nil) != (want.Value == nil) || (want.Value != nil && !got.Value.Equal(*want.Value)) {
+					t.Errorf("row %d: value have %v, want %v", i, got.Value, want.Value)
+				}
+				if (got.ToAddress == nil) != (want.ToAddress == nil) {
+					t.Errorf("row %d: to address have %v, want %v", i, got.ToAddress, want.ToAddress)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	m, _ := NewManifest("ethereum", KindRows, FormatJSONL, 100, 101, 10)
+	w, err := NewFileWriter(dir, m, 100, 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	traces := testTraces()
+	if err := w.WriteRow(&traces[0]); err != nil {
+		t.Fatal(err)
+	}
+	file, err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, _ := os.ReadFile(filepath.Join(dir, file.Name))
+	blob[len(blob)-1] ^= 0xff
+	os.WriteFile(filepath.Join(dir, file.Name), blob, 0o644)
+	if err := Verify(dir, file); err == nil {
+		t.Fatal("corrupted file passed verification")
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	if _, err := NewManifest("ethereum", KindFrames, FormatParquet, 0, 1, 1); err == nil {
+		t.Error("parquet archive of frames accepted")
+	}
+	if _, err := NewManifest("ethereum", KindRows, FormatJSONL, 0, 1, 0); err == nil {
+		t.Error("zero blocks per file accepted")
+	}
+	if _, err := NewManifest("ethereum", KindFrames, FormatJSONL, 0, 1, 1); err != nil {
+		t.Error(err)
+	}
+}
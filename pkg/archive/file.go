@@ -0,0 +1,281 @@
+package archive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	pzstd "github.com/parquet-go/parquet-go/compress/zstd"
+	"github.com/shopspring/decimal"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// parquetRow is the Parquet layout of a traces table row, decimals are kept
+// as text to preserve their full precision.
+type parquetRow struct {
+	Timestamp       int64   `parquet:"block_timestamp"` // Unix seconds
+	BlockNum        uint64  `parquet:"blknum"`
+	TransactionHash *string `parquet:"txhash,optional"`
+	TransactionPos  uint64  `parquet:"txpos"`
+	FromAddress     *string `parquet:"from_address,optional"`
+	ToAddress       *string `parquet:"to_address,optional"`
+	Value           *string `parquet:"value,optional"`
+	Input           string  `parquet:"input"`
+	Output          string  `parquet:"output"`
+	TraceType       string  `parquet:"trace_type"`
+	CallType        string  `parquet:"call_type"`
+	RewardType      string  `parquet:"reward_type"`
+	Gas             *string `parquet:"gas,optional"`
+	GasUsed         uint64  `parquet:"gas_used"`
+	SubTraces       int64   `parquet:"subtraces"`
+	TraceAddress    string  `parquet:"trace_address"`
+	Error           string  `parquet:"error"`
+}
+
+func decimalText(d *decimal.Decimal) *string {
+	if d == nil {
+		return nil
+	}
+	s := d.String()
+	return &s
+}
+
+func textDecimal(s *string) (*decimal.Decimal, error) {
+	if s == nil {
+		return nil, nil
+	}
+	d, err := decimal.NewFromString(*s)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func newParquetRow(t *backend.Trace) parquetRow {
+	return parquetRow{
+		Timestamp:       t.Timestamp.Unix(),
+		BlockNum:        t.BlockNum,
+		TransactionHash: t.TransactionHash,
+		TransactionPos:  t.TransactionPos,
+		FromAddress:     t.FromAddress,
+		ToAddress:       t.ToAddress,
+		Value:           decimalText(t.Value),
+		Input:           t.Input,
+		Output:          t.Output,
+		TraceType:       t.TraceType,
+		CallType:        t.CallType,
+		RewardType:      t.RewardType,
+		Gas:             decimalText(t.Gas),
+		GasUsed:         t.GasUsed,
+		SubTraces:       int64(t.SubTraces),
+		TraceAddress:    t.TraceAddress,
+		Error:           t.Error,
+	}
+}
+
+func (r *parquetRow) trace() (backend.Trace, error) {
+	value, err := textDecimal(r.Value)
+	if err != nil {
+		return backend.Trace{}, err
+	}
+	gas, err := textDecimal(r.Gas)
+	if err != nil {
+		return backend.Trace{}, err
+	}
+	return backend.Trace{
+		Timestamp:       time.Unix(r.Timestamp, 0).UTC(),
+		BlockNum:        r.BlockNum,
+		TransactionHash: r.TransactionHash,
+		TransactionPos:  r.TransactionPos,
+		FromAddress:     r.FromAddress,
+		ToAddress:       r.ToAddress,
+		Value:           value,
+		Input:           r.Input,
+		Output:          r.Output,
+		TraceType:       r.TraceType,
+		CallType:        r.CallType,
+		RewardType:      r.RewardType,
+		Gas:             gas,
+		GasUsed:         r.GasUsed,
+		SubTraces:       int(r.SubTraces),
+		TraceAddress:    r.TraceAddress,
+		Error:           r.Error,
+	}, nil
+}
+
+// FileWriter writes an archive file, checksumming it along the way.
+type FileWriter struct {
+	file   *os.File
+	hasher hash.Hash
+	meta   *File
+
+	zw *zstd.Encoder
+	bw *bufio.Writer
+	je *json.Encoder
+	pw *parquet.GenericWriter[parquetRow]
+}
+
+// NewFileWriter creates the file of a block range within the archive in dir.
+func NewFileWriter(dir string, m *Manifest, fromBlock, toBlock uint64) (*FileWriter, error) {
+	name := m.FileName(fromBlock, toBlock)
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	w := &FileWriter{
+		file:   file,
+		hasher: sha256.New(),
+		meta:   &File{Name: name, FromBlock: fromBlock, ToBlock: toBlock},
+	}
+	out := io.MultiWriter(file, w.hasher)
+	switch m.Format {
+	case FormatJSONL:
+		if w.zw, err = zstd.NewWriter(out); err != nil {
+			file.Close()
+			return nil, err
+		}
+		w.bw = bufio.NewWriter(w.zw)
+		w.je = json.NewEncoder(w.bw)
+	case FormatParquet:
+		w.pw = parquet.NewGenericWriter[parquetRow](out, parquet.Compression(&pzstd.Codec{}))
+	}
+	return w, nil
+}
+
+// WriteRow appends a traces table row.
+func (w *FileWriter) WriteRow(t *backend.Trace) error {
+	w.meta.Rows++
+	if w.pw != nil {
+		_, err := w.pw.Write([]parquetRow{newParquetRow(t)})
+		return err
+	}
+	return w.je.Encode(t)
+}
+
+// WriteFrame appends a call frame, JSON lines only.
+func (w *FileWriter) WriteFrame(f *backend.CallFrame) error {
+	if w.je == nil {
+		return errors.New("frames need the jsonl format")
+	}
+	w.meta.Rows++
+	return w.je.Encode(f)
+}
+
+// Close flushes the file, returning its description for the manifest.
+func (w *FileWriter) Close() (*File, error) {
+	var err error
+	if w.pw != nil {
+		err = w.pw.Close()
+	} else {
+		if err = w.bw.Flush(); err == nil {
+			err = w.zw.Close()
+		}
+	}
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	info, err := w.file.Stat()
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	if err := w.file.Close(); err != nil {
+		return nil, err
+	}
+	w.meta.Size = info.Size()
+	w.meta.SHA256 = hex.EncodeToString(w.hasher.Sum(nil))
+	return w.meta, nil
+}
+
+// RowReader reads the traces table rows of an archive file.
+type RowReader struct {
+	file *os.File
+	zr   *zstd.Decoder
+	jd   *json.Decoder
+	pr   *parquet.GenericReader[parquetRow]
+	buf  []parquetRow
+}
+
+// NewRowReader opens an archive file holding rows.
+func NewRowReader(dir string, m *Manifest, file *File) (*RowReader, error) {
+	if m.Kind != KindRows {
+		return nil, fmt.Errorf("archives of %s can't be read as rows", m.Kind)
+	}
+	f, err := os.Open(filepath.Join(dir, file.Name))
+	if err != nil {
+		return nil, err
+	}
+	r := &RowReader{file: f}
+	switch m.Format {
+	case FormatJSONL:
+		if r.zr, err = zstd.NewReader(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		r.jd = json.NewDecoder(r.zr)
+	case FormatParquet:
+		r.pr = parquet.NewGenericReader[parquetRow](f)
+	default:
+		f.Close()
+		return nil, fmt.Errorf("unknown archive format %q", m.Format)
+	}
+	return r, nil
+}
+
+// Read returns up to n rows, and io.EOF once the file is exhausted.
+func (r *RowReader) Read(n int) ([]backend.Trace, error) {
+	rows := make([]backend.Trace, 0, n)
+	if r.pr != nil {
+		if cap(r.buf) < n {
+			r.buf = make([]parquetRow, n)
+		}
+		read, err := r.pr.Read(r.buf[:n])
+		for i := 0; i < read; i++ {
+			row, err := r.buf[i].trace()
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+		if err == io.EOF && len(rows) > 0 {
+			err = nil
+		}
+		return rows, err
+	}
+	for len(rows) < n {
+		var row backend.Trace
+		if err := r.jd.Decode(&row); err == io.EOF {
+			if len(rows) == 0 {
+				return nil, io.EOF
+			}
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Close releases the file.
+func (r *RowReader) Close() error {
+	if r.pr != nil {
+		r.pr.Close()
+	}
+	if r.zr != nil {
+		r.zr.Close()
+	}
+	return r.file.Close()
+}
@@ -5,12 +5,13 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 
 	"github.com/jsvisa/hdt/pkg/models"
 )
 
-func Init(dsn string) *gorm.DB {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+func Init(dsn string, dbLogger logger.Interface) *gorm.DB {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: dbLogger})
 	if err != nil {
 		log.Fatalln(err)
 	}
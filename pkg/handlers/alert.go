@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/log"
+	"github.com/jsvisa/hdt/pkg/logging"
 	"github.com/jsvisa/hdt/pkg/models"
 	"gorm.io/datatypes"
 )
@@ -31,6 +31,8 @@ var (
 )
 
 func (h handler) AddAlert(w http.ResponseWriter, r *http.Request) {
+	log := logging.Ctx(r.Context())
+
 	// Read to request body
 	defer r.Body.Close()
 	body, err := ioutil.ReadAll(r.Body)
@@ -79,7 +81,7 @@ func (h handler) AddAlert(w http.ResponseWriter, r *http.Request) {
 		h.postAlerts(alerts)
 
 		// Append to the alerts table
-		if result := h.DB.CreateInBatches(&alerts, 10); result.Error != nil {
+		if result := h.DB.WithContext(r.Context()).CreateInBatches(&alerts, 10); result.Error != nil {
 			log.Error("failed to save alerts into db", "err", result.Error)
 		}
 	}
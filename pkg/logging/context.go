@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// RequestIDHeader is the HTTP header used to read and echo the request ID.
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random 16 hex characters request identifier.
+func NewRequestID() string {
+	var buf [8]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+// WithRequestID returns a copy of ctx carrying the given request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Ctx returns a logger which tags every line with the request ID of ctx,
+// falling back to the root logger if ctx doesn't carry one.
+func Ctx(ctx context.Context) log.Logger {
+	if id := RequestID(ctx); id != "" {
+		return log.Root().New("reqid", id)
+	}
+	return log.Root()
+}
+
+// Handler assigns a request ID to every incoming HTTP request, reusing the
+// one supplied by the client in the X-Request-Id header if present. The ID is
+// echoed back in the response headers and stored in the request context.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		reuse  bool
+	}{
+		{"generated", "", false},
+		{"supplied", "client-id", true},
+		{"too long", strings.Repeat("x", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := record(t)
+			var seen string
+			handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+				Ctx(r.Context()).Info("Serving request")
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if seen == "" || seen != w.Header().Get(RequestIDHeader) {
+				t.Fatalf("request ID %q, echoed %q", seen, w.Header().Get(RequestIDHeader))
+			}
+			if (seen == tt.header) != tt.reuse {
+				t.Errorf("request ID %q, supplied %q, reused %v", seen, tt.header, tt.reuse)
+			}
+			if lines := rec.lines(); len(lines) != 1 || !strings.HasSuffix(lines[0], "reqid="+seen) {
+				t.Errorf("have %q, want the line tagged with %s", lines, seen)
+			}
+		})
+	}
+	if id := RequestID(context.Background()); id != "" {
+		t.Errorf("request ID %q without one set", id)
+	}
+}
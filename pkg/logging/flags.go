@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"gorm.io/gorm/logger"
+)
+
+const loggingCategory = "LOGGING"
+
+var (
+	VerbosityFlag = &cli.IntFlag{
+		Name:     "verbosity",
+		Usage:    "Logging verbosity: 0=crit, 1=error, 2=warn, 3=info, 4=debug, 5=trace",
+		Value:    3,
+		Category: loggingCategory,
+	}
+	VmoduleFlag = &cli.StringFlag{
+		Name:     "vmodule",
+		Usage:    "Per-module verbosity: comma-separated list of <pattern>=<level> (e.g. backend/*=5,node=4)",
+		Category: loggingCategory,
+	}
+	LogJSONFlag = &cli.BoolFlag{
+		Name:     "log.json",
+		Usage:    "Format logs with JSON",
+		Category: loggingCategory,
+	}
+	LogFileFlag = &cli.StringFlag{
+		Name:     "log.file",
+		Usage:    "Write logs to a file instead of stderr, rotating it by size",
+		Category: loggingCategory,
+	}
+	LogMaxSizeFlag = &cli.IntFlag{
+		Name:     "log.maxsize",
+		Usage:    "Maximum size in megabytes of the log file before it gets rotated",
+		Value:    100,
+		Category: loggingCategory,
+	}
+	LogMaxBackupsFlag = &cli.IntFlag{
+		Name:     "log.maxbackups",
+		Usage:    "Maximum number of rotated log files to retain",
+		Value:    10,
+		Category: loggingCategory,
+	}
+	LogMaxAgeFlag = &cli.IntFlag{
+		Name:     "log.maxage",
+		Usage:    "Maximum number of days to retain rotated log files",
+		Value:    30,
+		Category: loggingCategory,
+	}
+	LogCompressFlag = &cli.BoolFlag{
+		Name:     "log.compress",
+		Usage:    "Compress the rotated log files with gzip",
+		Category: loggingCategory,
+	}
+	DBLogLevelFlag = &cli.StringFlag{
+		Name:     "db.log.level",
+		Usage:    "SQL logging level: silent, error, warn or info (info logs every statement)",
+		Value:    "warn",
+		Category: loggingCategory,
+	}
+	DBSlowThresholdFlag = &cli.DurationFlag{
+		Name:     "db.log.slowthreshold",
+		Usage:    "Queries slower than this are logged as slow SQL at the warn level (0 disables)",
+		Value:    200 * time.Millisecond,
+		Category: loggingCategory,
+	}
+)
+
+// Flags is the collection of logging related command line flags.
+var Flags = []cli.Flag{
+	VerbosityFlag,
+	VmoduleFlag,
+	LogJSONFlag,
+	LogFileFlag,
+	LogMaxSizeFlag,
+	LogMaxBackupsFlag,
+	LogMaxAgeFlag,
+	LogCompressFlag,
+	DBLogLevelFlag,
+	DBSlowThresholdFlag,
+}
+
+// Setup installs the root log handler based on the command line flags.
+func Setup(ctx *cli.Context) error {
+	var (
+		output io.Writer = os.Stderr
+		format           = log.TerminalFormat(false)
+	)
+	if file := ctx.String(LogFileFlag.Name); file != "" {
+		output = &lumberjack.Logger{
+			Filename:   file,
+			MaxSize:    ctx.Int(LogMaxSizeFlag.Name),
+			MaxBackups: ctx.Int(LogMaxBackupsFlag.Name),
+			MaxAge:     ctx.Int(LogMaxAgeFlag.Name),
+			Compress:   ctx.Bool(LogCompressFlag.Name),
+		}
+		format = log.LogfmtFormat()
+	}
+	if ctx.Bool(LogJSONFlag.Name) {
+		format = log.JSONFormat()
+	}
+
+	glogger := log.NewGlogHandler(log.StreamHandler(output, format))
+	glogger.Verbosity(log.Lvl(ctx.Int(VerbosityFlag.Name)))
+	if err := glogger.Vmodule(ctx.String(VmoduleFlag.Name)); err != nil {
+		return fmt.Errorf("invalid --%s: %v", VmoduleFlag.Name, err)
+	}
+	log.Root().SetHandler(glogger)
+	return nil
+}
+
+// DBLogger creates the SQL logger configured by the command line flags.
+func DBLogger(ctx *cli.Context) (logger.Interface, error) {
+	level, err := ParseDBLogLevel(ctx.String(DBLogLevelFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	return NewGormLogger(level, ctx.Duration(DBSlowThresholdFlag.Name)), nil
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+// newContext parses the logging flags from the arguments.
+func newContext(t *testing.T, args ...string) *cli.Context {
+	t.Helper()
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range Flags {
+		if err := f.Apply(set); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+// restoreRoot reinstates the root log handler once the test is done.
+func restoreRoot(t *testing.T) {
+	handler := log.Root().GetHandler()
+	t.Cleanup(func() { log.Root().SetHandler(handler) })
+}
+
+func TestSetupVerbosity(t *testing.T) {
+	restoreRoot(t)
+	file := filepath.Join(t.TempDir(), "hdt.log")
+	if err := Setup(newContext(t, "--verbosity", "2", "--log.file", file)); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("below the verbosity")
+	log.Warn("at the verbosity", "key", "value")
+	log.Error("above the verbosity")
+
+	blob, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(blob)
+	if strings.Contains(out, "below the verbosity") {
+		t.Errorf("info line logged at verbosity 2:\n%s", out)
+	}
+	// Files are written as logfmt
+	for _, want := range []string{`msg="at the verbosity" key=value`, `msg="above the verbosity"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestSetupJSON(t *testing.T) {
+	restoreRoot(t)
+	file := filepath.Join(t.TempDir(), "hdt.log")
+	if err := Setup(newContext(t, "--log.json", "--log.file", file)); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("json line", "key", "value")
+
+	blob, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(blob); !strings.Contains(out, `"msg":"json line"`) || !strings.Contains(out, `"key":"value"`) {
+		t.Errorf("not a JSON line: %s", out)
+	}
+}
+
+func TestSetupInvalidVmodule(t *testing.T) {
+	restoreRoot(t)
+	if err := Setup(newContext(t, "--vmodule", "backend=x")); err == nil {
+		t.Error("invalid vmodule accepted")
+	}
+}
+
+func TestDBLoggerLevel(t *testing.T) {
+	if _, err := DBLogger(newContext(t, "--db.log.level", "verbose")); err == nil {
+		t.Error("unknown SQL log level accepted")
+	}
+	if _, err := DBLogger(newContext(t, "--db.log.level", "INFO")); err != nil {
+		t.Error(err)
+	}
+}
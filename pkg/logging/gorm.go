@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ParseDBLogLevel converts a textual SQL logging level into a gorm one.
+func ParseDBLogLevel(level string) (logger.LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "silent":
+		return logger.Silent, nil
+	case "error":
+		return logger.Error, nil
+	case "warn":
+		return logger.Warn, nil
+	case "info":
+		return logger.Info, nil
+	default:
+		return 0, fmt.Errorf("unknown SQL log level %q", level)
+	}
+}
+
+// gormLogger routes gorm's logs into the structured root logger, tagging
+// each line with the request ID carried by the statement context.
+type gormLogger struct {
+	level         logger.LogLevel
+	slowThreshold time.Duration
+}
+
+// NewGormLogger creates a gorm logger emitting at the given level, reporting
+// statements slower than slowThreshold as warnings.
+func NewGormLogger(level logger.LogLevel, slowThreshold time.Duration) logger.Interface {
+	return &gormLogger{level: level, slowThreshold: slowThreshold}
+}
+
+func (l *gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	nl := *l
+	nl.level = level
+	return &nl
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		Ctx(ctx).Info(fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		Ctx(ctx).Warn(fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		Ctx(ctx).Error(fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.level >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		Ctx(ctx).Error("SQL failed", "elapsed", elapsed, "rows", rows, "sql", sql, "err", err)
+	case l.slowThreshold != 0 && elapsed > l.slowThreshold && l.level >= logger.Warn:
+		sql, rows := fc()
+		Ctx(ctx).Warn("Slow SQL", "elapsed", elapsed, "threshold", l.slowThreshold, "rows", rows, "sql", sql)
+	case l.level >= logger.Info:
+		sql, rows := fc()
+		Ctx(ctx).Info("Executed SQL", "elapsed", elapsed, "rows", rows, "sql", sql)
+	}
+}
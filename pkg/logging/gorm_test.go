@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recorder collects the records of the root logger.
+type recorder struct {
+	mu      sync.Mutex
+	records []*log.Record
+}
+
+func record(t *testing.T) *recorder {
+	restoreRoot(t)
+	r := new(recorder)
+	log.Root().SetHandler(log.FuncHandler(func(rec *log.Record) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.records = append(r.records, rec)
+		return nil
+	}))
+	return r
+}
+
+// lines returns the records as "lvl msg key=value..." lines.
+func (r *recorder) lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines := make([]string, len(r.records))
+	for i, rec := range r.records {
+		line := rec.Lvl.String() + " " + rec.Msg
+		for j := 0; j+1 < len(rec.Ctx); j += 2 {
+			line += fmt.Sprintf(" %v=%v", rec.Ctx[j], rec.Ctx[j+1])
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+func TestGormLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     logger.LogLevel
+		threshold time.Duration
+		sql       string
+		want      string // Prefix of the only line logged, none if empty
+	}{
+		{"silent", logger.Silent, time.Nanosecond, "SELECT ?", ""},
+		{"fast", logger.Warn, time.Hour, "SELECT ?", ""},
+		{"slow", logger.Warn, time.Nanosecond, "SELECT ?", "warn Slow SQL"},
+		{"slow below warn", logger.Error, time.Nanosecond, "SELECT ?", ""},
+		{"slow disabled", logger.Warn, 0, "SELECT ?", ""},
+		{"failed", logger.Error, 0, "SELECT * FROM missing WHERE id = ?", "eror SQL failed"},
+		{"failed when silent", logger.Silent, 0, "SELECT * FROM missing WHERE id = ?", ""},
+		{"info", logger.Info, 0, "SELECT ?", "info Executed SQL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := record(t)
+			db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: NewGormLogger(tt.level, tt.threshold)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v string
+			db.WithContext(WithRequestID(context.Background(), "req-1")).Raw(tt.sql, 1).Scan(&v)
+
+			lines := rec.lines()
+			if tt.want == "" {
+				if len(lines) != 0 {
+					t.Fatalf("have %q, want nothing logged", lines)
+				}
+				return
+			}
+			if len(lines) != 1 || !strings.HasPrefix(lines[0], tt.want) {
+				t.Fatalf("have %q, want one %q line", lines, tt.want)
+			}
+			if !strings.Contains(lines[0], "reqid=req-1") {
+				t.Errorf("line %q without the request ID", lines[0])
+			}
+			if !strings.Contains(lines[0], "sql=") {
+				t.Errorf("line %q without the statement", lines[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package upstreamtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/fixtures"
+)
+
+// Fixture reads a bundled fixture, e.g. "ethereum.json".
+func Fixture(t testing.TB, name string) *backend.Fixture {
+	t.Helper()
+	r, err := fixtures.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f, err := backend.ReadFixture(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// NewDevBackend creates an offline backend on an in-memory SQLite database
+// loaded with the fixture, as the --dev mode does.
+func NewDevBackend(t testing.TB, f *backend.Fixture) backend.Backend {
+	t.Helper()
+	b, err := backend.NewDevBackend(context.Background(), &backend.Config{Chain: f.Chain}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// NewBackend creates an online backend on the server, its tables on an
+// in-memory SQLite database loaded with the indexed blocks, if any.
+func NewBackend(t testing.TB, s *Server, chain string, indexed *backend.Fixture) backend.Backend {
+	t.Helper()
+	ctx := context.Background()
+	b, err := backend.NewMixinBackend(ctx, &backend.Config{
+		Chain:    chain,
+		Upstream: s.URL(),
+		DBDSN:    backend.SQLitePrefix + ":memory:",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Migrate(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if indexed != nil {
+		if err := b.LoadFixture(ctx, indexed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
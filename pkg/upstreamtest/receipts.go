@@ -0,0 +1,46 @@
+package upstreamtest
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// BlockReceipts serves eth_getBlockReceipts for the fixture blocks, every
+// transaction using 21000 gas at its effective price, blob transactions
+// paying the blob fee of their block.
+func BlockReceipts(f *backend.Fixture) Handler {
+	blocks := make(map[uint64]*backend.FixtureBlock)
+	for _, block := range f.Blocks {
+		blocks[block.Header.Number.Uint64()] = block
+	}
+	return func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		var number rpc.BlockNumber
+		if err := json.Unmarshal(params[0], &number); err != nil {
+			return nil, err
+		}
+		block := blocks[uint64(number)]
+		receipts := make([]*types.Receipt, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			receipts[i] = &types.Receipt{
+				Type:              tx.Type(),
+				Status:            types.ReceiptStatusSuccessful,
+				TxHash:            tx.Hash(),
+				GasUsed:           21000,
+				EffectiveGasPrice: new(big.Int).Add(block.Header.BaseFee, tx.EffectiveGasTipValue(block.Header.BaseFee)),
+				Logs:              []*types.Log{},
+			}
+			if tx.Type() == types.BlobTxType {
+				receipts[i].BlobGasUsed = tx.BlobGas()
+				receipts[i].BlobGasPrice = eip4844.CalcBlobFee(*block.Header.ExcessBlobGas)
+			}
+		}
+		return receipts, nil
+	}
+}
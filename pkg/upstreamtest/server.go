@@ -0,0 +1,570 @@
+// Package upstreamtest provides an in-process upstream JSON-RPC node serving
+// recorded fixtures, with programmable faults, for deterministic tests of
+// everything talking to the upstream.
+package upstreamtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// Handler serves a method from its raw positional parameters.
+type Handler func(ctx context.Context, params []json.RawMessage) (interface{}, error)
+
+// Error is a JSON-RPC error returned by a handler or an injected fault.
+type Error struct {
+	Code    int
+	Message string
+	Data    interface{}
+}
+
+func (e *Error) Error() string          { return e.Message }
+func (e *Error) ErrorCode() int         { return e.Code }
+func (e *Error) ErrorData() interface{} { return e.Data }
+
+// fault is the misbehaviour programmed for a method.
+type fault struct {
+	latency time.Duration
+	err     error
+	count   int // Remaining failures, negative for all calls
+}
+
+// txLocation locates a transaction in the served blocks.
+type txLocation struct {
+	number uint64
+	index  int
+}
+
+// Server is a fake upstream node. Blocks, transactions and trace_block
+// responses come from the fixtures, other methods can be added with Handle.
+//
+// Faults apply per method, "" programming every method at once.
+type Server struct {
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	blocks    map[uint64]*backend.FixtureBlock
+	txs       map[common.Hash]txLocation
+	pending   map[common.Hash]*types.Transaction
+	head      uint64
+	finalized *uint64
+	handlers  map[string]Handler
+	faults    map[string]*fault
+	calls     map[string]int
+}
+
+// NewServer starts a server serving the blocks of the fixtures.
+func NewServer(fixtures ...*backend.Fixture) *Server {
+	s := &Server{
+		blocks:   make(map[uint64]*backend.FixtureBlock),
+		txs:      make(map[common.Hash]txLocation),
+		pending:  make(map[common.Hash]*types.Transaction),
+		handlers: make(map[string]Handler),
+		faults:   make(map[string]*fault),
+		calls:    make(map[string]int),
+	}
+	for _, f := range fixtures {
+		for _, block := range f.Blocks {
+			s.addBlock(block)
+		}
+	}
+	s.handlers["eth_chainId"] = s.chainID
+	s.handlers["eth_blockNumber"] = s.blockNumber
+	s.handlers["eth_getBlockByNumber"] = s.getBlockByNumber
+	s.handlers["eth_getBlockByHash"] = s.getBlockByHash
+	s.handlers["eth_getTransactionByHash"] = s.getTransactionByHash
+	s.handlers["trace_block"] = s.traceBlock
+	s.handlers["trace_transaction"] = s.traceTransaction
+	s.srv = httptest.NewServer(s)
+	return s
+}
+
+// URL returns the HTTP endpoint of the server.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Handle serves a method with the handler, replacing the built-in one.
+func (s *Server) Handle(method string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// SetLatency delays every response of the method.
+func (s *Server) SetLatency(method string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fault(method).latency = d
+}
+
+// Fail makes the next n calls of the method fail with err, every call if n
+// is negative. A zero n clears the fault.
+func (s *Server) Fail(method string, n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.fault(method)
+	f.err, f.count = err, n
+}
+
+// Reorg replaces the chain from the first given block on with the blocks,
+// dropping the higher ones.
+func (s *Server) Reorg(blocks ...*backend.FixtureBlock) {
+	if len(blocks) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from := blocks[0].Header.Number.Uint64()
+	for number, block := range s.blocks {
+		if number < from {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			delete(s.txs, tx.Hash())
+		}
+		delete(s.blocks, number)
+	}
+	s.head = 0
+	for number := range s.blocks {
+		if number > s.head {
+			s.head = number
+		}
+	}
+	for _, block := range blocks {
+		s.addBlock(block)
+	}
+}
+
+// AddPending adds transactions to the pool, served by hash without a block
+// until a block including them is added.
+func (s *Server) AddPending(txs ...*types.Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tx := range txs {
+		s.pending[tx.Hash()] = tx
+	}
+}
+
+// AddBlock adds a block, the new head if above the current one.
+func (s *Server) AddBlock(block *backend.FixtureBlock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addBlock(block)
+}
+
+// SetFinalized sets the block served as finalized and safe, the head until
+// set.
+func (s *Server) SetFinalized(number uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finalized = &number
+}
+
+// Calls returns the number of calls of the method, of all methods for "".
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if method == "" {
+		total := 0
+		for _, n := range s.calls {
+			total += n
+		}
+		return total
+	}
+	return s.calls[method]
+}
+
+func (s *Server) fault(method string) *fault {
+	f, ok := s.faults[method]
+	if !ok {
+		f = new(fault)
+		s.faults[method] = f
+	}
+	return f
+}
+
+func (s *Server) addBlock(block *backend.FixtureBlock) {
+	number := block.Header.Number.Uint64()
+	s.blocks[number] = block
+	for i, tx := range block.Transactions {
+		s.txs[tx.Hash()] = txLocation{number, i}
+		delete(s.pending, tx.Hash())
+	}
+	if number > s.head {
+		s.head = number
+	}
+}
+
+type request struct {
+	Version string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id,omitempty"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *errorObject    `json:"error,omitempty"`
+}
+
+type errorObject struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// ServeHTTP serves single and batch JSON-RPC requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var (
+		reqs  []*request
+		batch = len(bytes.TrimSpace(body)) > 0 && bytes.TrimSpace(body)[0] == '['
+	)
+	if batch {
+		err = json.Unmarshal(body, &reqs)
+	} else {
+		req := new(request)
+		err = json.Unmarshal(body, req)
+		reqs = []*request{req}
+	}
+	if err != nil {
+		writeJSON(w, &response{Version: "2.0", ID: json.RawMessage("null"), Error: &errorObject{Code: -32700, Message: err.Error()}})
+		return
+	}
+	resps := make([]*response, 0, len(reqs))
+	for _, req := range reqs {
+		resp := s.serve(r.Context(), req)
+		if req.ID != nil {
+			resps = append(resps, resp)
+		}
+	}
+	if batch {
+		writeJSON(w, resps)
+	} else if len(resps) > 0 {
+		writeJSON(w, resps[0])
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) serve(ctx context.Context, req *request) *response {
+	resp := &response{Version: "2.0", ID: req.ID}
+	result, err := s.call(ctx, req.Method, req.Params)
+	if err != nil {
+		obj := &errorObject{Code: -32000, Message: err.Error()}
+		if e, ok := err.(rpc.Error); ok {
+			obj.Code = e.ErrorCode()
+		}
+		if e, ok := err.(rpc.DataError); ok {
+			obj.Data = e.ErrorData()
+		}
+		resp.Error = obj
+		return resp
+	}
+	if result == nil {
+		// Not found results are a null result, not an absent one
+		result = json.RawMessage("null")
+	}
+	resp.Result = result
+	return resp
+}
+
+// call applies the faults of the method and runs its handler.
+func (s *Server) call(ctx context.Context, method string, params []json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	s.calls[method]++
+	var (
+		latency time.Duration
+		err     error
+	)
+	for _, name := range []string{"", method} {
+		f, ok := s.faults[name]
+		if !ok {
+			continue
+		}
+		latency += f.latency
+		if f.err != nil && f.count != 0 && err == nil {
+			err = f.err
+			if f.count > 0 {
+				f.count--
+			}
+		}
+	}
+	handler := s.handlers[method]
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if handler == nil {
+		return nil, &Error{Code: -32601, Message: fmt.Sprintf("the method %s does not exist/is not available", method)}
+	}
+	return handler(ctx, params)
+}
+
+// param decodes the positional parameter into v, absent ones are left as is.
+func param(params []json.RawMessage, i int, v interface{}) error {
+	if i >= len(params) {
+		return nil
+	}
+	if err := json.Unmarshal(params[i], v); err != nil {
+		return &Error{Code: -32602, Message: fmt.Sprintf("invalid argument %d: %v", i, err)}
+	}
+	return nil
+}
+
+// resolve resolves a block number or tag into a served block, nil if absent.
+func (s *Server) resolve(number rpc.BlockNumber) *backend.FixtureBlock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch number {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		return s.blocks[s.head]
+	case rpc.SafeBlockNumber, rpc.FinalizedBlockNumber:
+		if s.finalized != nil {
+			return s.blocks[*s.finalized]
+		}
+		return s.blocks[s.head]
+	case rpc.EarliestBlockNumber:
+		return s.blocks[0]
+	}
+	return s.blocks[uint64(number)]
+}
+
+func (s *Server) chainID(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, block := range s.blocks {
+		for _, tx := range block.Transactions {
+			if tx.Protected() {
+				return (*hexutil.Big)(tx.ChainId()), nil
+			}
+		}
+	}
+	return hexutil.Uint64(1), nil
+}
+
+func (s *Server) blockNumber(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return hexutil.Uint64(s.head), nil
+}
+
+func (s *Server) getBlockByNumber(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var (
+		number rpc.BlockNumber
+		full   bool
+	)
+	if err := param(params, 0, &number); err != nil {
+		return nil, err
+	}
+	if err := param(params, 1, &full); err != nil {
+		return nil, err
+	}
+	block := s.resolve(number)
+	if block == nil {
+		return nil, nil
+	}
+	return marshalBlock(block, full)
+}
+
+func (s *Server) getBlockByHash(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var (
+		hash common.Hash
+		full bool
+	)
+	if err := param(params, 0, &hash); err != nil {
+		return nil, err
+	}
+	if err := param(params, 1, &full); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	var found *backend.FixtureBlock
+	for _, block := range s.blocks {
+		if block.Header.Hash() == hash {
+			found = block
+			break
+		}
+	}
+	s.mu.Unlock()
+	if found == nil {
+		return nil, nil
+	}
+	return marshalBlock(found, full)
+}
+
+func (s *Server) getTransactionByHash(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var hash common.Hash
+	if err := param(params, 0, &hash); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	loc, ok := s.txs[hash]
+	block := s.blocks[loc.number]
+	pending := s.pending[hash]
+	s.mu.Unlock()
+	if pending != nil {
+		return marshalPending(pending)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return marshalTransaction(block, loc.index)
+}
+
+func (s *Server) traceBlock(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var number rpc.BlockNumber
+	if err := param(params, 0, &number); err != nil {
+		return nil, err
+	}
+	block := s.resolve(number)
+	if block == nil {
+		return nil, nil
+	}
+	return blockTraces(block, nil), nil
+}
+
+func (s *Server) traceTransaction(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var hash common.Hash
+	if err := param(params, 0, &hash); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	loc, ok := s.txs[hash]
+	block := s.blocks[loc.number]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	return blockTraces(block, &hash), nil
+}
+
+// blockTraces returns the frames of the block, of one transaction if given,
+// carrying the hash of the block as served.
+func blockTraces(block *backend.FixtureBlock, txHash *common.Hash) []*backend.CallFrame {
+	hash := block.Header.Hash()
+	frames := make([]*backend.CallFrame, 0, len(block.Traces))
+	for _, frame := range block.Traces {
+		if txHash != nil && (frame.TransactionHash == nil || *frame.TransactionHash != *txHash) {
+			continue
+		}
+		cpy := *frame
+		cpy.BlockHash = &hash
+		frames = append(frames, &cpy)
+	}
+	return frames
+}
+
+// marshalBlock encodes the block as eth_getBlockBy* does.
+func marshalBlock(block *backend.FixtureBlock, full bool) (json.RawMessage, error) {
+	fields, err := objectFields(block.Header)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]interface{}, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		if !full {
+			txs[i] = tx.Hash()
+			continue
+		}
+		if txs[i], err = marshalTransaction(block, i); err != nil {
+			return nil, err
+		}
+	}
+	fields["transactions"] = txs
+	fields["uncles"] = []common.Hash{}
+	if block.Header.WithdrawalsHash != nil {
+		withdrawals := block.Withdrawals
+		if withdrawals == nil {
+			withdrawals = []*types.Withdrawal{}
+		}
+		fields["withdrawals"] = withdrawals
+	}
+	return json.Marshal(fields)
+}
+
+// marshalTransaction encodes a transaction of the block as
+// eth_getTransactionByHash does.
+func marshalTransaction(block *backend.FixtureBlock, index int) (json.RawMessage, error) {
+	tx := block.Transactions[index]
+	fields, err := objectFields(tx)
+	if err != nil {
+		return nil, err
+	}
+	fields["blockHash"] = block.Header.Hash()
+	fields["blockNumber"] = (*hexutil.Big)(block.Header.Number)
+	fields["transactionIndex"] = hexutil.Uint64(index)
+	if from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+		fields["from"] = from
+	}
+	return json.Marshal(fields)
+}
+
+// marshalPending encodes a pool transaction, without block fields.
+func marshalPending(tx *types.Transaction) (json.RawMessage, error) {
+	fields, err := objectFields(tx)
+	if err != nil {
+		return nil, err
+	}
+	fields["blockHash"] = nil
+	fields["blockNumber"] = nil
+	fields["transactionIndex"] = nil
+	if from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+		fields["from"] = from
+	}
+	return json.Marshal(fields)
+}
+
+// objectFields marshals v into the fields of a JSON object.
+func objectFields(v interface{}) (map[string]interface{}, error) {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		fields[k] = v
+	}
+	return fields, nil
+}
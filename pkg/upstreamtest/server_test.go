@@ -0,0 +1,149 @@
+package upstreamtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+func dial(t *testing.T, s *Server) *ethclient.Client {
+	t.Helper()
+	ec, err := ethclient.Dial(s.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ec.Close)
+	return ec
+}
+
+func TestServeFixtures(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		fixture = Fixture(t, "ethereum.json")
+		s       = NewServer(fixture)
+		ec      = dial(t, s)
+	)
+	defer s.Close()
+
+	for _, want := range fixture.Blocks {
+		block, err := ec.BlockByNumber(ctx, want.Header.Number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Hash() != want.Header.Hash() || len(block.Transactions()) != len(want.Transactions) {
+			t.Errorf("block %d: %s with %d transactions, want %s with %d", want.Header.Number, block.Hash(), len(block.Transactions()), want.Header.Hash(), len(want.Transactions))
+		}
+		for _, tx := range want.Transactions {
+			have, pending, err := ec.TransactionByHash(ctx, tx.Hash())
+			if err != nil || pending || have.Hash() != tx.Hash() {
+				t.Errorf("transaction %s: %v pending %v", tx.Hash(), err, pending)
+			}
+		}
+		var frames []*backend.CallFrame
+		if err := ec.Client().CallContext(ctx, &frames, "trace_block", rpc.BlockNumber(want.Header.Number.Int64())); err != nil {
+			t.Fatal(err)
+		}
+		if len(frames) != len(want.Traces) {
+			t.Errorf("block %d: %d frames, want %d", want.Header.Number, len(frames), len(want.Traces))
+		}
+	}
+	head, err := ec.BlockNumber(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fixture.Blocks[len(fixture.Blocks)-1].Header.Number.Uint64(); head != want {
+		t.Errorf("head %d, want %d", head, want)
+	}
+	if _, err := ec.BlockByNumber(ctx, big.NewInt(1)); !errors.Is(err, ethereum.NotFound) {
+		t.Errorf("missing block: have %v, want not found", err)
+	}
+	if n := s.Calls("eth_getBlockByNumber"); n != len(fixture.Blocks)+1 {
+		t.Errorf("counted %d block calls, want %d", n, len(fixture.Blocks)+1)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		fixture = Fixture(t, "ethereum.json")
+		s       = NewServer(fixture)
+		ec      = dial(t, s)
+		number  = fixture.Blocks[0].Header.Number
+	)
+	defer s.Close()
+
+	// Errors for a number of calls, with their code
+	s.Fail("eth_getBlockByNumber", 2, &Error{Code: -32005, Message: "limit exceeded"})
+	for i := 0; i < 2; i++ {
+		_, err := ec.BlockByNumber(ctx, number)
+		var rpcErr rpc.Error
+		if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != -32005 {
+			t.Fatalf("call %d: have %v, want limit exceeded", i, err)
+		}
+	}
+	if _, err := ec.BlockByNumber(ctx, number); err != nil {
+		t.Fatalf("fault outlived its count: %v", err)
+	}
+
+	// Latency hitting the caller deadline
+	s.SetLatency("", 200*time.Millisecond)
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := ec.BlockNumber(tctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow call: have %v, want deadline exceeded", err)
+	}
+	s.SetLatency("", 0)
+
+	// Unknown and custom methods
+	var result string
+	if err := ec.Client().CallContext(ctx, &result, "debug_unknown"); err == nil {
+		t.Error("unknown method served")
+	}
+	s.Handle("web3_clientVersion", func(context.Context, []json.RawMessage) (interface{}, error) {
+		return "upstreamtest", nil
+	})
+	if err := ec.Client().CallContext(ctx, &result, "web3_clientVersion"); err != nil || result != "upstreamtest" {
+		t.Errorf("custom method: have %q %v", result, err)
+	}
+}
+
+func TestReorg(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		fixture = Fixture(t, "ethereum.json")
+		s       = NewServer(fixture)
+		ec      = dial(t, s)
+		first   = fixture.Blocks[0]
+	)
+	defer s.Close()
+
+	// Replace the chain from the second block on with an empty sibling
+	header := types.CopyHeader(fixture.Blocks[1].Header)
+	header.Extra = []byte("uncled")
+	header.TxHash = types.EmptyTxsHash
+	s.Reorg(&backend.FixtureBlock{Header: header})
+
+	block, err := ec.BlockByNumber(ctx, header.Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Hash() != header.Hash() || block.ParentHash() != first.Header.Hash() {
+		t.Errorf("reorged block %s, want %s", block.Hash(), header.Hash())
+	}
+	if head, _ := ec.BlockNumber(ctx); head != header.Number.Uint64() {
+		t.Errorf("head %d after reorg, want %d", head, header.Number)
+	}
+	if _, _, err := ec.TransactionByHash(ctx, fixture.Blocks[1].Transactions[0].Hash()); !errors.Is(err, ethereum.NotFound) {
+		t.Errorf("reorged out transaction: have %v, want not found", err)
+	}
+}
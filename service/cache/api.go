@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// AdminAPI is the collection of administrative methods of the response cache.
+type AdminAPI struct {
+	cache *Cache
+}
+
+// NewAdminAPI creates the admin API of the given cache.
+func NewAdminAPI(cache *Cache) *AdminAPI {
+	return &AdminAPI{cache: cache}
+}
+
+// CacheStats describes the current content of the response cache.
+type CacheStats struct {
+	Enabled bool           `json:"enabled"`
+	Entries int            `json:"entries"`
+	Size    hexutil.Uint64 `json:"size"`
+}
+
+// CacheStats returns the number of cached responses and their total size.
+func (api *AdminAPI) CacheStats() CacheStats {
+	entries, size := api.cache.Stats()
+	return CacheStats{Enabled: api.cache != nil, Entries: entries, Size: hexutil.Uint64(size)}
+}
+
+// PurgeCache removes the cached responses of the given method (e.g.
+// "trace_block"), or all responses if no method is given. It returns the
+// number of removed entries.
+func (api *AdminAPI) PurgeCache(method *string) int {
+	var m string
+	if method != nil {
+		m = *method
+	}
+	return api.cache.Purge(m)
+}
+
+// APIs return the collection of RPC services the cache package offers.
+func APIs(cache *Cache) []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "admin",
+			Service:   NewAdminAPI(cache),
+		},
+	}
+}
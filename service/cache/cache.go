@@ -0,0 +1,176 @@
+// Package cache implements a response cache for RPC results which can no
+// longer change, i.e. those derived from blocks at or below the finalized
+// height of the chain.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+const (
+	// finalizedRefresh is the interval at which the finalized height is
+	// refreshed from the backend.
+	finalizedRefresh = 12 * time.Second
+)
+
+// Config contains the settings of the response cache.
+type Config struct {
+	Type          string // Storage backend: "memory", "disk" or empty to disable caching
+	Dir           string // Directory of the disk storage
+	MaxSize       uint64 // Maximum total size of cached responses in bytes
+	Confirmations uint64 // If non zero, treat blocks this deep below the head as final instead of using the "finalized" tag
+}
+
+// Cache stores marshalled RPC results keyed by method and canonicalised
+// parameters. A nil *Cache is valid and caches nothing.
+type Cache struct {
+	store         Store
+	backend       backend.Backend
+	confirmations uint64
+
+	lock      sync.Mutex
+	finalized uint64
+	updated   time.Time
+}
+
+// New creates a response cache as configured, returning nil if the cache
+// is disabled.
+func New(cfg *Config, b backend.Backend) (*Cache, error) {
+	var (
+		store Store
+		err   error
+	)
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case "memory":
+		store = newMemoryStore(cfg.MaxSize)
+	case "disk":
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("disk response cache requires a directory")
+		}
+		if store, err = newDiskStore(cfg.Dir, cfg.MaxSize); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown response cache type %q", cfg.Type)
+	}
+	log.Info("Enabled response cache", "type", cfg.Type, "size", cfg.MaxSize, "confirmations", cfg.Confirmations)
+	return &Cache{store: store, backend: b, confirmations: cfg.Confirmations}, nil
+}
+
+// Key returns the cache key of a method called with the given parameters.
+// Parameters are canonicalised by their JSON encoding, so equivalent inputs
+// (e.g. differently cased hashes) share the same key.
+func Key(method string, params ...interface{}) (string, error) {
+	blob, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(blob)
+	return method + "/" + hex.EncodeToString(hash[:]), nil
+}
+
+// Get looks up the result of method called with params, decoding it into
+// result. It reports whether the lookup was a hit.
+func (c *Cache) Get(ctx context.Context, result interface{}, method string, params ...interface{}) bool {
+	if c == nil {
+		return false
+	}
+	key, err := Key(method, params...)
+	if err != nil {
+		return false
+	}
+	blob, ok := c.store.Get(key)
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(blob, result); err != nil {
+		logging.Ctx(ctx).Warn("Failed to decode cached response", "method", method, "err", err)
+		return false
+	}
+	logging.Ctx(ctx).Debug("Served response from cache", "method", method)
+	return true
+}
+
+// Put stores the result of method called with params, if the block it was
+// derived from is final.
+func (c *Cache) Put(ctx context.Context, number uint64, result interface{}, method string, params ...interface{}) {
+	if c == nil {
+		return
+	}
+	finalized, err := c.Finalized(ctx)
+	if err != nil {
+		logging.Ctx(ctx).Debug("Failed to resolve finalized block", "err", err)
+		return
+	}
+	if number > finalized {
+		return
+	}
+	key, err := Key(method, params...)
+	if err != nil {
+		return
+	}
+	blob, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	if err := c.store.Put(key, blob); err != nil {
+		logging.Ctx(ctx).Warn("Failed to cache response", "method", method, "err", err)
+	}
+}
+
+// Finalized returns the highest block number considered final, refreshing
+// it from the backend if the last known value is stale.
+func (c *Cache) Finalized(ctx context.Context) (uint64, error) {
+	c.lock.Lock()
+	finalized, fresh := c.finalized, time.Since(c.updated) < finalizedRefresh
+	c.lock.Unlock()
+	if fresh {
+		return finalized, nil
+	}
+	// Resolved without the lock, concurrent refreshes are harmless
+	number, err := backend.FinalizedNumber(ctx, c.backend, c.confirmations)
+	if err != nil {
+		return 0, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if number > c.finalized {
+		c.finalized = number
+	}
+	c.updated = time.Now()
+	return c.finalized, nil
+}
+
+// Purge removes the cached results of the given method, or all of them if
+// method is empty.
+func (c *Cache) Purge(method string) int {
+	if c == nil {
+		return 0
+	}
+	prefix := ""
+	if method != "" {
+		prefix = method + "/"
+	}
+	return c.store.Purge(prefix)
+}
+
+// Stats returns the number of cached entries and their total size.
+func (c *Cache) Stats() (int, uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	return c.store.Stats()
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// finalizedBackend serves the finalized header only, counting the lookups.
+type finalizedBackend struct {
+	backend.Backend
+
+	mu     sync.Mutex
+	number uint64
+	calls  int
+}
+
+func (b *finalizedBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls++
+	return &types.Header{Number: new(big.Int).SetUint64(b.number)}, nil
+}
+
+func TestPutFinalizedOnly(t *testing.T) {
+	var (
+		ctx = context.Background()
+		b   = &finalizedBackend{number: 100}
+	)
+	c, err := New(&Config{Type: "memory", MaxSize: 1 << 20}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(ctx, 100, "final", "trace_block", 100)
+	c.Put(ctx, 101, "unfinalized", "trace_block", 101)
+
+	var result string
+	if !c.Get(ctx, &result, "trace_block", 100) || result != "final" {
+		t.Errorf("finalized block not cached: %q", result)
+	}
+	if c.Get(ctx, &result, "trace_block", 101) {
+		t.Error("block above the finalized one cached")
+	}
+	if b.calls != 1 {
+		t.Errorf("finalized block resolved %d times, want 1", b.calls)
+	}
+
+	// With confirmations the head is the reference
+	c, err = New(&Config{Type: "memory", MaxSize: 1 << 20, Confirmations: 10}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(ctx, 91, "unconfirmed", "trace_block", 91)
+	c.Put(ctx, 90, "confirmed", "trace_block", 90)
+	if c.Get(ctx, &result, "trace_block", 91) {
+		t.Error("block with too few confirmations cached")
+	}
+	if !c.Get(ctx, &result, "trace_block", 90) || result != "confirmed" {
+		t.Errorf("confirmed block not cached: %q", result)
+	}
+
+	// A nil cache is a no-op
+	var nilCache *Cache
+	nilCache.Put(ctx, 1, "x", "trace_block", 1)
+	if nilCache.Get(ctx, &result, "trace_block", 1) {
+		t.Error("nil cache hit")
+	}
+}
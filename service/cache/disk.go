@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// diskStore keeps every entry in its own file below a directory, grouped by
+// the method prefix of the key. An in-memory index tracks recency and sizes
+// so the total size can be kept under the limit.
+type diskStore struct {
+	dir     string
+	lock    sync.Mutex
+	index   lru.BasicLRU[string, uint64]
+	size    uint64
+	maxSize uint64
+}
+
+func newDiskStore(dir string, maxSize uint64) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &diskStore{
+		dir:     dir,
+		index:   lru.NewBasicLRU[string, uint64](1 << 30),
+		maxSize: maxSize,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load rebuilds the index from the files left by a previous run, oldest
+// first so that recency survives restarts approximately.
+func (s *diskStore) load() error {
+	type entry struct {
+		key  string
+		info os.FileInfo
+	}
+	var entries []entry
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: filepath.ToSlash(rel), info: info})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].info.ModTime().Before(entries[j].info.ModTime())
+	})
+	for _, e := range entries {
+		s.index.Add(e.key, uint64(e.info.Size()))
+		s.size += uint64(e.info.Size())
+	}
+	s.evict()
+	log.Info("Loaded disk response cache", "dir", s.dir, "entries", s.index.Len(), "size", s.size)
+	return nil
+}
+
+func (s *diskStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s *diskStore) Get(key string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.index.Get(key); !ok {
+		return nil, false
+	}
+	blob, err := os.ReadFile(s.path(key))
+	if err != nil {
+		log.Warn("Failed to read cached response", "key", key, "err", err)
+		s.remove(key)
+		return nil, false
+	}
+	return blob, true
+}
+
+func (s *diskStore) Put(key string, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	size := uint64(len(value))
+	if size > s.maxSize {
+		return nil
+	}
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never observe partial entries
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, value, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if old, ok := s.index.Peek(key); ok {
+		s.size -= old
+	}
+	s.index.Add(key, size)
+	s.size += size
+	s.evict()
+	return nil
+}
+
+// evict drops the least recently used entries until the size limit is met.
+func (s *diskStore) evict() {
+	for s.size > s.maxSize {
+		key, _, ok := s.index.GetOldest()
+		if !ok {
+			return
+		}
+		s.remove(key)
+	}
+}
+
+func (s *diskStore) remove(key string) {
+	size, ok := s.index.Peek(key)
+	if !ok {
+		return
+	}
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		log.Warn("Failed to remove cached response", "key", key, "err", err)
+	}
+	s.index.Remove(key)
+	s.size -= size
+}
+
+func (s *diskStore) Purge(prefix string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var removed int
+	for _, key := range s.index.Keys() {
+		if strings.HasPrefix(key, prefix) {
+			s.remove(key)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (s *diskStore) Stats() (int, uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.index.Len(), s.size
+}
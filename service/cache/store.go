@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/lru"
+)
+
+// Store is a size bounded key-value store holding marshalled RPC responses.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get retrieves the value stored under key.
+	Get(key string) ([]byte, bool)
+
+	// Put stores the value under key, evicting the least recently used
+	// entries if the size limit is exceeded.
+	Put(key string, value []byte) error
+
+	// Purge removes all entries whose key starts with the given prefix and
+	// returns the number of removed entries.
+	Purge(prefix string) int
+
+	// Stats returns the number of entries and their total size in bytes.
+	Stats() (entries int, size uint64)
+}
+
+// memoryStore is an in-memory LRU store bounded by the total value size.
+type memoryStore struct {
+	lock    sync.Mutex
+	lru     lru.BasicLRU[string, []byte]
+	size    uint64
+	maxSize uint64
+}
+
+func newMemoryStore(maxSize uint64) *memoryStore {
+	return &memoryStore{
+		// The capacity is checked by size, the item limit is just a safety net
+		lru:     lru.NewBasicLRU[string, []byte](1 << 30),
+		maxSize: maxSize,
+	}
+}
+
+func (s *memoryStore) Get(key string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.lru.Get(key)
+}
+
+func (s *memoryStore) Put(key string, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	size := uint64(len(key) + len(value))
+	if size > s.maxSize {
+		return nil
+	}
+	if old, ok := s.lru.Peek(key); ok {
+		s.size -= uint64(len(key) + len(old))
+	}
+	s.lru.Add(key, value)
+	s.size += size
+	for s.size > s.maxSize {
+		k, v, ok := s.lru.RemoveOldest()
+		if !ok {
+			break
+		}
+		s.size -= uint64(len(k) + len(v))
+	}
+	return nil
+}
+
+func (s *memoryStore) Purge(prefix string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var removed int
+	for _, k := range s.lru.Keys() {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		v, _ := s.lru.Peek(k)
+		s.lru.Remove(k)
+		s.size -= uint64(len(k) + len(v))
+		removed++
+	}
+	return removed
+}
+
+func (s *memoryStore) Stats() (int, uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.lru.Len(), s.size
+}
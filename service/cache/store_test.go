@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testStore(t *testing.T, s Store) {
+	if err := s.Put("trace_block/a", bytes.Repeat([]byte{1}, 40)); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := s.Put("trace_block/b", bytes.Repeat([]byte{2}, 40)); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	// Touch a so b becomes the least recently used entry
+	if _, ok := s.Get("trace_block/a"); !ok {
+		t.Fatalf("missing entry a")
+	}
+	if err := s.Put("eth_getBlockByNumber/c", bytes.Repeat([]byte{3}, 40)); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if _, ok := s.Get("trace_block/b"); ok {
+		t.Errorf("entry b should have been evicted")
+	}
+	if blob, ok := s.Get("eth_getBlockByNumber/c"); !ok || blob[0] != 3 {
+		t.Errorf("entry c mismatch: %v %v", ok, blob)
+	}
+	if n := s.Purge("trace_block/"); n != 1 {
+		t.Errorf("purged entries mismatch: have %d, want 1", n)
+	}
+	if entries, _ := s.Stats(); entries != 1 {
+		t.Errorf("entries mismatch: have %d, want 1", entries)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, newMemoryStore(128))
+}
+
+func TestDiskStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newDiskStore(dir, 100)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	testStore(t, s)
+
+	// Reopening the store must recover the remaining entry
+	s, err = newDiskStore(dir, 100)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if entries, size := s.Stats(); entries != 1 || size != 40 {
+		t.Errorf("reopened stats mismatch: have %d/%d, want 1/40", entries, size)
+	}
+}
+
+func TestKeyCanonical(t *testing.T) {
+	a, _ := Key("trace_transaction", map[string]interface{}{"b": 1, "a": 2})
+	b, _ := Key("trace_transaction", map[string]interface{}{"a": 2, "b": 1})
+	if a != b {
+		t.Errorf("keys of equivalent params differ: %s != %s", a, b)
+	}
+}
@@ -0,0 +1,149 @@
+package decoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+const (
+	// defaultListSize is the number of ABIs listed if no limit is given.
+	defaultListSize = 100
+
+	// maxListSize is the maximum number of ABIs listed by a single call.
+	maxListSize = 1000
+)
+
+// errUploadsDisabled is returned by the write methods unless the node
+// explicitly allows them, as the registry has no authentication of its own.
+var errUploadsDisabled = errors.New("ABI uploads are disabled, enable them with --abi.upload")
+
+// RegistryEntry is a stored ABI, the ABI itself is omitted from listings.
+type RegistryEntry struct {
+	Address   common.Address  `json:"address"`
+	Name      string          `json:"name,omitempty"`
+	ABI       json.RawMessage `json:"abi,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+func newRegistryEntry(row *backend.ContractABI) *RegistryEntry {
+	entry := &RegistryEntry{
+		Address:   common.HexToAddress(row.Address),
+		Name:      row.Name,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+	}
+	if row.ABI != "" {
+		entry.ABI = json.RawMessage(row.ABI)
+	}
+	return entry
+}
+
+// ListOptions are the paging arguments of List.
+type ListOptions struct {
+	Offset hexutil.Uint64  `json:"offset"`
+	Limit  *hexutil.Uint64 `json:"limit"`
+}
+
+// API is the collection of ABI registry methods.
+type API struct {
+	registry *DBRegistry
+	uploads  bool
+}
+
+// NewAPI creates a new API definition for the ABI registry methods, the
+// registry is read-only unless uploads are allowed.
+func NewAPI(registry *DBRegistry, uploads bool) *API {
+	return &API{registry: registry, uploads: uploads}
+}
+
+// abiContent accepts an ABI either as JSON or as a string holding the JSON,
+// the way most tools export it.
+func abiContent(raw json.RawMessage) (string, error) {
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+	return string(raw), nil
+}
+
+// Upload stores the ABI of a contract, replacing any previous one.
+func (api *API) Upload(ctx context.Context, address common.Address, abi json.RawMessage, name *string) (bool, error) {
+	if !api.uploads {
+		return false, errUploadsDisabled
+	}
+	content, err := abiContent(abi)
+	if err != nil {
+		return false, err
+	}
+	var n string
+	if name != nil {
+		n = *name
+	}
+	if err := api.registry.Put(ctx, address, n, content); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Get returns the stored ABI of a contract, or null if there is none.
+func (api *API) Get(ctx context.Context, address common.Address) (*RegistryEntry, error) {
+	row, err := api.registry.Get(ctx, address)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	return newRegistryEntry(row), nil
+}
+
+// List returns a page of the stored ABIs, ordered by address.
+func (api *API) List(ctx context.Context, opts *ListOptions) ([]*RegistryEntry, error) {
+	if opts == nil {
+		opts = new(ListOptions)
+	}
+	limit := defaultListSize
+	if opts.Limit != nil {
+		if *opts.Limit == 0 || *opts.Limit > maxListSize {
+			return nil, fmt.Errorf("limit must be within [1, %d]", maxListSize)
+		}
+		limit = int(*opts.Limit)
+	}
+	rows, err := api.registry.List(ctx, int(opts.Offset), limit)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*RegistryEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = newRegistryEntry(row)
+	}
+	return entries, nil
+}
+
+// Delete removes the ABI of a contract, reporting whether there was one.
+func (api *API) Delete(ctx context.Context, address common.Address) (bool, error) {
+	if !api.uploads {
+		return false, errUploadsDisabled
+	}
+	return api.registry.Delete(ctx, address)
+}
+
+// APIs return the collection of RPC services the decoder package offers.
+func APIs(registry *DBRegistry, uploads bool) []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "abi",
+			Service:   NewAPI(registry, uploads),
+		},
+	}
+}
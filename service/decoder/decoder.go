@@ -0,0 +1,274 @@
+// Package decoder annotates call frames with their ABI decoding, using the
+// ABIs of a registry and falling back to a 4-byte signature database. It also
+// serves the registry, stored in the backend database.
+package decoder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+// Decoder decodes the inputs and outputs of call frames.
+type Decoder struct {
+	backend    backend.Backend
+	registry   Registry
+	signatures *Signatures
+}
+
+// New creates a decoder, the registry is optional. The backend is used to
+// classify proxies, it may be nil.
+func New(backend backend.Backend, registry Registry, signatures *Signatures) *Decoder {
+	return &Decoder{backend: backend, registry: registry, signatures: signatures}
+}
+
+// DecodeFrames sets the decoding of every call frame carrying a selector.
+// Calls to proxies are decoded against the ABI of their implementation.
+func (d *Decoder) DecodeFrames(ctx context.Context, frames []*backend.CallFrame) {
+	var (
+		abis    = make(map[common.Address]*abi.ABI)
+		proxies = make(map[[2]common.Address]string)
+		forward = forwards(frames)
+	)
+	lookup := func(address common.Address) *abi.ABI {
+		parsed, ok := abis[address]
+		if !ok && d.registry != nil {
+			var err error
+			if parsed, err = d.registry.ABI(ctx, address); err != nil {
+				logging.Ctx(ctx).Debug("Failed to look up ABI", "address", address, "err", err)
+			}
+			abis[address] = parsed
+		}
+		return parsed
+	}
+	candidates := make(map[*backend.CallFrame][]*abi.ABI)
+	for _, frame := range frames {
+		action := frame.Action
+		if action.To == nil || (action.Input == nil && frame.RevertReason == nil) {
+			continue
+		}
+		candidates[frame] = []*abi.ABI{lookup(*action.To)}
+		var proxy *backend.ProxyInfo
+		if impl, ok := implementation(forward, frame); ok {
+			key := [2]common.Address{*action.To, impl}
+			typ, ok := proxies[key]
+			if !ok {
+				typ = d.proxyType(ctx, *action.To, impl, frame.BlockNumber)
+				proxies[key] = typ
+			}
+			proxy = &backend.ProxyInfo{Type: typ, Implementation: impl}
+			// The proxy's own ABI only covers its administrative functions
+			candidates[frame] = append([]*abi.ABI{lookup(impl)}, candidates[frame]...)
+		}
+		if action.Input != nil && len(*action.Input) >= 4 {
+			frame.Decoded = d.decode(candidates[frame], frame)
+			frame.Decoded.Proxy = proxy
+		}
+	}
+	// Custom errors bubble up from deeper frames, so after the ABIs of the
+	// frame itself try the ones of its subcalls: the reverted ones first, as
+	// the revert data came from one of them, each group depth-first.
+	for frame, own := range candidates {
+		if reason := frame.RevertReason; reason != nil && reason.Kind == backend.RevertUnknown && frame.Result != nil && frame.Result.Output != nil {
+			abis := append([]*abi.ABI(nil), own...)
+			for _, sub := range subcalls(frames, frame) {
+				abis = append(abis, candidates[sub]...)
+			}
+			d.decodeRevert(abis, reason, *frame.Result.Output)
+		}
+	}
+}
+
+// subcalls returns the frames below the given one in its transaction, the
+// reverted ones first, each group in depth-first order.
+func subcalls(frames []*backend.CallFrame, parent *backend.CallFrame) []*backend.CallFrame {
+	var subs []*backend.CallFrame
+	for _, frame := range frames {
+		if frame.BlockNumber != parent.BlockNumber || frameKey(frame, nil) != frameKey(parent, nil) {
+			continue
+		}
+		if len(frame.TraceAddress) <= len(parent.TraceAddress) || backend.CompareTraceAddress(frame.TraceAddress[:len(parent.TraceAddress)], parent.TraceAddress) != 0 {
+			continue
+		}
+		subs = append(subs, frame)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if ri, rj := subs[i].Error != "", subs[j].Error != ""; ri != rj {
+			return ri
+		}
+		return backend.CompareTraceAddress(subs[i].TraceAddress, subs[j].TraceAddress) < 0
+	})
+	return subs
+}
+
+// decodeRevert decodes the custom error of the revert data with the first
+// ABI knowing it, otherwise with the first matching signature.
+func (d *Decoder) decodeRevert(abis []*abi.ABI, reason *backend.RevertReason, data []byte) {
+	if len(data) < 4 {
+		return
+	}
+	var selector [4]byte
+	copy(selector[:], data)
+	for _, parsed := range abis {
+		if parsed == nil {
+			continue
+		}
+		abiErr, err := parsed.ErrorByID(selector)
+		if err != nil {
+			continue
+		}
+		values, err := abiErr.Inputs.Unpack(data[4:])
+		if err != nil {
+			continue
+		}
+		reason.Kind = backend.RevertCustom
+		reason.Signature = abiErr.Sig
+		reason.Message = abiErr.Name
+		reason.Inputs = formatArguments(abiErr.Inputs, values, true)
+		return
+	}
+	for _, method := range d.signatures.Lookup(selector[:]) {
+		values, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			continue
+		}
+		reason.Kind = backend.RevertCustom
+		reason.Signature = method.Sig
+		reason.Message = method.RawName
+		reason.Inputs = formatArguments(method.Inputs, values, false)
+		return
+	}
+}
+
+// decode decodes a frame with the first ABI knowing its selector, otherwise
+// with the first matching signature.
+func (d *Decoder) decode(abis []*abi.ABI, frame *backend.CallFrame) *backend.DecodedCall {
+	var (
+		input    = *frame.Action.Input
+		selector = input[:4]
+	)
+	var output []byte
+	if frame.Error == "" && frame.Result != nil && frame.Result.Output != nil {
+		output = *frame.Result.Output
+	}
+	for _, parsed := range abis {
+		if parsed == nil {
+			continue
+		}
+		if method, err := parsed.MethodById(selector); err == nil {
+			return decodeMethod(method, backend.DecodedFromABI, input, output)
+		}
+	}
+	var fallback *backend.DecodedCall
+	for _, method := range d.signatures.Lookup(selector) {
+		// Colliding selectors are told apart by re-encoding the arguments
+		decoded := decodeMethod(method, backend.DecodedFromSignature, input, nil)
+		if decoded.Error != "" {
+			continue
+		}
+		if exact(method, input) {
+			return decoded
+		}
+		if fallback == nil {
+			fallback = decoded
+		}
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return &backend.DecodedCall{Selector: common.CopyBytes(selector), Source: backend.DecodedFromSelector}
+}
+
+// exact reports whether the arguments encode back into the same input.
+func exact(method *abi.Method, input []byte) bool {
+	values, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return false
+	}
+	packed, err := method.Inputs.Pack(values...)
+	return err == nil && bytes.Equal(packed, input[4:])
+}
+
+func decodeMethod(method *abi.Method, source string, input, output []byte) *backend.DecodedCall {
+	decoded := &backend.DecodedCall{
+		Selector:  common.CopyBytes(input[:4]),
+		Signature: method.Sig,
+		Source:    source,
+	}
+	values, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		decoded.Error = fmt.Sprintf("inputs: %v", err)
+		return decoded
+	}
+	// Arguments of text signatures carry placeholder names only
+	named := source == backend.DecodedFromABI
+	decoded.Inputs = formatArguments(method.Inputs, values, named)
+	if len(output) == 0 || len(method.Outputs) == 0 {
+		return decoded
+	}
+	if values, err = method.Outputs.Unpack(output); err != nil {
+		decoded.Error = fmt.Sprintf("outputs: %v", err)
+		return decoded
+	}
+	decoded.Outputs = formatArguments(method.Outputs, values, named)
+	return decoded
+}
+
+func formatArguments(args abi.Arguments, values []interface{}, named bool) []backend.DecodedValue {
+	formatted := make([]backend.DecodedValue, len(values))
+	for i, value := range values {
+		formatted[i] = backend.DecodedValue{
+			Type:  args[i].Type.String(),
+			Value: formatValue(args[i].Type, value, named),
+		}
+		if named {
+			formatted[i].Name = args[i].Name
+		}
+	}
+	return formatted
+}
+
+// formatValue converts an unpacked value into its JSON friendly form.
+func formatValue(t abi.Type, value interface{}, named bool) interface{} {
+	rv := reflect.ValueOf(value)
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		// Integers beyond 53 bits lose precision as JSON numbers
+		return fmt.Sprint(value)
+	case abi.BytesTy:
+		return hexutil.Bytes(rv.Bytes())
+	case abi.FixedBytesTy, abi.FunctionTy:
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return hexutil.Bytes(b)
+	case abi.SliceTy, abi.ArrayTy:
+		elems := make([]interface{}, rv.Len())
+		for i := range elems {
+			elems[i] = formatValue(*t.Elem, rv.Index(i).Interface(), named)
+		}
+		return elems
+	case abi.TupleTy:
+		fields := make([]backend.DecodedValue, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			fields[i] = backend.DecodedValue{
+				Type:  elem.String(),
+				Value: formatValue(*elem, rv.Field(i).Interface(), named),
+			}
+			if named {
+				fields[i].Name = t.TupleRawNames[i]
+			}
+		}
+		return fields
+	default:
+		return value
+	}
+}
@@ -0,0 +1,263 @@
+package decoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+const erc20ABI = `[{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"ok","type":"bool"}]}]`
+
+type mapRegistry map[common.Address]*abi.ABI
+
+func (r mapRegistry) ABI(ctx context.Context, address common.Address) (*abi.ABI, error) {
+	return r[address], nil
+}
+
+func TestDecodeFrames(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(erc20ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		token     = common.HexToAddress("0xaa")
+		unknown   = common.HexToAddress("0xbb")
+		recipient = common.HexToAddress("0xcc")
+		amount, _ = new(big.Int).SetString("100000000000000000000", 10)
+	)
+	input, err := parsed.Pack("transfer", recipient, amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := common.LeftPadBytes([]byte{1}, 32)
+	garbage := []byte{0xde, 0xad, 0xbe, 0xef, 0x01}
+	frame := func(to common.Address, input []byte) *backend.CallFrame {
+		return &backend.CallFrame{
+			Type:   "call",
+			Action: backend.CallAction{To: &to, Input: &input},
+			Result: &backend.CallResult{Output: &output},
+		}
+	}
+	frames := []*backend.CallFrame{
+		frame(token, input),
+		frame(unknown, input),
+		frame(unknown, garbage),
+		frame(unknown, nil),
+	}
+	New(nil, mapRegistry{token: &parsed}, NewSignatures()).DecodeFrames(context.Background(), frames)
+
+	// The registry ABI names the arguments and decodes the outputs
+	byABI := frames[0].Decoded
+	if byABI.Source != backend.DecodedFromABI || byABI.Signature != "transfer(address,uint256)" {
+		t.Fatalf("unexpected decoding %+v", byABI)
+	}
+	if byABI.Inputs[0].Name != "to" || byABI.Inputs[0].Value != recipient {
+		t.Errorf("unexpected first input %+v", byABI.Inputs[0])
+	}
+	if byABI.Inputs[1].Value != amount.String() {
+		t.Errorf("unexpected amount %v", byABI.Inputs[1].Value)
+	}
+	if len(byABI.Outputs) != 1 || byABI.Outputs[0].Value != true {
+		t.Errorf("unexpected outputs %+v", byABI.Outputs)
+	}
+
+	// The 4-byte database only knows the argument types
+	bySig := frames[1].Decoded
+	if bySig.Source != backend.DecodedFromSignature || bySig.Inputs[0].Name != "" || bySig.Outputs != nil {
+		t.Errorf("unexpected decoding %+v", bySig)
+	}
+	if bySel := frames[2].Decoded; bySel.Source != backend.DecodedFromSelector || bySel.Selector.String() != "0xdeadbeef" {
+		t.Errorf("unexpected decoding %+v", bySel)
+	}
+	if frames[3].Decoded != nil {
+		t.Errorf("frame without input decoded")
+	}
+	if _, err := json.Marshal(frames); err != nil {
+		t.Errorf("failed to marshal decoded frames: %v", err)
+	}
+}
+
+func TestSignaturesTuple(t *testing.T) {
+	sigs := NewSignatures()
+	selector := hexutil.MustDecode("0x82ad56cb") // aggregate3((address,bool,bytes)[])
+	methods := sigs.Lookup(selector)
+	if len(methods) != 1 || methods[0].Sig != "aggregate3((address,bool,bytes)[])" {
+		t.Fatalf("unexpected methods %v", methods)
+	}
+}
+
+func TestDecodeProxyFrames(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(erc20ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		tx     = common.HexToHash("0x01")
+		eoa    = common.HexToAddress("0xaa")
+		proxy  = common.HexToAddress("0xbb")
+		impl   = common.HexToAddress("0xcc")
+		selfie = []byte{0x12, 0x34, 0x56, 0x78}
+	)
+	input, err := parsed.Pack("transfer", eoa, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := []*backend.CallFrame{
+		{Type: "call", TransactionHash: &tx, TraceAddress: []int{}, Action: backend.CallAction{CallType: "call", From: &eoa, To: &proxy, Input: &input}},
+		{Type: "call", TransactionHash: &tx, TraceAddress: []int{0}, Action: backend.CallAction{CallType: "staticcall", From: &proxy, To: &impl, Input: &selfie}},
+		{Type: "call", TransactionHash: &tx, TraceAddress: []int{1}, Action: backend.CallAction{CallType: "delegatecall", From: &proxy, To: &impl, Input: &input}},
+	}
+	New(nil, mapRegistry{impl: &parsed}, NewSignatures()).DecodeFrames(context.Background(), frames)
+
+	decoded := frames[0].Decoded
+	if decoded.Source != backend.DecodedFromABI || decoded.Inputs[0].Name != "to" {
+		t.Fatalf("proxy call not decoded with the implementation ABI: %+v", decoded)
+	}
+	if decoded.Proxy == nil || decoded.Proxy.Implementation != impl || decoded.Proxy.Type != backend.ProxyDelegate {
+		t.Errorf("unexpected proxy %+v", decoded.Proxy)
+	}
+	if frames[1].Decoded.Proxy != nil || frames[2].Decoded.Proxy != nil {
+		t.Errorf("non forwarding frames reported as proxies")
+	}
+}
+
+// stateBackend serves the storage and calls of a single proxy.
+type stateBackend struct {
+	backend.Backend
+	slots      map[common.Hash]common.Address
+	masterCopy *common.Address
+}
+
+func (b *stateBackend) StorageAt(ctx context.Context, address common.Address, key common.Hash, number rpc.BlockNumber) ([]byte, error) {
+	return common.LeftPadBytes(b.slots[key].Bytes(), 32), nil
+}
+
+func (b *stateBackend) CallContract(ctx context.Context, to common.Address, data []byte, number rpc.BlockNumber) ([]byte, error) {
+	if b.masterCopy == nil {
+		return nil, errors.New("execution reverted")
+	}
+	return common.LeftPadBytes(b.masterCopy.Bytes(), 32), nil
+}
+
+func TestProxyType(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		proxy = common.HexToAddress("0xbb")
+		impl  = common.HexToAddress("0xcc")
+		other = common.HexToAddress("0xdd")
+	)
+	tests := []struct {
+		name       string
+		slots      map[common.Hash]common.Address
+		masterCopy *common.Address
+		want       string
+	}{
+		{"eip1967", map[common.Hash]common.Address{eip1967ImplementationSlot: impl}, nil, backend.ProxyEIP1967},
+		{"safe", map[common.Hash]common.Address{safeSingletonSlot: impl}, &impl, backend.ProxySafe},
+		{"slot 0 without masterCopy", map[common.Hash]common.Address{safeSingletonSlot: impl}, nil, backend.ProxyDelegate},
+		{"slot 0 with another masterCopy", map[common.Hash]common.Address{safeSingletonSlot: impl}, &other, backend.ProxyDelegate},
+		{"beacon", map[common.Hash]common.Address{eip1967BeaconSlot: other}, nil, backend.ProxyEIP1967Beacon},
+		{"unknown", nil, nil, backend.ProxyDelegate},
+	}
+	for _, tt := range tests {
+		d := New(&stateBackend{slots: tt.slots, masterCopy: tt.masterCopy}, nil, NewSignatures())
+		if have := d.proxyType(ctx, proxy, impl, 1); have != tt.want {
+			t.Errorf("%s: have %s, want %s", tt.name, have, tt.want)
+		}
+	}
+}
+
+func TestDecodeCustomError(t *testing.T) {
+	var (
+		token = common.HexToAddress("0xaa")
+		input = []byte{0xa9, 0x05, 0x9c, 0xbb}
+		data  = hexutil.MustDecode("0xe450d38c" + strings.Repeat("00", 95) + "01")
+	)
+	frame := &backend.CallFrame{
+		Type:         "call",
+		Error:        "execution reverted",
+		Action:       backend.CallAction{To: &token, Input: &input},
+		Result:       &backend.CallResult{Output: &data},
+		RevertReason: backend.DecodeRevert(data),
+	}
+	New(nil, nil, NewSignatures()).DecodeFrames(context.Background(), []*backend.CallFrame{frame})
+
+	reason := frame.RevertReason
+	if reason.Kind != backend.RevertCustom || reason.Signature != "ERC20InsufficientBalance(address,uint256,uint256)" {
+		t.Fatalf("unexpected revert reason %+v", reason)
+	}
+	if len(reason.Inputs) != 3 || reason.Inputs[2].Value != "1" {
+		t.Errorf("unexpected arguments %+v", reason.Inputs)
+	}
+}
+
+// TestDecodeCollidingError decodes a custom error declared, with different
+// argument names, by the ABIs of several callees: a frame tries its own
+// callee first, then the reverted frames of its own subtree, never the
+// callees of other transactions.
+func TestDecodeCollidingError(t *testing.T) {
+	var (
+		tx     = common.HexToHash("0x01")
+		other  = common.HexToHash("0x02")
+		caller = common.HexToAddress("0xaa")
+		high   = common.HexToAddress("0xbb")
+		low    = common.HexToAddress("0xcc")
+		input  = []byte{0x12, 0x34, 0x56, 0x78}
+		data   = append(crypto.Keccak256([]byte("Failed(uint256)"))[:4], common.LeftPadBytes([]byte{1}, 32)...)
+	)
+	registry := make(mapRegistry)
+	for addr, name := range map[common.Address]string{high: "high", low: "low"} {
+		parsed, err := abi.JSON(strings.NewReader(`[{"type":"error","name":"Failed","inputs":[{"name":"` + name + `","type":"uint256"}]}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		registry[addr] = &parsed
+	}
+	call := func(hash *common.Hash, traceAddress []int, to common.Address, reverted bool) *backend.CallFrame {
+		frame := &backend.CallFrame{Type: "call", TransactionHash: hash, TraceAddress: traceAddress, Action: backend.CallAction{CallType: "call", From: &caller, To: &to, Input: &input}}
+		if reverted {
+			frame.Error = "execution reverted"
+			frame.Result = &backend.CallResult{Output: &data}
+			frame.RevertReason = backend.DecodeRevert(data)
+		}
+		return frame
+	}
+	for i := 0; i < 20; i++ {
+		frames := []*backend.CallFrame{
+			call(&tx, []int{}, caller, true),
+			call(&tx, []int{0}, high, false),
+			call(&tx, []int{1}, low, true),
+			call(&tx, []int{1, 0}, high, true),
+			call(&other, []int{}, caller, true),
+		}
+		New(nil, registry, NewSignatures()).DecodeFrames(context.Background(), frames)
+
+		for _, tt := range []struct {
+			frame int
+			want  string
+		}{
+			{0, "low"},  // The reverted subcall before the earlier successful one
+			{2, "low"},  // Its own callee before the reverted subcall
+			{3, "high"}, // Its own callee
+		} {
+			reason := frames[tt.frame].RevertReason
+			if reason.Kind != backend.RevertCustom || len(reason.Inputs) != 1 || reason.Inputs[0].Name != tt.want {
+				t.Fatalf("run %d, frame %d: have revert reason %+v, want %s", i, tt.frame, reason, tt.want)
+			}
+		}
+		if reason := frames[4].RevertReason; reason.Kind != backend.RevertUnknown {
+			t.Fatalf("run %d: decoded with the ABIs of another transaction: %+v", i, reason)
+		}
+	}
+}
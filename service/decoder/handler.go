@@ -0,0 +1,131 @@
+package decoder
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+// maxABISize is the maximum size of an uploaded ABI.
+const maxABISize = 4 * 1024 * 1024
+
+// Handler serves the ABI registry over plain HTTP:
+//
+//	GET    <prefix>                 list the ABIs (?offset=&limit=)
+//	GET    <prefix><address>        get the ABI of a contract
+//	PUT    <prefix><address>?name=  upload the ABI of a contract, POST works too
+//	DELETE <prefix><address>        delete the ABI of a contract
+//
+// Uploads and deletions are refused with 403 unless uploads are allowed.
+type Handler struct {
+	api    *API
+	prefix string
+}
+
+// NewHandler creates the ABI registry handler mounted at prefix.
+func NewHandler(registry *DBRegistry, prefix string, uploads bool) *Handler {
+	return &Handler{api: NewAPI(registry, uploads), prefix: prefix}
+}
+
+type httpError struct {
+	status int
+	err    error
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	result, herr := h.serve(r)
+	if herr != nil {
+		logging.Ctx(r.Context()).Debug("ABI registry request failed", "method", r.Method, "path", r.URL.Path, "err", herr.err)
+		writeJSON(w, herr.status, map[string]string{"error": herr.err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) serve(r *http.Request) (interface{}, *httpError) {
+	ctx := r.Context()
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, h.prefix), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			return nil, &httpError{http.StatusMethodNotAllowed, errors.New("method not allowed")}
+		}
+		opts := new(ListOptions)
+		if v := r.URL.Query().Get("offset"); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return nil, &httpError{http.StatusBadRequest, errors.New("invalid offset")}
+			}
+			opts.Offset = hexutil.Uint64(n)
+		}
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return nil, &httpError{http.StatusBadRequest, errors.New("invalid limit")}
+			}
+			limit := hexutil.Uint64(n)
+			opts.Limit = &limit
+		}
+		entries, err := h.api.List(ctx, opts)
+		if err != nil {
+			return nil, &httpError{http.StatusBadRequest, err}
+		}
+		return entries, nil
+	}
+	if !common.IsHexAddress(rest) {
+		return nil, &httpError{http.StatusNotFound, errors.New("invalid address")}
+	}
+	address := common.HexToAddress(rest)
+
+	switch r.Method {
+	case http.MethodGet:
+		entry, err := h.api.Get(ctx, address)
+		if err != nil {
+			return nil, &httpError{http.StatusInternalServerError, err}
+		}
+		if entry == nil {
+			return nil, &httpError{http.StatusNotFound, errors.New("ABI not found")}
+		}
+		return entry, nil
+	case http.MethodPut, http.MethodPost:
+		if !h.api.uploads {
+			return nil, &httpError{http.StatusForbidden, errUploadsDisabled}
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxABISize))
+		if err != nil {
+			return nil, &httpError{http.StatusBadRequest, err}
+		}
+		name := r.URL.Query().Get("name")
+		if _, err := h.api.Upload(ctx, address, body, &name); err != nil {
+			return nil, &httpError{http.StatusBadRequest, err}
+		}
+		return map[string]interface{}{"address": address}, nil
+	case http.MethodDelete:
+		if !h.api.uploads {
+			return nil, &httpError{http.StatusForbidden, errUploadsDisabled}
+		}
+		deleted, err := h.api.Delete(ctx, address)
+		if err != nil {
+			return nil, &httpError{http.StatusInternalServerError, err}
+		}
+		if !deleted {
+			return nil, &httpError{http.StatusNotFound, errors.New("ABI not found")}
+		}
+		return map[string]interface{}{"address": address}, nil
+	default:
+		return nil, &httpError{http.StatusMethodNotAllowed, errors.New("method not allowed")}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,31 @@
+package decoder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestUploadsDisabled(t *testing.T) {
+	address := common.HexToAddress("0xaa")
+	api := NewAPI(nil, false)
+	if _, err := api.Upload(context.Background(), address, []byte(erc20ABI), nil); err != errUploadsDisabled {
+		t.Errorf("upload: have %v, want %v", err, errUploadsDisabled)
+	}
+	if _, err := api.Delete(context.Background(), address); err != errUploadsDisabled {
+		t.Errorf("delete: have %v, want %v", err, errUploadsDisabled)
+	}
+
+	h := NewHandler(nil, "/abi/", false)
+	for _, method := range []string{http.MethodPut, http.MethodPost, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/abi/"+address.Hex(), strings.NewReader(erc20ABI)))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: have status %d, want %d", method, w.Code, http.StatusForbidden)
+		}
+	}
+}
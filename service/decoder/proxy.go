@@ -0,0 +1,131 @@
+package decoder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+var (
+	// eip1967ImplementationSlot is bytes32(uint256(keccak256('eip1967.proxy.implementation')) - 1).
+	eip1967ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+
+	// eip1967BeaconSlot is bytes32(uint256(keccak256('eip1967.proxy.beacon')) - 1).
+	eip1967BeaconSlot = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+
+	// eip1822ProxiableSlot is keccak256('PROXIABLE').
+	eip1822ProxiableSlot = common.HexToHash("0xc5f16f0fcc639fa48a6947836d9850f504798523bf8c9a3a87d5876cf622bcf7")
+
+	// safeSingletonSlot holds the singleton (master copy) of a Safe proxy.
+	safeSingletonSlot = common.Hash{}
+
+	// safeMasterCopySelector is masterCopy(), answered by the Safe proxy
+	// itself without delegating.
+	safeMasterCopySelector = []byte{0xa6, 0x19, 0x48, 0x6e}
+)
+
+func frameKey(frame *backend.CallFrame, traceAddress []int) string {
+	var tx common.Hash
+	if frame.TransactionHash != nil {
+		tx = *frame.TransactionHash
+	}
+	return fmt.Sprintf("%x%v", tx, traceAddress)
+}
+
+// forwards maps every frame which delegates its whole calldata to one of its
+// children, the signature of a proxy, to that child.
+func forwards(frames []*backend.CallFrame) map[*backend.CallFrame]*backend.CallFrame {
+	index := make(map[string]*backend.CallFrame, len(frames))
+	for _, frame := range frames {
+		index[frameKey(frame, frame.TraceAddress)] = frame
+	}
+	forwards := make(map[*backend.CallFrame]*backend.CallFrame)
+	for _, child := range frames {
+		action := child.Action
+		if len(child.TraceAddress) == 0 || !strings.EqualFold(action.CallType, "delegatecall") || action.Input == nil {
+			continue
+		}
+		parent, ok := index[frameKey(child, child.TraceAddress[:len(child.TraceAddress)-1])]
+		if !ok || parent.Action.Input == nil || parent.Action.To == nil || action.From == nil {
+			continue
+		}
+		if _, seen := forwards[parent]; seen {
+			continue
+		}
+		if *parent.Action.To == *action.From && bytes.Equal(*parent.Action.Input, *action.Input) {
+			forwards[parent] = child
+		}
+	}
+	return forwards
+}
+
+// implementation follows the chain of forwarding frames down to the code
+// which actually handled the call.
+func implementation(forwards map[*backend.CallFrame]*backend.CallFrame, frame *backend.CallFrame) (common.Address, bool) {
+	child, ok := forwards[frame]
+	if !ok {
+		return common.Address{}, false
+	}
+	for {
+		next, ok := forwards[child]
+		if !ok {
+			return *child.Action.To, true
+		}
+		child = next
+	}
+}
+
+// proxyType tells the proxy standard apart from the storage layout of the
+// proxy at the block of the call. If the state isn't available (e.g. a
+// pruned upstream), the proxy is reported as a plain delegating one. Slot 0
+// is an ordinary variable of most contracts, so a Safe is only reported if
+// the proxy also answers masterCopy() with the implementation.
+func (d *Decoder) proxyType(ctx context.Context, proxy, impl common.Address, number uint64) string {
+	if d.backend == nil {
+		return backend.ProxyDelegate
+	}
+	slots := []struct {
+		slot common.Hash
+		typ  string
+	}{
+		{eip1967ImplementationSlot, backend.ProxyEIP1967},
+		{eip1822ProxiableSlot, backend.ProxyEIP1822},
+		{safeSingletonSlot, backend.ProxySafe},
+	}
+	for _, s := range slots {
+		value, err := d.backend.StorageAt(ctx, proxy, s.slot, rpc.BlockNumber(number))
+		if err != nil {
+			logging.Ctx(ctx).Debug("Failed to read proxy slot", "proxy", proxy, "slot", s.slot, "number", number, "err", err)
+			return backend.ProxyDelegate
+		}
+		if common.BytesToAddress(value) != impl {
+			continue
+		}
+		if s.typ == backend.ProxySafe && !d.isSafe(ctx, proxy, impl, number) {
+			continue
+		}
+		return s.typ
+	}
+	// Beacon proxies store the beacon, which is queried for the implementation
+	if value, err := d.backend.StorageAt(ctx, proxy, eip1967BeaconSlot, rpc.BlockNumber(number)); err == nil && common.BytesToAddress(value) != (common.Address{}) {
+		return backend.ProxyEIP1967Beacon
+	}
+	return backend.ProxyDelegate
+}
+
+// isSafe checks that the proxy reports the implementation as its master copy.
+func (d *Decoder) isSafe(ctx context.Context, proxy, impl common.Address, number uint64) bool {
+	output, err := d.backend.CallContract(ctx, proxy, safeMasterCopySelector, rpc.BlockNumber(number))
+	if err != nil {
+		logging.Ctx(ctx).Debug("Failed to call masterCopy", "proxy", proxy, "number", number, "err", err)
+		return false
+	}
+	return len(output) == common.HashLength && common.BytesToAddress(output) == impl
+}
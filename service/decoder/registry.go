@@ -0,0 +1,146 @@
+package decoder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// abiCacheLimit is the number of parsed ABIs kept by the database registry.
+const abiCacheLimit = 4096
+
+// Registry provides the ABIs of known contracts.
+type Registry interface {
+	// ABI returns the ABI of the contract, or nil if it is unknown.
+	ABI(ctx context.Context, address common.Address) (*abi.ABI, error)
+}
+
+// dirRegistry is a registry of ABI files named after the contract address,
+// e.g. 0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48.json.
+type dirRegistry struct {
+	abis map[common.Address]*abi.ABI
+}
+
+// NewDirRegistry loads the ABI files of the directory.
+func NewDirRegistry(dir string) (Registry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	r := &dirRegistry{abis: make(map[common.Address]*abi.ABI)}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		if !common.IsHexAddress(name) {
+			return nil, fmt.Errorf("ABI file %s is not named after an address", file)
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := abi.JSON(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid ABI file %s: %w", file, err)
+		}
+		r.abis[common.HexToAddress(name)] = &parsed
+	}
+	return r, nil
+}
+
+func (r *dirRegistry) ABI(ctx context.Context, address common.Address) (*abi.ABI, error) {
+	return r.abis[address], nil
+}
+
+// DBRegistry is the registry of ABIs stored in the database of the backend.
+// Parsed ABIs, including the unknown ones, are cached until overwritten or
+// deleted through the registry.
+type DBRegistry struct {
+	backend backend.Backend
+	cache   *lru.Cache[common.Address, *abi.ABI]
+}
+
+// NewDBRegistry creates a registry on top of the backend database.
+func NewDBRegistry(backend backend.Backend) *DBRegistry {
+	return &DBRegistry{
+		backend: backend,
+		cache:   lru.NewCache[common.Address, *abi.ABI](abiCacheLimit),
+	}
+}
+
+func (r *DBRegistry) ABI(ctx context.Context, address common.Address) (*abi.ABI, error) {
+	if parsed, ok := r.cache.Get(address); ok {
+		return parsed, nil
+	}
+	row, err := r.backend.ContractABI(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	var parsed *abi.ABI
+	if row != nil {
+		v, err := abi.JSON(strings.NewReader(row.ABI))
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored ABI of %s: %w", address.Hex(), err)
+		}
+		parsed = &v
+	}
+	r.cache.Add(address, parsed)
+	return parsed, nil
+}
+
+// Get returns the stored ABI of the contract, or nil if there is none.
+func (r *DBRegistry) Get(ctx context.Context, address common.Address) (*backend.ContractABI, error) {
+	return r.backend.ContractABI(ctx, address)
+}
+
+// List returns a page of the stored ABIs, without their content.
+func (r *DBRegistry) List(ctx context.Context, offset, limit int) ([]*backend.ContractABI, error) {
+	return r.backend.ContractABIs(ctx, offset, limit)
+}
+
+// Put validates and stores the ABI of the contract, replacing any previous one.
+func (r *DBRegistry) Put(ctx context.Context, address common.Address, name, content string) error {
+	if _, err := abi.JSON(strings.NewReader(content)); err != nil {
+		return fmt.Errorf("invalid ABI: %w", err)
+	}
+	if err := r.backend.PutContractABI(ctx, address, name, content); err != nil {
+		return err
+	}
+	r.cache.Remove(address)
+	return nil
+}
+
+// Delete removes the ABI of the contract, reporting whether there was one.
+func (r *DBRegistry) Delete(ctx context.Context, address common.Address) (bool, error) {
+	deleted, err := r.backend.DeleteContractABI(ctx, address)
+	if err != nil {
+		return false, err
+	}
+	r.cache.Remove(address)
+	return deleted, nil
+}
+
+// multiRegistry looks up the ABIs in several registries, in order.
+type multiRegistry []Registry
+
+// NewMultiRegistry combines the registries, the first one knowing an ABI wins.
+func NewMultiRegistry(registries ...Registry) Registry {
+	return multiRegistry(registries)
+}
+
+func (m multiRegistry) ABI(ctx context.Context, address common.Address) (*abi.ABI, error) {
+	for _, r := range m {
+		parsed, err := r.ABI(ctx, address)
+		if err != nil || parsed != nil {
+			return parsed, err
+		}
+	}
+	return nil, nil
+}
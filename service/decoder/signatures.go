@@ -0,0 +1,108 @@
+package decoder
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+//go:embed signatures.txt
+var bundledSignatures string
+
+// Signatures is a 4-byte signature database, mapping function selectors to
+// the text signatures hashing to them.
+type Signatures struct {
+	methods map[[4]byte][]*abi.Method
+}
+
+// NewSignatures returns the database of the bundled signatures.
+func NewSignatures() *Signatures {
+	s := &Signatures{methods: make(map[[4]byte][]*abi.Method)}
+	if err := s.Load(strings.NewReader(bundledSignatures)); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Load adds the text signatures read from r, one per line. Empty lines and
+// lines starting with # are skipped.
+func (s *Signatures) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := s.Add(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadFile adds the text signatures of a file, see Load.
+func (s *Signatures) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Load(f)
+}
+
+// Add adds a single text signature, e.g. "transfer(address,uint256)".
+func (s *Signatures) Add(signature string) error {
+	method, err := parseSignature(signature)
+	if err != nil {
+		return err
+	}
+	var selector [4]byte
+	copy(selector[:], method.ID)
+	for _, known := range s.methods[selector] {
+		if known.Sig == method.Sig {
+			return nil
+		}
+	}
+	s.methods[selector] = append(s.methods[selector], method)
+	return nil
+}
+
+// Lookup returns the methods whose signature hashes to the selector.
+func (s *Signatures) Lookup(selector []byte) []*abi.Method {
+	var key [4]byte
+	copy(key[:], selector)
+	return s.methods[key]
+}
+
+// Len returns the number of known signatures.
+func (s *Signatures) Len() int {
+	n := 0
+	for _, methods := range s.methods {
+		n += len(methods)
+	}
+	return n
+}
+
+// parseSignature converts a text signature into a method without named
+// arguments nor outputs.
+func parseSignature(signature string) (*abi.Method, error) {
+	selector, err := abi.ParseSelector(signature)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := json.Marshal([]abi.SelectorMarshaling{selector})
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := abi.JSON(strings.NewReader(string(blob)))
+	if err != nil {
+		return nil, err
+	}
+	method := parsed.Methods[selector.Name]
+	return &method, nil
+}
@@ -18,42 +18,86 @@ package eth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/service/cache"
 )
 
 // API is the collection of tracing APIs exposed over the private debugging endpoint.
 type API struct {
 	backend backend.Backend
+	cache   *cache.Cache
+	config  *params.ChainConfig
 }
 
 // NewAPI creates a new API definition for the tracing methods of the Ethereum service.
-func NewAPI(backend backend.Backend) *API {
-	return &API{backend: backend}
+// The chain config recovers the senders and prices the pending transactions.
+func NewAPI(backend backend.Backend, cache *cache.Cache, config *params.ChainConfig) *API {
+	return &API{backend: backend, cache: cache, config: config}
 }
 
 // GetBlockByNumber is the wrapper of the chain access function offered by the backend.
 // It will return an error if the block is not found.
 func (api *API) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if number >= 0 && api.cache.Get(ctx, &fields, "eth_getBlockByNumber", number, fullTx) {
+		return fields, nil
+	}
 	block, err := api.backend.BlockByNumber(ctx, number)
 	if err != nil {
-		return nil, err
+		return nil, backend.RPCError(err)
 	}
 	if block == nil {
-		return nil, fmt.Errorf("block #%d not found", number)
+		return nil, &backend.NotFoundError{What: fmt.Sprintf("block #%d", number)}
+	}
+	fields, err = RPCMarshalBlock(block, true, fullTx, api.config)
+	if err != nil {
+		return nil, err
+	}
+	if number >= 0 {
+		api.cache.Put(ctx, block.NumberU64(), fields, "eth_getBlockByNumber", number, fullTx)
+	}
+	return fields, nil
+}
+
+// GetTransactionByHash returns the transaction for the given hash, pending
+// ones included, nil if the upstream doesn't know it.
+func (api *API) GetTransactionByHash(ctx context.Context, hash common.Hash) (*RPCTransaction, error) {
+	tx, number, _, err := api.backend.TransactionByHash(ctx, hash)
+	var pending *backend.PendingError
+	switch {
+	case errors.As(err, &pending):
+		// Priced against the base fee of the block it may land in
+		head, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+		if err != nil {
+			return nil, backend.RPCError(err)
+		}
+		return NewRPCPendingTransaction(tx, head, api.config), nil
+	case errors.Is(err, ethereum.NotFound):
+		return nil, nil
+	case err != nil:
+		return nil, backend.RPCError(err)
+	}
+	block, err := api.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		return nil, backend.RPCError(err)
 	}
-	return RPCMarshalBlock(block, true, fullTx)
+	return NewRPCTransactionFromBlockHash(block, hash, api.config), nil
 }
 
 // APIs return the collection of RPC services the tracer package offers.
-func APIs(backend backend.Backend) []rpc.API {
+func APIs(backend backend.Backend, cache *cache.Cache, config *params.ChainConfig) []rpc.API {
 	// Append all the local APIs and return
 	return []rpc.API{
 		{
 			Namespace: "eth",
-			Service:   NewAPI(backend),
+			Service:   NewAPI(backend, cache, config),
 		},
 	}
 }
@@ -0,0 +1,46 @@
+package eth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+func TestGetTransactionByHash(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		fixture = upstreamtest.Fixture(t, "ethereum.json")
+		mined   = fixture.Blocks[0]
+		pending = fixture.Blocks[len(fixture.Blocks)-1].Transactions[0]
+	)
+	upstream := upstreamtest.NewServer(&backend.Fixture{Blocks: fixture.Blocks[:len(fixture.Blocks)-1]})
+	upstream.AddPending(pending)
+	defer upstream.Close()
+
+	api := NewAPI(upstreamtest.NewBackend(t, upstream, fixture.Chain, nil), nil, params.MainnetChainConfig)
+
+	tx, err := api.GetTransactionByHash(ctx, mined.Transactions[0].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.BlockHash == nil || *tx.BlockHash != mined.Header.Hash() || tx.TransactionIndex == nil {
+		t.Errorf("mined transaction without its location: %+v", tx)
+	}
+
+	tx, err = api.GetTransactionByHash(ctx, pending.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Hash != pending.Hash() || tx.BlockHash != nil || tx.BlockNumber != nil {
+		t.Errorf("pending transaction %s in block %v, want %s without block", tx.Hash, tx.BlockHash, pending.Hash())
+	}
+
+	if tx, err := api.GetTransactionByHash(ctx, common.HexToHash("0x01")); tx != nil || err != nil {
+		t.Errorf("unknown transaction: have %v %v, want nil", tx, err)
+	}
+}
@@ -0,0 +1,134 @@
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+// cancunBlock returns the block with a blob transaction of the Cancun
+// fixture, as read back from the dev backend.
+func cancunBlock(t *testing.T) (*types.Block, *types.Transaction, common.Address) {
+	t.Helper()
+	var (
+		fixture = upstreamtest.Fixture(t, "cancun.json")
+		b       = upstreamtest.NewDevBackend(t, fixture)
+	)
+	block, err := b.BlockByNumber(context.Background(), rpc.BlockNumber(fixture.Blocks[0].Header.Number.Int64()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := block.Transactions()[0]
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block, tx, from
+}
+
+func TestMarshalCancunBlock(t *testing.T) {
+	block, tx, from := cancunBlock(t)
+	fields, err := RPCMarshalBlock(block, true, true, params.MainnetChainConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have struct {
+		Hash                  common.Hash `json:"hash"`
+		BlobGasUsed           string      `json:"blobGasUsed"`
+		ExcessBlobGas         string      `json:"excessBlobGas"`
+		ParentBeaconBlockRoot common.Hash `json:"parentBeaconBlockRoot"`
+		Transactions          []struct {
+			From                common.Address `json:"from"`
+			GasPrice            string         `json:"gasPrice"`
+			MaxFeePerBlobGas    string         `json:"maxFeePerBlobGas"`
+			BlobVersionedHashes []common.Hash  `json:"blobVersionedHashes"`
+			YParity             *string        `json:"yParity"`
+		} `json:"transactions"`
+		Withdrawals []struct {
+			Index string `json:"index"`
+		} `json:"withdrawals"`
+	}
+	if err := json.Unmarshal(blob, &have); err != nil {
+		t.Fatal(err)
+	}
+	if have.BlobGasUsed != "0x40000" || have.ExcessBlobGas != "0x60000" || have.ParentBeaconBlockRoot != *block.BeaconRoot() {
+		t.Errorf("blob header fields: %s", blob)
+	}
+	if len(have.Withdrawals) != len(block.Withdrawals()) || len(have.Withdrawals) == 0 {
+		t.Errorf("have %d withdrawals, want %d", len(have.Withdrawals), len(block.Withdrawals()))
+	}
+	// The hash of the header decoded from the output matches
+	header := new(types.Header)
+	if err := json.Unmarshal(blob, header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Hash() != block.Hash() || have.Hash != block.Hash() {
+		t.Errorf("header hash: have %s, want %s", header.Hash(), block.Hash())
+	}
+
+	if len(have.Transactions) != 1 {
+		t.Fatalf("have %d transactions, want 1", len(have.Transactions))
+	}
+	rpcTx := have.Transactions[0]
+	if rpcTx.From != from {
+		t.Errorf("from: have %s, want %s", rpcTx.From, from)
+	}
+	// min(2 gwei + 40 gwei, 50 gwei)
+	if rpcTx.GasPrice != "0x9c7652400" {
+		t.Errorf("effective gas price: have %s, want 42 gwei", rpcTx.GasPrice)
+	}
+	if rpcTx.MaxFeePerBlobGas != "0x3b9aca00" || len(rpcTx.BlobVersionedHashes) != 2 || rpcTx.BlobVersionedHashes[1] != tx.BlobHashes()[1] {
+		t.Errorf("blob fields: %s", blob)
+	}
+	if v, _, _ := tx.RawSignatureValues(); rpcTx.YParity == nil || *rpcTx.YParity != fmt.Sprintf("0x%d", v.Uint64()) {
+		t.Errorf("yParity: have %v, want %d", rpcTx.YParity, v)
+	}
+
+	// Legacy transactions go without yParity
+	legacy := newRPCTransaction(types.NewTx(&types.LegacyTx{Gas: 21000, GasPrice: big.NewInt(1), V: big.NewInt(27), R: big.NewInt(1), S: big.NewInt(1)}), block.Hash(), 1, 0, 0, nil, params.MainnetChainConfig)
+	if legacy.YParity != nil {
+		t.Errorf("legacy transaction with yParity %d", *legacy.YParity)
+	}
+}
+
+func TestMarshalBlobReceipt(t *testing.T) {
+	block, tx, _ := cancunBlock(t)
+	receipt := &types.Receipt{
+		Type:         types.BlobTxType,
+		Status:       types.ReceiptStatusSuccessful,
+		TxHash:       tx.Hash(),
+		BlockHash:    block.Hash(),
+		BlockNumber:  block.Number(),
+		GasUsed:      21000,
+		BlobGasUsed:  tx.BlobGas(),
+		BlobGasPrice: big.NewInt(1),
+	}
+	fields := RPCMarshalReceipt(receipt, tx, params.MainnetChainConfig)
+	blob, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have struct {
+		BlobGasUsed  string `json:"blobGasUsed"`
+		BlobGasPrice string `json:"blobGasPrice"`
+	}
+	if err := json.Unmarshal(blob, &have); err != nil {
+		t.Fatal(err)
+	}
+	if have.BlobGasUsed != "0x40000" || have.BlobGasPrice != "0x1" {
+		t.Errorf("blob receipt fields: %s", blob)
+	}
+}
@@ -0,0 +1,342 @@
+package etherscan
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// internalTx is an item of the txlistinternal result.
+type internalTx struct {
+	BlockNumber     string `json:"blockNumber"`
+	TimeStamp       string `json:"timeStamp"`
+	Hash            string `json:"hash"`
+	From            string `json:"from"`
+	To              string `json:"to"`
+	Value           string `json:"value"`
+	ContractAddress string `json:"contractAddress"`
+	Input           string `json:"input"`
+	Type            string `json:"type"`
+	Gas             string `json:"gas"`
+	GasUsed         string `json:"gasUsed"`
+	TraceID         string `json:"traceId"`
+	IsError         string `json:"isError"`
+	ErrCode         string `json:"errCode"`
+}
+
+// normalTx is an item of the txlist result.
+type normalTx struct {
+	BlockNumber       string `json:"blockNumber"`
+	TimeStamp         string `json:"timeStamp"`
+	Hash              string `json:"hash"`
+	Nonce             string `json:"nonce"`
+	BlockHash         string `json:"blockHash"`
+	TransactionIndex  string `json:"transactionIndex"`
+	From              string `json:"from"`
+	To                string `json:"to"`
+	Value             string `json:"value"`
+	Gas               string `json:"gas"`
+	GasPrice          string `json:"gasPrice"`
+	IsError           string `json:"isError"`
+	TxReceiptStatus   string `json:"txreceipt_status"`
+	Input             string `json:"input"`
+	ContractAddress   string `json:"contractAddress"`
+	CumulativeGasUsed string `json:"cumulativeGasUsed"`
+	GasUsed           string `json:"gasUsed"`
+	Confirmations     string `json:"confirmations"`
+	MethodID          string `json:"methodId"`
+	FunctionName      string `json:"functionName"`
+}
+
+func formatAddress(addr *common.Address) string {
+	if addr == nil {
+		return ""
+	}
+	return strings.ToLower(addr.Hex())
+}
+
+func formatBig(n *big.Int) string {
+	if n == nil {
+		return "0"
+	}
+	return n.String()
+}
+
+func formatUint64(n *uint64) string {
+	if n == nil {
+		return "0"
+	}
+	return strconv.FormatUint(*n, 10)
+}
+
+func formatBytes(b *[]byte) string {
+	if b == nil || len(*b) == 0 {
+		return ""
+	}
+	return hexutil.Encode(*b)
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func traceID(traceAddress []int) string {
+	ids := make([]string, len(traceAddress))
+	for i, n := range traceAddress {
+		ids[i] = strconv.Itoa(n)
+	}
+	return strings.Join(ids, "_")
+}
+
+// txListInternal returns the internal transactions of an address, of a
+// transaction or within a block range.
+func (h *Handler) txListInternal(r *http.Request) ([]*internalTx, error) {
+	ctx := r.Context()
+	p, err := parsePagination(r)
+	if err != nil {
+		return nil, err
+	}
+	var frames []*backend.CallFrame
+	if txhash := r.Form.Get("txhash"); txhash != "" {
+		raw, err := hexutil.Decode(txhash)
+		if err != nil || len(raw) != common.HashLength {
+			return nil, errInvalidTxHash
+		}
+		if frames, err = h.backend.TraceTransaction(ctx, common.BytesToHash(raw)); err != nil {
+			return nil, err
+		}
+		frames = internalFrames(frames)
+		if p.descending {
+			for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+				frames[i], frames[j] = frames[j], frames[i]
+			}
+		}
+		if p.offset >= len(frames) {
+			frames = nil
+		} else {
+			frames = frames[p.offset:]
+			if len(frames) > p.limit {
+				frames = frames[:p.limit]
+			}
+		}
+	} else {
+		topLevel := false
+		filter := &backend.TraceFilter{
+			FromBlock:      p.startBlock,
+			ToBlock:        p.endBlock,
+			TopLevel:       &topLevel,
+			Types:          internalTypes,
+			OnlyValueCalls: true,
+			Descending:     p.descending,
+			Offset:         p.offset,
+			Limit:          p.limit,
+		}
+		if v := r.Form.Get("address"); v != "" {
+			addr, err := parseAddress(v)
+			if err != nil {
+				return nil, err
+			}
+			filter.Address = &addr
+		} else if r.Form.Get("startblock") == "" || r.Form.Get("endblock") == "" {
+			return nil, errInvalidAddress
+		}
+		if frames, _, err = h.backend.FilterTraces(ctx, filter); err != nil {
+			return nil, err
+		}
+	}
+	txs := make([]*internalTx, 0, len(frames))
+	for _, frame := range frames {
+		timestamp, err := h.backend.BlockTimestamp(ctx, rpc.BlockNumber(frame.BlockNumber))
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, newInternalTx(frame, timestamp))
+	}
+	return txs, nil
+}
+
+// internalTypes are the trace types reported as internal transactions.
+var internalTypes = []string{"call", "create", "create2", "suicide", "selfdestruct"}
+
+// internalFrames filters the frames Etherscan reports as internal
+// transactions: inner value transfers, creations and self-destructs.
+func internalFrames(frames []*backend.CallFrame) []*backend.CallFrame {
+	var filtered []*backend.CallFrame
+	for _, frame := range frames {
+		if len(frame.TraceAddress) == 0 {
+			continue
+		}
+		switch strings.ToLower(frame.Type) {
+		case "call":
+			if frame.Action.Value == nil || frame.Action.Value.Sign() == 0 {
+				continue
+			}
+		case "create", "create2", "suicide", "selfdestruct":
+		default:
+			continue
+		}
+		filtered = append(filtered, frame)
+	}
+	return filtered
+}
+
+func newInternalTx(frame *backend.CallFrame, timestamp uint64) *internalTx {
+	tx := &internalTx{
+		BlockNumber: strconv.FormatUint(frame.BlockNumber, 10),
+		TimeStamp:   strconv.FormatUint(timestamp, 10),
+		Hash:        frame.TransactionHash.Hex(),
+		Type:        strings.ToLower(frame.Type),
+		TraceID:     traceID(frame.TraceAddress),
+		IsError:     formatBool(frame.Error != ""),
+		ErrCode:     frame.Error,
+	}
+	action := frame.Action
+	switch tx.Type {
+	case "suicide", "selfdestruct":
+		tx.From = formatAddress(action.SelfDestructed)
+		tx.To = formatAddress(action.RefundAddress)
+		tx.Value = formatBig(action.Balance)
+		tx.Gas, tx.GasUsed = "0", "0"
+	case "create", "create2":
+		tx.From = formatAddress(action.From)
+		tx.Value = formatBig(action.Value)
+		tx.Gas = formatUint64(action.Gas)
+		tx.GasUsed = "0"
+		if frame.Result != nil {
+			tx.ContractAddress = formatAddress(frame.Result.Address)
+			tx.GasUsed = formatUint64(frame.Result.GasUsed)
+		}
+	default:
+		tx.Type = strings.ToLower(action.CallType)
+		tx.From = formatAddress(action.From)
+		tx.To = formatAddress(action.To)
+		tx.Value = formatBig(action.Value)
+		tx.Gas = formatUint64(action.Gas)
+		tx.GasUsed = "0"
+		if frame.Result != nil {
+			tx.GasUsed = formatUint64(frame.Result.GasUsed)
+		}
+	}
+	return tx
+}
+
+// txList returns the normal transactions sent from or to an address,
+// located by the top-level frames of the traces table.
+func (h *Handler) txList(r *http.Request) ([]*normalTx, error) {
+	ctx := r.Context()
+	p, err := parsePagination(r)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := parseAddress(r.Form.Get("address"))
+	if err != nil {
+		return nil, err
+	}
+	topLevel := true
+	frames, _, err := h.backend.FilterTraces(ctx, &backend.TraceFilter{
+		Address:    &addr,
+		FromBlock:  p.startBlock,
+		ToBlock:    p.endBlock,
+		TopLevel:   &topLevel,
+		Types:      []string{"call", "create", "create2"},
+		Descending: p.descending,
+		Offset:     p.offset,
+		Limit:      p.limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	head, err := h.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		txs      = make([]*normalTx, 0, len(frames))
+		block    *types.Block
+		receipts []*types.Receipt
+	)
+	for _, frame := range frames {
+		// Transaction details (nonce, gas price, ...) aren't part of the
+		// traces, fetch them once per block from upstream.
+		if block == nil || block.NumberU64() != frame.BlockNumber {
+			number := rpc.BlockNumber(frame.BlockNumber)
+			if block, err = h.backend.BlockByNumber(ctx, number); err != nil {
+				return nil, err
+			}
+			if receipts, err = h.backend.BlockReceipts(ctx, number); err != nil {
+				return nil, err
+			}
+		}
+		pos := frame.TransactionPosition
+		if pos >= uint64(len(block.Transactions())) || pos >= uint64(len(receipts)) {
+			return nil, fmt.Errorf("transaction %d of block #%d not found", pos, frame.BlockNumber)
+		}
+		tx, err := newNormalTx(frame, block, block.Transactions()[pos], receipts[pos], head.Number.Uint64())
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// newNormalTx builds the txlist item of a transaction, whose sender is the
+// caller of its top-level frame, so no signer of the chain is needed.
+func newNormalTx(frame *backend.CallFrame, block *types.Block, tx *types.Transaction, receipt *types.Receipt, head uint64) (*normalTx, error) {
+	if frame.TransactionHash != nil && *frame.TransactionHash != tx.Hash() {
+		return nil, fmt.Errorf("transaction %d of block #%d is %s, traced %s", frame.TransactionPosition, frame.BlockNumber, tx.Hash(), frame.TransactionHash)
+	}
+	if frame.Action.From == nil {
+		return nil, fmt.Errorf("sender of transaction %s not traced", tx.Hash())
+	}
+
+	input := hexutil.Encode(tx.Data())
+	methodID := "0x"
+	if len(tx.Data()) >= 4 {
+		methodID = hexutil.Encode(tx.Data()[:4])
+	}
+	var confirmations uint64
+	if head >= block.NumberU64() {
+		confirmations = head - block.NumberU64() + 1
+	}
+	gasPrice := receipt.EffectiveGasPrice
+	if gasPrice == nil {
+		gasPrice = tx.GasPrice()
+	}
+	ntx := &normalTx{
+		BlockNumber:       block.Number().String(),
+		TimeStamp:         strconv.FormatUint(block.Time(), 10),
+		Hash:              tx.Hash().Hex(),
+		Nonce:             strconv.FormatUint(tx.Nonce(), 10),
+		BlockHash:         block.Hash().Hex(),
+		TransactionIndex:  strconv.FormatUint(frame.TransactionPosition, 10),
+		From:              formatAddress(frame.Action.From),
+		To:                formatAddress(tx.To()),
+		Value:             tx.Value().String(),
+		Gas:               strconv.FormatUint(tx.Gas(), 10),
+		GasPrice:          gasPrice.String(),
+		IsError:           formatBool(frame.Error != ""),
+		TxReceiptStatus:   strconv.FormatUint(receipt.Status, 10),
+		Input:             input,
+		CumulativeGasUsed: strconv.FormatUint(receipt.CumulativeGasUsed, 10),
+		GasUsed:           strconv.FormatUint(receipt.GasUsed, 10),
+		Confirmations:     strconv.FormatUint(confirmations, 10),
+		MethodID:          methodID,
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		ntx.ContractAddress = formatAddress(&receipt.ContractAddress)
+	}
+	return ntx, nil
+}
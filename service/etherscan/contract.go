@@ -0,0 +1,59 @@
+package etherscan
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// contractCreation is an item of the getcontractcreation result.
+type contractCreation struct {
+	ContractAddress string `json:"contractAddress"`
+	ContractCreator string `json:"contractCreator"`
+	TxHash          string `json:"txHash"`
+}
+
+// getContractCreation returns the creator and creation transaction of up to
+// five contracts, answered from the CREATE/CREATE2 frames.
+func (h *Handler) getContractCreation(r *http.Request) ([]*contractCreation, error) {
+	var addresses []common.Address
+	for _, v := range strings.Split(r.Form.Get("contractaddresses"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		addr, err := parseAddress(v)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, addr)
+	}
+	if len(addresses) == 0 {
+		return nil, errInvalidAddress
+	}
+	if len(addresses) > maxContractAddresses {
+		return nil, errors.New("Error! Maximum of 5 contract addresses allowed")
+	}
+	creations := make([]*contractCreation, 0, len(addresses))
+	for _, addr := range addresses {
+		frames, err := h.backend.ContractCreations(r.Context(), addr)
+		if err != nil {
+			return nil, err
+		}
+		// The most recent successful creation wins for redeployed addresses
+		for i := len(frames) - 1; i >= 0; i-- {
+			frame := frames[i]
+			if frame.Error != "" {
+				continue
+			}
+			creations = append(creations, &contractCreation{
+				ContractAddress: formatAddress(&addr),
+				ContractCreator: formatAddress(frame.Action.From),
+				TxHash:          frame.TransactionHash.Hex(),
+			})
+			break
+		}
+	}
+	return creations, nil
+}
@@ -0,0 +1,185 @@
+// Package etherscan serves a subset of the Etherscan REST API dialect, so
+// that scripts written against Etherscan can run against our own data.
+package etherscan
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+const (
+	// maxResultWindow is the maximum of page * offset, as enforced by Etherscan.
+	maxResultWindow = 10000
+
+	// maxContractAddresses is the maximum number of addresses accepted by
+	// getcontractcreation.
+	maxContractAddresses = 5
+
+	// maxBlockNumber bounds open ended block ranges, it fits into a bigint column.
+	maxBlockNumber = 1<<63 - 1
+)
+
+var (
+	errInvalidModule  = errors.New("Error! Missing Or invalid Module name")
+	errInvalidAction  = errors.New("Error! Missing Or invalid Action name")
+	errInvalidAddress = errors.New("Error! Invalid address format")
+	errInvalidTxHash  = errors.New("Error! Invalid txhash format")
+	errResultWindow   = errors.New("Result window is too large, PageNo x Offset size must be less than or equal to 10000")
+)
+
+// response is the envelope of every Etherscan API response.
+type response struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Result  interface{} `json:"result"`
+}
+
+// Handler serves the Etherscan compatible API.
+type Handler struct {
+	backend backend.Backend
+}
+
+// NewHandler creates the Etherscan compatible API handler.
+func NewHandler(backend backend.Backend) *Handler {
+	return &Handler{backend: backend}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeResponse(w, &response{Status: "0", Message: "NOTOK", Result: "Error! " + err.Error()})
+		return
+	}
+	var (
+		module = strings.ToLower(r.Form.Get("module"))
+		action = strings.ToLower(r.Form.Get("action"))
+		result interface{}
+		err    error
+	)
+	switch module {
+	case "account":
+		switch action {
+		case "txlistinternal":
+			result, err = h.txListInternal(r)
+		case "txlist":
+			result, err = h.txList(r)
+		default:
+			err = errInvalidAction
+		}
+	case "contract":
+		switch action {
+		case "getcontractcreation":
+			result, err = h.getContractCreation(r)
+		default:
+			err = errInvalidAction
+		}
+	default:
+		err = errInvalidModule
+	}
+	if err != nil {
+		logging.Ctx(r.Context()).Debug("Etherscan API request failed", "module", module, "action", action, "err", err)
+		writeResponse(w, &response{Status: "0", Message: "NOTOK", Result: err.Error()})
+		return
+	}
+	writeResponse(w, okResponse(result))
+}
+
+// okResponse wraps a successful result, Etherscan reports empty lists with
+// a zero status.
+func okResponse(result interface{}) *response {
+	switch list := result.(type) {
+	case []*internalTx:
+		if len(list) == 0 {
+			return &response{Status: "0", Message: "No transactions found", Result: list}
+		}
+	case []*normalTx:
+		if len(list) == 0 {
+			return &response{Status: "0", Message: "No transactions found", Result: list}
+		}
+	case []*contractCreation:
+		if len(list) == 0 {
+			return &response{Status: "0", Message: "No data found", Result: list}
+		}
+	}
+	return &response{Status: "1", Message: "OK", Result: result}
+}
+
+func writeResponse(w http.ResponseWriter, resp *response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// pagination are the common range, paging and sorting parameters.
+type pagination struct {
+	startBlock uint64
+	endBlock   uint64
+	offset     int
+	limit      int
+	descending bool
+}
+
+func parsePagination(r *http.Request) (*pagination, error) {
+	p := &pagination{endBlock: maxBlockNumber, limit: maxResultWindow}
+	if v := r.Form.Get("startblock"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("Error! Invalid startblock")
+		}
+		p.startBlock = n
+	}
+	if v := r.Form.Get("endblock"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("Error! Invalid endblock")
+		}
+		if n < maxBlockNumber {
+			p.endBlock = n
+		}
+	}
+	page, offset := 1, 0
+	if v := r.Form.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.New("Error! Invalid page number")
+		}
+		if n > 0 {
+			page = n
+		}
+	}
+	if v := r.Form.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.New("Error! Invalid offset")
+		}
+		offset = n
+	}
+	if offset > 0 {
+		if page*offset > maxResultWindow {
+			return nil, errResultWindow
+		}
+		p.offset, p.limit = (page-1)*offset, offset
+	}
+	switch strings.ToLower(r.Form.Get("sort")) {
+	case "", "asc":
+	case "desc":
+		p.descending = true
+	default:
+		return nil, errors.New("Error! Invalid sort order")
+	}
+	return p, nil
+}
+
+func parseAddress(v string) (common.Address, error) {
+	if !common.IsHexAddress(v) {
+		return common.Address{}, errInvalidAddress
+	}
+	return common.HexToAddress(v), nil
+}
@@ -0,0 +1,174 @@
+package etherscan
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+// testResponse is the envelope with the result left raw.
+type testResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+}
+
+func get(t *testing.T, b backend.Backend, query string) *testResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	NewHandler(b).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: have status %d, want %d", query, w.Code, http.StatusOK)
+	}
+	var resp testResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return &resp
+}
+
+// hashes returns the "hash/from/traceId" keys of a successful list result.
+func hashes(t *testing.T, query string, resp *testResponse) []string {
+	t.Helper()
+	if resp.Status != "1" || resp.Message != "OK" {
+		t.Fatalf("%s: have status %s (%s): %s", query, resp.Status, resp.Message, resp.Result)
+	}
+	var txs []struct {
+		Hash    string `json:"hash"`
+		From    string `json:"from"`
+		TraceID string `json:"traceId"`
+	}
+	if err := json.Unmarshal(resp.Result, &txs); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	list := make([]string, len(txs))
+	for i, tx := range txs {
+		list[i] = tx.Hash + "/" + tx.From + "/" + tx.TraceID
+	}
+	return list
+}
+
+func TestTxList(t *testing.T) {
+	var (
+		fixture  = upstreamtest.Fixture(t, "ethereum.json")
+		upstream = upstreamtest.NewServer(fixture)
+		sender   = "0x71562b71999873db5b286df957af199ec94617f7"
+		all      []string
+	)
+	defer upstream.Close()
+	upstream.Handle("eth_getBlockReceipts", upstreamtest.BlockReceipts(fixture))
+	b := upstreamtest.NewBackend(t, upstream, fixture.Chain, fixture)
+
+	for _, block := range fixture.Blocks {
+		for _, tx := range block.Transactions {
+			all = append(all, tx.Hash().Hex()+"/"+sender+"/")
+		}
+	}
+	reversed := make([]string, len(all))
+	for i, h := range all {
+		reversed[len(all)-1-i] = h
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", all},
+		{"&sort=asc", all},
+		{"&sort=desc", reversed},
+		{"&page=1&offset=3", all[:3]},
+		{"&page=2&offset=3", all[3:]},
+		{"&page=2&offset=2&sort=desc", reversed[2:4]},
+		{"&startblock=17034871&endblock=17034871", all[1:3]},
+	}
+	for _, tt := range tests {
+		query := "module=account&action=txlist&address=" + sender + tt.query
+		if have := hashes(t, query, get(t, b, query)); strings.Join(have, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: have %v, want %v", query, have, tt.want)
+		}
+	}
+}
+
+func TestTxListInternal(t *testing.T) {
+	var (
+		fixture = upstreamtest.Fixture(t, "ethereum.json")
+		b       = upstreamtest.NewDevBackend(t, fixture)
+		hash    = fixture.Blocks[2].Transactions[0].Hash().Hex()
+		factory = "0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f"
+		create  = hash + "/" + factory + "/0"
+		destroy = hash + "/0x00000000000000000000000000000000c0ffee00/0_0" // The created contract
+	)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"txhash=" + hash, []string{create, destroy}},
+		{"txhash=" + hash + "&sort=desc", []string{destroy, create}},
+		{"txhash=" + hash + "&page=2&offset=1", []string{destroy}},
+		{"address=" + factory + "&startblock=17034872", []string{create}},
+	}
+	for _, tt := range tests {
+		query := "module=account&action=txlistinternal&" + tt.query
+		if have := hashes(t, query, get(t, b, query)); strings.Join(have, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: have %v, want %v", query, have, tt.want)
+		}
+	}
+}
+
+func TestEmptyResult(t *testing.T) {
+	var (
+		fixture = upstreamtest.Fixture(t, "ethereum.json")
+		b       = upstreamtest.NewDevBackend(t, fixture)
+		hash    = fixture.Blocks[2].Transactions[0].Hash().Hex()
+	)
+	for _, query := range []string{
+		"module=account&action=txlistinternal&address=" + common.HexToAddress("0xdead").Hex(),
+		"module=account&action=txlistinternal&txhash=" + hash + "&page=3&offset=1",
+		"module=account&action=txlistinternal&txhash=" + fixture.Blocks[0].Transactions[0].Hash().Hex(),
+	} {
+		resp := get(t, b, query)
+		if resp.Status != "0" || resp.Message != "No transactions found" || string(resp.Result) != "[]" {
+			t.Errorf("%s: have %s (%s): %s, want an empty result", query, resp.Status, resp.Message, resp.Result)
+		}
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	var (
+		fixture = upstreamtest.Fixture(t, "ethereum.json")
+		b       = upstreamtest.NewDevBackend(t, fixture)
+		sender  = "0x71562b71999873db5b286df957af199ec94617f7"
+	)
+	tests := []struct {
+		query  string
+		result string
+	}{
+		{"module=unknown&action=txlist", errInvalidModule.Error()},
+		{"module=account&action=unknown", errInvalidAction.Error()},
+		{"module=account&action=txlist&address=0x1234", errInvalidAddress.Error()},
+		{"module=account&action=txlistinternal&txhash=0x1234", errInvalidTxHash.Error()},
+		{"module=account&action=txlistinternal", errInvalidAddress.Error()},
+		{"module=account&action=txlist&address=" + sender + "&page=2&offset=10000", errResultWindow.Error()},
+		{"module=account&action=txlist&address=" + sender + "&sort=up", "Error! Invalid sort order"},
+		{"module=account&action=txlist&address=" + sender + "&startblock=x", "Error! Invalid startblock"},
+		// Transaction details need an upstream
+		{"module=account&action=txlist&address=" + sender, backend.ErrOffline.Error()},
+	}
+	for _, tt := range tests {
+		resp := get(t, b, tt.query)
+		var result string
+		if err := json.Unmarshal(resp.Result, &result); err != nil {
+			t.Errorf("%s: result %s not a message", tt.query, resp.Result)
+			continue
+		}
+		if resp.Status != "0" || resp.Message != "NOTOK" || result != tt.result {
+			t.Errorf("%s: have %s (%s): %q, want 0 (NOTOK): %q", tt.query, resp.Status, resp.Message, result, tt.result)
+		}
+	}
+}
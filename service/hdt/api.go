@@ -0,0 +1,152 @@
+// Package hdt implements the hdt_ namespace, the analytical queries on top
+// of the traces table which have no counterpart in the standard namespaces.
+package hdt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/service/decoder"
+)
+
+const (
+	// defaultPageSize is the number of frames returned if no limit is given.
+	defaultPageSize = 100
+
+	// maxPageSize is the maximum number of frames returned by a single call.
+	maxPageSize = 1000
+
+	// maxBlockNumber bounds open ended block ranges, it fits into a bigint column.
+	maxBlockNumber = uint64(math.MaxInt64)
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// API is the collection of hdt APIs.
+type API struct {
+	backend backend.Backend
+	decoder *decoder.Decoder
+	tokens  *lru.Cache[common.Address, *TokenMetadata]
+}
+
+// NewAPI creates a new API definition for the hdt methods, the decoder is
+// optional.
+func NewAPI(backend backend.Backend, decoder *decoder.Decoder) *API {
+	return &API{
+		backend: backend,
+		decoder: decoder,
+		tokens:  lru.NewCache[common.Address, *TokenMetadata](tokenCacheLimit),
+	}
+}
+
+// AddressTracesOptions are the optional arguments of GetAddressTraces.
+type AddressTracesOptions struct {
+	FromBlock *hexutil.Uint64 `json:"fromBlock"`
+	ToBlock   *hexutil.Uint64 `json:"toBlock"`
+	Direction string          `json:"direction"` // "from", "to" or "both" (default)
+	Types     []string        `json:"types"`     // Trace types, e.g. "call", "create", "suicide", "reward"
+	Cursor    string          `json:"cursor"`    // Opaque cursor returned by a previous call
+	Limit     *hexutil.Uint64 `json:"limit"`
+}
+
+// AddressTracesResult is a page of frames and the cursor of the next page,
+// which is null once all frames have been returned.
+type AddressTracesResult struct {
+	Traces     []*backend.CallFrame `json:"traces"`
+	NextCursor *string              `json:"nextCursor"`
+}
+
+// encodeCursor encodes a backend cursor into an opaque string.
+func encodeCursor[T any](c *T) *string {
+	if c == nil {
+		return nil
+	}
+	blob, _ := json.Marshal(c)
+	s := base64.RawURLEncoding.EncodeToString(blob)
+	return &s
+}
+
+func decodeCursor[T any](s string) (*T, error) {
+	blob, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c T
+	if err := json.Unmarshal(blob, &c); err != nil {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+// GetAddressTraces returns the frames in which the address is the sender or
+// the receiver, in chain order. Results are paginated with a cursor which
+// stays valid while new blocks are indexed.
+func (api *API) GetAddressTraces(ctx context.Context, address common.Address, opts *AddressTracesOptions) (*AddressTracesResult, error) {
+	if opts == nil {
+		opts = new(AddressTracesOptions)
+	}
+	filter := &backend.TraceFilter{
+		Address: &address,
+		ToBlock: maxBlockNumber,
+		Types:   opts.Types,
+		Limit:   defaultPageSize,
+	}
+	if opts.FromBlock != nil {
+		filter.FromBlock = uint64(*opts.FromBlock)
+	}
+	if opts.ToBlock != nil && uint64(*opts.ToBlock) < maxBlockNumber {
+		filter.ToBlock = uint64(*opts.ToBlock)
+	}
+	switch opts.Direction {
+	case "", "both":
+		filter.Direction = backend.DirectionBoth
+	case "from":
+		filter.Direction = backend.DirectionFrom
+	case "to":
+		filter.Direction = backend.DirectionTo
+	default:
+		return nil, fmt.Errorf("invalid direction %q", opts.Direction)
+	}
+	if opts.Limit != nil {
+		if *opts.Limit == 0 || *opts.Limit > maxPageSize {
+			return nil, fmt.Errorf("limit must be within [1, %d]", maxPageSize)
+		}
+		filter.Limit = int(*opts.Limit)
+	}
+	if opts.Cursor != "" {
+		cursor, err := decodeCursor[backend.TraceCursor](opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = cursor
+	}
+	frames, cursor, err := api.backend.FilterTraces(ctx, filter)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if frames == nil {
+		frames = []*backend.CallFrame{}
+	}
+	return &AddressTracesResult{Traces: frames, NextCursor: encodeCursor(cursor)}, nil
+}
+
+// APIs return the collection of RPC services the hdt package offers, the
+// API is shared with the graph handler.
+func APIs(api *API) []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "hdt",
+			Service:   api,
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package hdt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+func newDevAPI(t *testing.T) (*API, *backend.Fixture) {
+	t.Helper()
+	fixture := upstreamtest.Fixture(t, "ethereum.json")
+	return NewAPI(upstreamtest.NewDevBackend(t, fixture), nil), fixture
+}
+
+func TestGetAddressTracesPages(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		api, f = newDevAPI(t)
+	)
+	// The sender of the transaction with sub calls
+	from := *f.Blocks[1].Traces[0].Action.From
+	all, err := api.GetAddressTraces(ctx, from, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Traces) < 2 || all.NextCursor != nil {
+		t.Fatalf("have %d frames and cursor %v, want a single page of several", len(all.Traces), all.NextCursor)
+	}
+
+	var (
+		limit = hexutil.Uint64(1)
+		opts  = &AddressTracesOptions{Limit: &limit}
+		seen  []*backend.CallFrame
+	)
+	for {
+		page, err := api.GetAddressTraces(ctx, from, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Traces) != 1 {
+			t.Fatalf("page of %d frames, want 1", len(page.Traces))
+		}
+		seen = append(seen, page.Traces[0])
+		if page.NextCursor == nil {
+			break
+		}
+		opts.Cursor = *page.NextCursor
+	}
+	if len(seen) != len(all.Traces) {
+		t.Fatalf("paged %d frames, want %d", len(seen), len(all.Traces))
+	}
+	for i, frame := range all.Traces {
+		if *seen[i].TransactionHash != *frame.TransactionHash || backend.CompareTraceAddress(seen[i].TraceAddress, frame.TraceAddress) != 0 {
+			t.Errorf("frame %d: paged %s %v, want %s %v", i, seen[i].TransactionHash, seen[i].TraceAddress, frame.TransactionHash, frame.TraceAddress)
+		}
+	}
+
+	if _, err := api.GetAddressTraces(ctx, from, &AddressTracesOptions{Cursor: "not a cursor"}); err != errInvalidCursor {
+		t.Errorf("invalid cursor: have %v, want %v", err, errInvalidCursor)
+	}
+}
+
+// TestErrorCodes checks the backend errors leave the API with their JSON-RPC
+// code, whichever method they come through.
+func TestErrorCodes(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		api, f  = newDevAPI(t)
+		unknown = common.HexToHash("0xdead")
+		beyond  = rpc.BlockNumber(f.Blocks[len(f.Blocks)-1].Header.Number.Int64() + 100)
+	)
+	calls := map[string]func() error{
+		"GetCallTree": func() error {
+			_, err := api.GetCallTree(ctx, unknown)
+			return err
+		},
+		"GetValueFlow": func() error {
+			_, err := api.GetValueFlow(ctx, unknown)
+			return err
+		},
+		"GetGasProfile": func() error {
+			_, err := api.GetGasProfile(ctx, unknown)
+			return err
+		},
+		"GetBalanceChanges": func() error {
+			_, err := api.GetBalanceChanges(ctx, BlockOrTx{Number: &beyond})
+			return err
+		},
+		"GetTransactionStatus": func() error {
+			_, err := api.GetTransactionStatus(ctx, BlockOrTx{Number: &beyond})
+			return err
+		},
+	}
+	for name, call := range calls {
+		err := call()
+		rpcErr, ok := err.(rpc.Error)
+		if !ok {
+			t.Errorf("%s: %v without a JSON-RPC code", name, err)
+			continue
+		}
+		if rpcErr.ErrorCode() != backend.CodeNotFound {
+			t.Errorf("%s: have code %d, want %d", name, rpcErr.ErrorCode(), backend.CodeNotFound)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package hdt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+// BlockOrTx is either a block number (or tag) or a transaction hash.
+type BlockOrTx struct {
+	Number *rpc.BlockNumber
+	Hash   *common.Hash
+}
+
+func (b *BlockOrTx) UnmarshalJSON(input []byte) error {
+	var s string
+	if err := json.Unmarshal(input, &s); err == nil && len(s) == 2+2*common.HashLength {
+		hash := common.HexToHash(s)
+		b.Hash = &hash
+		return nil
+	}
+	var number rpc.BlockNumber
+	if err := number.UnmarshalJSON(input); err != nil {
+		return fmt.Errorf("expected block number or transaction hash: %v", err)
+	}
+	b.Number = &number
+	return nil
+}
+
+// BalanceChange is the native balance change of an address, broken down by
+// its origin.
+type BalanceChange struct {
+	Address   common.Address `json:"address"`
+	Delta     *hexutil.Big   `json:"delta"`     // Net change of the balance
+	Transfers *hexutil.Big   `json:"transfers"` // Net value moved by calls, creations and self-destructs
+	Fees      *hexutil.Big   `json:"fees"`      // Gas fees paid (negative) or priority fees earned
+	Rewards   *hexutil.Big   `json:"rewards"`   // Block and uncle rewards and withdrawals
+}
+
+// BalanceChangesResult lists the balance changes of a block or transaction.
+type BalanceChangesResult struct {
+	BlockNumber     hexutil.Uint64   `json:"blockNumber"`
+	BlockHash       *common.Hash     `json:"blockHash"`
+	TransactionHash *common.Hash     `json:"transactionHash,omitempty"`
+	FeesIncluded    bool             `json:"feesIncluded"` // Whether receipts were available to account for gas fees
+	Changes         []*BalanceChange `json:"changes"`
+}
+
+// balanceSheet accumulates signed balance deltas per address and origin.
+type balanceSheet struct {
+	transfers map[common.Address]*big.Int
+	fees      map[common.Address]*big.Int
+	rewards   map[common.Address]*big.Int
+}
+
+func newBalanceSheet() *balanceSheet {
+	return &balanceSheet{
+		transfers: make(map[common.Address]*big.Int),
+		fees:      make(map[common.Address]*big.Int),
+		rewards:   make(map[common.Address]*big.Int),
+	}
+}
+
+func add(m map[common.Address]*big.Int, addr common.Address, amount *big.Int, neg bool) {
+	if amount == nil || amount.Sign() == 0 {
+		return
+	}
+	v, ok := m[addr]
+	if !ok {
+		v = new(big.Int)
+		m[addr] = v
+	}
+	if neg {
+		v.Sub(v, amount)
+	} else {
+		v.Add(v, amount)
+	}
+}
+
+// isReverted reports whether the frame or one of its ancestors failed, given
+// the trace addresses of the failed frames of the same transaction.
+func isReverted(frame *backend.CallFrame, failed [][]int) bool {
+	for _, prefix := range failed {
+		if len(prefix) > len(frame.TraceAddress) {
+			continue
+		}
+		match := true
+		for i := range prefix {
+			if prefix[i] != frame.TraceAddress[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// failedFrames returns the trace addresses of the failed frames per transaction.
+func failedFrames(frames []*backend.CallFrame) map[common.Hash][][]int {
+	failed := make(map[common.Hash][][]int)
+	for _, frame := range frames {
+		if frame.Error != "" && frame.TransactionHash != nil {
+			failed[*frame.TransactionHash] = append(failed[*frame.TransactionHash], frame.TraceAddress)
+		}
+	}
+	return failed
+}
+
+// addFrames accounts the value moved by the frames, skipping the subtrees of
+// failed frames as their effects were rolled back.
+func (s *balanceSheet) addFrames(frames []*backend.CallFrame) {
+	failed := failedFrames(frames)
+	for _, frame := range frames {
+		if frame.TransactionHash != nil && isReverted(frame, failed[*frame.TransactionHash]) {
+			continue
+		}
+		action := frame.Action
+		switch strings.ToLower(frame.Type) {
+		case "call":
+			// Delegate and static calls don't move value, callcode sends it
+			// back to the caller itself.
+			if action.CallType != "" && !strings.EqualFold(action.CallType, "call") {
+				continue
+			}
+			if action.From == nil || action.To == nil {
+				continue
+			}
+			add(s.transfers, *action.From, action.Value, true)
+			add(s.transfers, *action.To, action.Value, false)
+		case "create", "create2":
+			if action.From == nil || frame.Result == nil || frame.Result.Address == nil {
+				continue
+			}
+			add(s.transfers, *action.From, action.Value, true)
+			add(s.transfers, *frame.Result.Address, action.Value, false)
+		case "suicide", "selfdestruct":
+			if action.SelfDestructed == nil || action.RefundAddress == nil {
+				continue
+			}
+			add(s.transfers, *action.SelfDestructed, action.Balance, true)
+			add(s.transfers, *action.RefundAddress, action.Balance, false)
+		case "genesis", "daofork":
+			if action.To == nil {
+				continue
+			}
+			if action.From != nil {
+				add(s.transfers, *action.From, action.Value, true)
+			}
+			add(s.transfers, *action.To, action.Value, false)
+		case "reward":
+			if action.Author != nil {
+				add(s.rewards, *action.Author, action.Value, false)
+			}
+		}
+	}
+}
+
+// addFee accounts the gas fee of a transaction: the sender pays the full fee,
+// the coinbase earns the priority part and the base fee is burnt, as is the
+// blob fee of EIP-4844 transactions. It reports whether the receipt carried
+// the price to compute the fee.
+func (s *balanceSheet) addFee(sender, coinbase common.Address, receipt *types.Receipt, baseFee *big.Int) bool {
+	if receipt.EffectiveGasPrice == nil {
+		return false
+	}
+	gasUsed := new(big.Int).SetUint64(receipt.GasUsed)
+	add(s.fees, sender, new(big.Int).Mul(gasUsed, receipt.EffectiveGasPrice), true)
+
+	tip := new(big.Int).Set(receipt.EffectiveGasPrice)
+	if baseFee != nil {
+		tip.Sub(tip, baseFee)
+	}
+	add(s.fees, coinbase, tip.Mul(tip, gasUsed), false)
+
+	if receipt.BlobGasPrice != nil {
+		blobGasUsed := new(big.Int).SetUint64(receipt.BlobGasUsed)
+		add(s.fees, sender, blobGasUsed.Mul(blobGasUsed, receipt.BlobGasPrice), true)
+	}
+	return true
+}
+
+// addWithdrawals accounts the beacon chain withdrawals, denominated in gwei.
+func (s *balanceSheet) addWithdrawals(withdrawals types.Withdrawals) {
+	for _, w := range withdrawals {
+		amount := new(big.Int).SetUint64(w.Amount)
+		add(s.rewards, w.Address, amount.Mul(amount, big.NewInt(params.GWei)), false)
+	}
+}
+
+// changes returns the non-zero balance changes ordered by address.
+func (s *balanceSheet) changes() []*BalanceChange {
+	seen := make(map[common.Address]struct{})
+	for _, m := range []map[common.Address]*big.Int{s.transfers, s.fees, s.rewards} {
+		for addr := range m {
+			seen[addr] = struct{}{}
+		}
+	}
+	get := func(m map[common.Address]*big.Int, addr common.Address) *big.Int {
+		if v, ok := m[addr]; ok {
+			return v
+		}
+		return new(big.Int)
+	}
+	changes := make([]*BalanceChange, 0, len(seen))
+	for addr := range seen {
+		transfers, fees, rewards := get(s.transfers, addr), get(s.fees, addr), get(s.rewards, addr)
+		if transfers.Sign() == 0 && fees.Sign() == 0 && rewards.Sign() == 0 {
+			continue
+		}
+		delta := new(big.Int).Add(transfers, fees)
+		delta.Add(delta, rewards)
+		changes = append(changes, &BalanceChange{
+			Address:   addr,
+			Delta:     (*hexutil.Big)(delta),
+			Transfers: (*hexutil.Big)(transfers),
+			Fees:      (*hexutil.Big)(fees),
+			Rewards:   (*hexutil.Big)(rewards),
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return bytes.Compare(changes[i].Address[:], changes[j].Address[:]) < 0
+	})
+	return changes
+}
+
+// senders returns the sender of every transaction, taken from its top-level frame.
+func senders(frames []*backend.CallFrame) map[common.Hash]common.Address {
+	senders := make(map[common.Hash]common.Address)
+	for _, frame := range frames {
+		if len(frame.TraceAddress) == 0 && frame.TransactionHash != nil && frame.Action.From != nil {
+			senders[*frame.TransactionHash] = *frame.Action.From
+		}
+	}
+	return senders
+}
+
+// blockBalanceSheet accounts the balance changes of a whole block given its
+// frames. If the receipts are unavailable the gas fees are left out, unless
+// they are required, in which case an error is returned.
+func blockBalanceSheet(ctx context.Context, b backend.Backend, block *types.Block, frames []*backend.CallFrame, requireFees bool) (*balanceSheet, bool, error) {
+	sheet := newBalanceSheet()
+	sheet.addFrames(frames)
+	sheet.addWithdrawals(block.Withdrawals())
+
+	number := rpc.BlockNumber(block.NumberU64())
+	receipts, err := b.BlockReceipts(ctx, number)
+	if err != nil {
+		if requireFees {
+			return nil, false, err
+		}
+		logging.Ctx(ctx).Debug("Balance changes without fees", "number", number, "err", err)
+		return sheet, false, nil
+	}
+	froms := senders(frames)
+	for _, receipt := range receipts {
+		sender, ok := froms[receipt.TxHash]
+		if ok && sheet.addFee(sender, block.Coinbase(), receipt, block.BaseFee()) {
+			continue
+		}
+		if requireFees {
+			return nil, false, fmt.Errorf("fee of transaction %s not computable", receipt.TxHash.Hex())
+		}
+		logging.Ctx(ctx).Debug("Balance changes without fees", "number", number, "hash", receipt.TxHash)
+		return sheet, false, nil
+	}
+	return sheet, true, nil
+}
+
+// GetBalanceChanges returns the native balance changes caused by a block or
+// a single transaction, derived from its traces. Effects of reverted frames
+// are excluded, gas fees are included when the receipts are available.
+func (api *API) GetBalanceChanges(ctx context.Context, target BlockOrTx) (*BalanceChangesResult, error) {
+	if target.Number != nil {
+		block, err := api.backend.BlockByNumber(ctx, *target.Number)
+		if err != nil {
+			return nil, backend.RPCError(err)
+		}
+		frames, err := api.backend.TraceBlock(ctx, rpc.BlockNumber(block.NumberU64()))
+		if err != nil {
+			return nil, backend.RPCError(err)
+		}
+		sheet, feesIncluded, err := blockBalanceSheet(ctx, api.backend, block, frames, false)
+		if err != nil {
+			return nil, backend.RPCError(err)
+		}
+		hash := block.Hash()
+		return &BalanceChangesResult{
+			BlockNumber:  hexutil.Uint64(block.NumberU64()),
+			BlockHash:    &hash,
+			FeesIncluded: feesIncluded,
+			Changes:      sheet.changes(),
+		}, nil
+	}
+	frames, err := api.backend.TraceTransaction(ctx, *target.Hash)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no traces of transaction %s", target.Hash.Hex())
+	}
+	header, err := api.backend.HeaderByNumber(ctx, rpc.BlockNumber(frames[0].BlockNumber))
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	sheet := newBalanceSheet()
+	sheet.addFrames(frames)
+
+	feesIncluded := false
+	if receipt, err := api.backend.TransactionReceipt(ctx, *target.Hash); err == nil {
+		if sender, ok := senders(frames)[receipt.TxHash]; ok {
+			feesIncluded = sheet.addFee(sender, header.Coinbase, receipt, header.BaseFee)
+		}
+	} else {
+		logging.Ctx(ctx).Debug("Balance changes without fees", "hash", target.Hash, "err", err)
+	}
+	hash := header.Hash()
+	return &BalanceChangesResult{
+		BlockNumber:     hexutil.Uint64(header.Number.Uint64()),
+		BlockHash:       &hash,
+		TransactionHash: target.Hash,
+		FeesIncluded:    feesIncluded,
+		Changes:         sheet.changes(),
+	}, nil
+}
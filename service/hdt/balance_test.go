@@ -0,0 +1,131 @@
+package hdt
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+func TestBalanceSheet(t *testing.T) {
+	var (
+		tx     = common.HexToHash("0x01")
+		eoa    = common.HexToAddress("0xaa")
+		router = common.HexToAddress("0xbb")
+		vault  = common.HexToAddress("0xcc")
+		child  = common.HexToAddress("0xdd")
+		miner  = common.HexToAddress("0xee")
+		call   = func(from, to common.Address, value int64, traceAddress []int, err string) *backend.CallFrame {
+			return &backend.CallFrame{
+				Type:            "call",
+				TransactionHash: &tx,
+				TraceAddress:    traceAddress,
+				Error:           err,
+				Action:          backend.CallAction{CallType: "call", From: &from, To: &to, Value: big.NewInt(value)},
+			}
+		}
+	)
+	frames := []*backend.CallFrame{
+		call(eoa, router, 100, []int{}, ""),
+		call(router, vault, 60, []int{0}, ""),
+		// The reverted subtree must not move any value
+		call(router, child, 30, []int{1}, "execution reverted"),
+		call(child, vault, 10, []int{1, 0}, ""),
+		{
+			Type:            "call",
+			TransactionHash: &tx,
+			TraceAddress:    []int{2},
+			Action:          backend.CallAction{CallType: "delegatecall", From: &router, To: &child, Value: big.NewInt(5)},
+		},
+	}
+	sheet := newBalanceSheet()
+	sheet.addFrames(frames)
+	sheet.addFee(eoa, miner, &types.Receipt{GasUsed: 21000, EffectiveGasPrice: big.NewInt(3)}, big.NewInt(2))
+
+	want := map[common.Address]int64{
+		eoa:    -100 - 21000*3,
+		router: 40,
+		vault:  60,
+		miner:  21000,
+	}
+	changes := sheet.changes()
+	if len(changes) != len(want) {
+		t.Fatalf("changes mismatch: have %d, want %d", len(changes), len(want))
+	}
+	for _, c := range changes {
+		if delta := c.Delta.ToInt().Int64(); delta != want[c.Address] {
+			t.Errorf("delta mismatch for %x: have %d, want %d", c.Address, delta, want[c.Address])
+		}
+	}
+}
+
+func TestBalanceSheetRewardsAndFees(t *testing.T) {
+	var (
+		miner = common.HexToAddress("0xee")
+		eoa   = common.HexToAddress("0xaa")
+	)
+	sheet := newBalanceSheet()
+	sheet.addFrames([]*backend.CallFrame{{
+		Type:   "reward",
+		Action: backend.CallAction{Author: &miner, Value: big.NewInt(2e18), RewardType: "block"},
+	}})
+	// Receipts without the effective gas price leave the fee out
+	if sheet.addFee(eoa, miner, &types.Receipt{GasUsed: 21000}, nil) {
+		t.Error("fee accounted without the effective gas price")
+	}
+	changes := sheet.changes()
+	if len(changes) != 1 || changes[0].Address != miner || changes[0].Rewards.ToInt().Int64() != 2e18 {
+		t.Fatalf("changes mismatch: %+v", changes)
+	}
+	if !sheet.addFee(eoa, miner, &types.Receipt{GasUsed: 21000, EffectiveGasPrice: big.NewInt(1)}, nil) {
+		t.Error("fee not accounted")
+	}
+}
+
+// TestBalanceChangesBlobFee checks the sender of a blob transaction pays
+// the burnt blob fee on top of the gas fee.
+func TestBalanceChangesBlobFee(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		fixture  = upstreamtest.Fixture(t, "cancun.json")
+		block    = fixture.Blocks[0]
+		upstream = upstreamtest.NewServer(fixture)
+	)
+	defer upstream.Close()
+	upstream.Handle("eth_getBlockReceipts", upstreamtest.BlockReceipts(fixture))
+	api := NewAPI(upstreamtest.NewBackend(t, upstream, fixture.Chain, fixture), nil)
+
+	number := rpc.BlockNumber(block.Header.Number.Int64())
+	result, err := api.GetBalanceChanges(ctx, BlockOrTx{Number: &number})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.FeesIncluded {
+		t.Fatal("fees left out")
+	}
+	var (
+		tx       = block.Transactions[0]
+		sender   = *block.Traces[0].Action.From
+		price    = new(big.Int).Add(block.Header.BaseFee, tx.EffectiveGasTipValue(block.Header.BaseFee))
+		gasFee   = new(big.Int).Mul(big.NewInt(21000), price)
+		blobFee  = new(big.Int).Mul(new(big.Int).SetUint64(tx.BlobGas()), eip4844.CalcBlobFee(*block.Header.ExcessBlobGas))
+		wantFees = new(big.Int).Neg(new(big.Int).Add(gasFee, blobFee))
+	)
+	for _, c := range result.Changes {
+		if c.Address != sender {
+			continue
+		}
+		if c.Fees.ToInt().Cmp(wantFees) != 0 || c.Delta.ToInt().Cmp(wantFees) != 0 {
+			t.Errorf("sender fees %v, delta %v, want %v", c.Fees, c.Delta, wantFees)
+		}
+		return
+	}
+	t.Errorf("no balance change of the sender %s", sender)
+}
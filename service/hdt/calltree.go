@@ -0,0 +1,119 @@
+package hdt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// CallNode is a frame of a call tree.
+type CallNode struct {
+	Type         string                `json:"type"` // Call type for calls (call, delegatecall...), otherwise the trace type
+	From         *common.Address       `json:"from,omitempty"`
+	To           *common.Address       `json:"to,omitempty"`
+	Value        *hexutil.Big          `json:"value,omitempty"`
+	GasUsed      *hexutil.Uint64       `json:"gasUsed,omitempty"`
+	Error        string                `json:"error,omitempty"`
+	TraceAddress []int                 `json:"traceAddress"`
+	Decoded      *backend.DecodedCall  `json:"decoded,omitempty"`
+	RevertReason *backend.RevertReason `json:"revertReason,omitempty"`
+	Calls        []*CallNode           `json:"calls,omitempty"`
+}
+
+// CallTree is the nested call tree of a transaction.
+type CallTree struct {
+	TransactionHash common.Hash    `json:"transactionHash"`
+	BlockNumber     hexutil.Uint64 `json:"blockNumber"`
+	Root            *CallNode      `json:"root"`
+}
+
+func newCallNode(frame *backend.CallFrame) *CallNode {
+	action := frame.Action
+	node := &CallNode{
+		Type:         strings.ToLower(frame.Type),
+		From:         action.From,
+		To:           action.To,
+		Value:        (*hexutil.Big)(action.Value),
+		Error:        frame.Error,
+		TraceAddress: frame.TraceAddress,
+		Decoded:      frame.Decoded,
+		RevertReason: frame.RevertReason,
+	}
+	switch node.Type {
+	case "call":
+		if action.CallType != "" {
+			node.Type = strings.ToLower(action.CallType)
+		}
+	case "create", "create2":
+		if frame.Result != nil {
+			node.To = frame.Result.Address
+		}
+	case "suicide", "selfdestruct":
+		node.From, node.To, node.Value = action.SelfDestructed, action.RefundAddress, (*hexutil.Big)(action.Balance)
+	}
+	if frame.Result != nil && frame.Result.GasUsed != nil {
+		gasUsed := hexutil.Uint64(*frame.Result.GasUsed)
+		node.GasUsed = &gasUsed
+	}
+	return node
+}
+
+// buildCallTree nests the flat frames of a transaction by their trace address.
+func buildCallTree(frames []*backend.CallFrame) (*CallNode, error) {
+	var (
+		nodes = make(map[string]*CallNode, len(frames))
+		root  *CallNode
+	)
+	for _, frame := range frames {
+		nodes[fmt.Sprint(frame.TraceAddress)] = newCallNode(frame)
+	}
+	for _, frame := range frames {
+		node := nodes[fmt.Sprint(frame.TraceAddress)]
+		if len(frame.TraceAddress) == 0 {
+			root = node
+			continue
+		}
+		parent, ok := nodes[fmt.Sprint(frame.TraceAddress[:len(frame.TraceAddress)-1])]
+		if !ok {
+			return nil, fmt.Errorf("parent of frame %v missing", frame.TraceAddress)
+		}
+		parent.Calls = append(parent.Calls, node)
+	}
+	if root == nil {
+		return nil, fmt.Errorf("top-level frame missing")
+	}
+	// Siblings are ordered by their index, whatever the order of the frames
+	for _, node := range nodes {
+		sort.Slice(node.Calls, func(i, j int) bool {
+			a, b := node.Calls[i].TraceAddress, node.Calls[j].TraceAddress
+			return a[len(a)-1] < b[len(b)-1]
+		})
+	}
+	return root, nil
+}
+
+// GetCallTree returns the call tree of a transaction, with every frame
+// decoded when the decoder is available.
+func (api *API) GetCallTree(ctx context.Context, hash common.Hash) (*CallTree, error) {
+	frames, err := api.backend.TraceTransaction(ctx, hash)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no traces of transaction %s", hash.Hex())
+	}
+	if api.decoder != nil {
+		api.decoder.DecodeFrames(ctx, frames)
+	}
+	root, err := buildCallTree(frames)
+	if err != nil {
+		return nil, err
+	}
+	return &CallTree{TransactionHash: hash, BlockNumber: hexutil.Uint64(frames[0].BlockNumber), Root: root}, nil
+}
@@ -0,0 +1,59 @@
+package hdt
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+func TestCallTree(t *testing.T) {
+	var (
+		eoa    = common.HexToAddress("0xaa")
+		router = common.HexToAddress("0xbb")
+		vault  = common.HexToAddress("0xcc")
+		call   = func(callType string, from, to common.Address, traceAddress []int, err string) *backend.CallFrame {
+			gasUsed := uint64(100)
+			return &backend.CallFrame{
+				Type:         "call",
+				TraceAddress: traceAddress,
+				Error:        err,
+				Action:       backend.CallAction{CallType: callType, From: &from, To: &to, Value: big.NewInt(0)},
+				Result:       &backend.CallResult{GasUsed: &gasUsed},
+			}
+		}
+	)
+	// Siblings out of order, [10] sorted as text before [2]
+	frames := []*backend.CallFrame{call("call", eoa, router, []int{}, "")}
+	for _, i := range []int{0, 1, 10, 2, 3, 4, 5, 6, 7, 8, 9} {
+		frames = append(frames, call("staticcall", router, vault, []int{i}, ""))
+	}
+	frames = append(frames, call("delegatecall", vault, router, []int{10, 0}, "execution reverted"))
+
+	root, err := buildCallTree(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Calls) != 11 {
+		t.Fatalf("children mismatch: have %d, want 11", len(root.Calls))
+	}
+	for i, child := range root.Calls {
+		if child.TraceAddress[0] != i {
+			t.Errorf("child %d out of order: %v", i, child.TraceAddress)
+		}
+	}
+	last := root.Calls[10]
+	if len(last.Calls) != 1 || last.Calls[0].Type != "delegatecall" {
+		t.Fatalf("nested call missing: %+v", last.Calls)
+	}
+	text := (&CallTree{Root: root}).Text()
+	if !strings.Contains(text, "   └─ DELEGATECALL") || !strings.Contains(text, "error=execution reverted") {
+		t.Errorf("unexpected text tree:\n%s", text)
+	}
+	if _, err := buildCallTree(frames[1:]); err == nil {
+		t.Error("expected error without top-level frame")
+	}
+}
@@ -0,0 +1,150 @@
+package hdt
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// selfDestructTypes are the trace types of self-destruct frames, depending on
+// the client which produced the traces.
+var selfDestructTypes = []string{"suicide", "selfdestruct"}
+
+// ContractCreation describes a CREATE/CREATE2 frame which deployed a contract.
+type ContractCreation struct {
+	Address             common.Address  `json:"address"`
+	Creator             common.Address  `json:"creator"` // Account executing the creation, the factory for internal creations
+	CreationMethod      string          `json:"creationMethod"`
+	Factory             bool            `json:"factory"` // Whether the contract was created by another contract
+	TransactionHash     common.Hash     `json:"transactionHash"`
+	TransactionPosition uint64          `json:"transactionPosition"`
+	BlockNumber         uint64          `json:"blockNumber"`
+	BlockHash           *common.Hash    `json:"blockHash"`
+	TraceAddress        []int           `json:"traceAddress"`
+	DestroyedBlock      *hexutil.Uint64 `json:"destroyedBlock,omitempty"` // Block of the first self-destruct after the creation
+}
+
+// ContractCreatorResult is the latest creation of an address, along with the
+// earlier ones if the contract was self-destructed and redeployed.
+type ContractCreatorResult struct {
+	*ContractCreation
+	PreviousCreations []*ContractCreation `json:"previousCreations,omitempty"`
+}
+
+// ContractsCreatedResult is a page of contracts created by an account.
+type ContractsCreatedResult struct {
+	Contracts  []*ContractCreation `json:"contracts"`
+	NextCursor *string             `json:"nextCursor"`
+}
+
+// ContractRangeOptions are the optional arguments of GetContractsCreatedBy.
+type ContractRangeOptions struct {
+	FromBlock *hexutil.Uint64 `json:"fromBlock"`
+	ToBlock   *hexutil.Uint64 `json:"toBlock"`
+	Cursor    string          `json:"cursor"`
+	Limit     *hexutil.Uint64 `json:"limit"`
+}
+
+func newContractCreation(frame *backend.CallFrame) *ContractCreation {
+	c := &ContractCreation{
+		CreationMethod:      strings.ToLower(frame.Action.CreationMethod),
+		Factory:             len(frame.TraceAddress) > 0,
+		TransactionHash:     *frame.TransactionHash,
+		TransactionPosition: frame.TransactionPosition,
+		BlockNumber:         frame.BlockNumber,
+		BlockHash:           frame.BlockHash,
+		TraceAddress:        frame.TraceAddress,
+	}
+	if c.CreationMethod == "" {
+		c.CreationMethod = strings.ToLower(frame.Type)
+	}
+	if frame.Action.From != nil {
+		c.Creator = *frame.Action.From
+	}
+	if frame.Result != nil && frame.Result.Address != nil {
+		c.Address = *frame.Result.Address
+	}
+	return c
+}
+
+// GetContractCreator returns how the contract at address was created, or
+// null if no successful creation is known. Addresses reused after a
+// self-destruct (CREATE2 redeployments) report every creation.
+func (api *API) GetContractCreator(ctx context.Context, address common.Address) (*ContractCreatorResult, error) {
+	frames, err := api.backend.ContractCreations(ctx, address)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	var creations []*ContractCreation
+	for _, frame := range frames {
+		if frame.Error != "" {
+			continue
+		}
+		creations = append(creations, newContractCreation(frame))
+	}
+	if len(creations) == 0 {
+		return nil, nil
+	}
+	// Attach the self-destructs, the first one following each creation ends it
+	destructs, _, err := api.backend.FilterTraces(ctx, &backend.TraceFilter{
+		Address:   &address,
+		Direction: backend.DirectionFrom,
+		FromBlock: creations[0].BlockNumber,
+		ToBlock:   maxBlockNumber,
+		Types:     selfDestructTypes,
+	})
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	for _, c := range creations {
+		i := sort.Search(len(destructs), func(i int) bool {
+			d := destructs[i]
+			return d.BlockNumber > c.BlockNumber || (d.BlockNumber == c.BlockNumber && d.TransactionPosition >= c.TransactionPosition)
+		})
+		for ; i < len(destructs); i++ {
+			if destructs[i].Error == "" {
+				n := hexutil.Uint64(destructs[i].BlockNumber)
+				c.DestroyedBlock = &n
+				break
+			}
+		}
+	}
+	last := len(creations) - 1
+	result := &ContractCreatorResult{ContractCreation: creations[last]}
+	if last > 0 {
+		result.PreviousCreations = creations[:last]
+	}
+	return result, nil
+}
+
+// GetContractsCreatedBy returns the contracts created by an account, either
+// deployed directly or through a factory contract at address, in chain order.
+func (api *API) GetContractsCreatedBy(ctx context.Context, address common.Address, opts *ContractRangeOptions) (*ContractsCreatedResult, error) {
+	if opts == nil {
+		opts = new(ContractRangeOptions)
+	}
+	res, err := api.GetAddressTraces(ctx, address, &AddressTracesOptions{
+		FromBlock: opts.FromBlock,
+		ToBlock:   opts.ToBlock,
+		Direction: string(backend.DirectionFrom),
+		Types:     []string{"create", "create2"},
+		Cursor:    opts.Cursor,
+		Limit:     opts.Limit,
+	})
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	contracts := make([]*ContractCreation, 0, len(res.Traces))
+	for _, frame := range res.Traces {
+		if frame.Error != "" {
+			continue
+		}
+		contracts = append(contracts, newContractCreation(frame))
+	}
+	return &ContractsCreatedResult{Contracts: contracts, NextCursor: res.NextCursor}, nil
+}
@@ -0,0 +1,57 @@
+package hdt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestGetContractCreator(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		api, _  = newDevAPI(t)
+		eoa     = common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")
+		factory = common.HexToAddress("0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f")
+		direct  = common.HexToAddress("0x537e697c7ab75a26f9ecf0ce810e3154dfcaaf44")
+		child   = common.HexToAddress("0x00000000000000000000000000000000c0ffee00")
+	)
+	res, err := api.GetContractCreator(ctx, direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res == nil || res.Creator != eoa || res.Factory || res.CreationMethod != "create" || res.BlockNumber != 17034871 || res.DestroyedBlock != nil {
+		t.Errorf("direct deployment mismatch: %+v", res.ContractCreation)
+	}
+
+	// Deployed by a factory and self-destructed in the same transaction
+	res, err = api.GetContractCreator(ctx, child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res == nil || res.Creator != factory || !res.Factory || res.CreationMethod != "create2" || len(res.TraceAddress) != 1 {
+		t.Fatalf("factory deployment mismatch: %+v", res)
+	}
+	if res.DestroyedBlock == nil || *res.DestroyedBlock != 17034872 {
+		t.Errorf("destroyed block: have %v, want 17034872", res.DestroyedBlock)
+	}
+
+	if res, err := api.GetContractCreator(ctx, eoa); err != nil || res != nil {
+		t.Errorf("account without creation: have %+v, %v", res, err)
+	}
+
+	created, err := api.GetContractsCreatedBy(ctx, factory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Contracts) != 1 || created.Contracts[0].Address != child || created.NextCursor != nil {
+		t.Errorf("factory creations mismatch: %+v", created)
+	}
+	created, err = api.GetContractsCreatedBy(ctx, eoa, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Contracts) != 1 || created.Contracts[0].Address != direct {
+		t.Errorf("account creations mismatch: %+v", created)
+	}
+}
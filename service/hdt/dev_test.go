@@ -0,0 +1,35 @@
+package hdt
+
+import (
+	"context"
+	"testing"
+)
+
+// TestFixtureCallTree runs the call tree and gas profile of a fixture
+// transaction against the development backend.
+func TestFixtureCallTree(t *testing.T) {
+	var (
+		ctx          = context.Background()
+		api, fixture = newDevAPI(t)
+		hash         = fixture.Blocks[1].Transactions[0].Hash()
+	)
+
+	tree, err := api.GetCallTree(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.TransactionHash != hash || len(tree.Root.Calls) != 2 {
+		t.Fatalf("tree of %s with %d calls, want %s with 2", tree.TransactionHash, len(tree.Root.Calls), hash)
+	}
+	if failed := tree.Root.Calls[1]; failed.Error == "" || failed.RevertReason == nil {
+		t.Errorf("reverted sub call without error or reason: %+v", failed)
+	}
+
+	profile, err := api.GetGasProfile(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Frames) != 3 {
+		t.Errorf("profiled %d frames, want 3", len(profile.Frames))
+	}
+}
@@ -0,0 +1,238 @@
+package hdt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/shopspring/decimal"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+const (
+	// nativeAsset is the asset name of native value edges.
+	nativeAsset = "native"
+
+	// nativeSymbol labels native amounts in rendered graphs, it's cosmetic
+	// only as every supported chain has 18 decimals native currency.
+	nativeSymbol = "ETH"
+)
+
+// FlowNode is an account taking part in the value flow.
+type FlowNode struct {
+	Address  common.Address `json:"address"`
+	Sender   bool           `json:"sender,omitempty"` // Sender of the transaction
+	Symbol   string         `json:"symbol,omitempty"` // Symbol, if the account is a token contract
+	NetValue *hexutil.Big   `json:"netValue"`         // Net native value received
+}
+
+// FlowEdge is the aggregate of the transfers of an asset between two accounts.
+type FlowEdge struct {
+	From      common.Address  `json:"from"`
+	To        common.Address  `json:"to"`
+	Asset     string          `json:"asset"` // "native" or the token contract address
+	TokenType string          `json:"tokenType,omitempty"`
+	Symbol    string          `json:"symbol,omitempty"`
+	Decimals  *hexutil.Uint64 `json:"decimals,omitempty"`
+	Amount    *hexutil.Big    `json:"amount"`
+	TokenIDs  []*hexutil.Big  `json:"tokenIds,omitempty"` // Transferred ids of non-fungible tokens
+	Transfers hexutil.Uint64  `json:"transfers"`          // Number of aggregated transfers
+}
+
+// ValueFlow is the graph of the value moved by a transaction.
+type ValueFlow struct {
+	TransactionHash common.Hash    `json:"transactionHash"`
+	BlockNumber     hexutil.Uint64 `json:"blockNumber"`
+	TokensIncluded  bool           `json:"tokensIncluded"` // Whether token transfers were found
+	Nodes           []*FlowNode    `json:"nodes"`
+	Edges           []*FlowEdge    `json:"edges"`
+}
+
+// flowBuilder aggregates transfers into edges.
+type flowBuilder struct {
+	edges map[[2]common.Address]map[string]*FlowEdge
+	nodes map[common.Address]*FlowNode
+}
+
+func newFlowBuilder() *flowBuilder {
+	return &flowBuilder{
+		edges: make(map[[2]common.Address]map[string]*FlowEdge),
+		nodes: make(map[common.Address]*FlowNode),
+	}
+}
+
+func (b *flowBuilder) node(addr common.Address) *FlowNode {
+	n, ok := b.nodes[addr]
+	if !ok {
+		n = &FlowNode{Address: addr, NetValue: (*hexutil.Big)(new(big.Int))}
+		b.nodes[addr] = n
+	}
+	return n
+}
+
+func (b *flowBuilder) add(from, to common.Address, asset string, amount *big.Int) *FlowEdge {
+	b.node(from)
+	b.node(to)
+	key := [2]common.Address{from, to}
+	if b.edges[key] == nil {
+		b.edges[key] = make(map[string]*FlowEdge)
+	}
+	edge, ok := b.edges[key][asset]
+	if !ok {
+		edge = &FlowEdge{From: from, To: to, Asset: asset, Amount: (*hexutil.Big)(new(big.Int))}
+		b.edges[key][asset] = edge
+	}
+	edge.Amount.ToInt().Add(edge.Amount.ToInt(), amount)
+	edge.Transfers++
+	return edge
+}
+
+// addNative adds the value moved by the frames, following the same rules as
+// the balance changes: reverted subtrees and non-value calls are skipped.
+func (b *flowBuilder) addNative(frames []*backend.CallFrame) {
+	sheet := newBalanceSheet()
+	sheet.addFrames(frames)
+	failed := failedFrames(frames)
+	for _, frame := range frames {
+		var from, to *common.Address
+		amount := frame.Action.Value
+		switch strings.ToLower(frame.Type) {
+		case "call":
+			if frame.Action.CallType != "" && !strings.EqualFold(frame.Action.CallType, "call") {
+				continue
+			}
+			from, to = frame.Action.From, frame.Action.To
+		case "create", "create2":
+			if frame.Result != nil {
+				from, to = frame.Action.From, frame.Result.Address
+			}
+		case "suicide", "selfdestruct":
+			from, to, amount = frame.Action.SelfDestructed, frame.Action.RefundAddress, frame.Action.Balance
+		}
+		if from == nil || to == nil || amount == nil || amount.Sign() == 0 {
+			continue
+		}
+		if frame.TransactionHash != nil && isReverted(frame, failed[*frame.TransactionHash]) {
+			continue
+		}
+		b.add(*from, *to, nativeAsset, amount)
+	}
+	for addr, delta := range sheet.transfers {
+		b.node(addr).NetValue = (*hexutil.Big)(new(big.Int).Set(delta))
+	}
+}
+
+func (b *flowBuilder) addToken(t *backend.TokenTransfer, md *TokenMetadata) {
+	edge := b.add(t.From, t.To, strings.ToLower(t.Token.Hex()), t.Value.ToInt())
+	edge.TokenType = t.TokenType
+	if md != nil {
+		edge.Symbol, edge.Decimals = md.Symbol, md.Decimals
+		if md.Symbol != "" {
+			b.node(t.Token).Symbol = md.Symbol
+		}
+	}
+	if t.TokenID != nil && t.TokenType != backend.TokenERC20 {
+		edge.TokenIDs = append(edge.TokenIDs, t.TokenID)
+	}
+}
+
+func (b *flowBuilder) graph() ([]*FlowNode, []*FlowEdge) {
+	nodes := make([]*FlowNode, 0, len(b.nodes))
+	for _, n := range b.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return bytes.Compare(nodes[i].Address[:], nodes[j].Address[:]) < 0
+	})
+	var edges []*FlowEdge
+	for _, byAsset := range b.edges {
+		for _, e := range byAsset {
+			edges = append(edges, e)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if c := bytes.Compare(edges[i].From[:], edges[j].From[:]); c != 0 {
+			return c < 0
+		}
+		if c := bytes.Compare(edges[i].To[:], edges[j].To[:]); c != 0 {
+			return c < 0
+		}
+		return edges[i].Asset < edges[j].Asset
+	})
+	if edges == nil {
+		edges = []*FlowEdge{}
+	}
+	return nodes, edges
+}
+
+// GetValueFlow returns the graph of the native value and, when available,
+// the tokens moved by a transaction, aggregated per sender, receiver and asset.
+func (api *API) GetValueFlow(ctx context.Context, hash common.Hash) (*ValueFlow, error) {
+	frames, err := api.backend.TraceTransaction(ctx, hash)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no traces of transaction %s", hash.Hex())
+	}
+	b := newFlowBuilder()
+	b.addNative(frames)
+	if sender, ok := senders(frames)[hash]; ok {
+		b.node(sender).Sender = true
+	}
+	flow := &ValueFlow{TransactionHash: hash, BlockNumber: hexutil.Uint64(frames[0].BlockNumber)}
+
+	transfers, _, err := api.backend.TokenTransfers(ctx, &backend.TokenTransferFilter{
+		TransactionHash: &hash,
+		FromBlock:       frames[0].BlockNumber,
+		ToBlock:         frames[0].BlockNumber,
+	})
+	if err != nil {
+		logging.Ctx(ctx).Debug("Value flow without token transfers", "hash", hash, "err", err)
+	} else {
+		flow.TokensIncluded = len(transfers) > 0
+		for _, t := range transfers {
+			md, err := api.tokenMetadata(ctx, t.Token)
+			if err != nil {
+				logging.Ctx(ctx).Debug("Failed to fetch token metadata", "token", t.Token, "err", err)
+			}
+			b.addToken(t, md)
+		}
+	}
+	flow.Nodes, flow.Edges = b.graph()
+	return flow, nil
+}
+
+// formatAmount renders the amount of an edge in units of its asset.
+func formatAmount(e *FlowEdge) string {
+	switch {
+	case e.Asset == nativeAsset:
+		return decimal.NewFromBigInt(e.Amount.ToInt(), -18).String() + " " + nativeSymbol
+	case e.TokenType == backend.TokenERC721:
+		return fmt.Sprintf("%d NFT %s", len(e.TokenIDs), tokenName(e))
+	case e.Decimals != nil:
+		return decimal.NewFromBigInt(e.Amount.ToInt(), -int32(*e.Decimals)).String() + " " + tokenName(e)
+	default:
+		return e.Amount.ToInt().String() + " " + tokenName(e)
+	}
+}
+
+func tokenName(e *FlowEdge) string {
+	if e.Symbol != "" {
+		return e.Symbol
+	}
+	return shortAddress(common.HexToAddress(e.Asset))
+}
+
+// shortAddress abbreviates an address for graph labels.
+func shortAddress(addr common.Address) string {
+	hex := addr.Hex()
+	return hex[:6] + "…" + hex[len(hex)-4:]
+}
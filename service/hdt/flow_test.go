@@ -0,0 +1,62 @@
+package hdt
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+func TestValueFlow(t *testing.T) {
+	var (
+		tx       = common.HexToHash("0x01")
+		attacker = common.HexToAddress("0xaa")
+		pool     = common.HexToAddress("0xbb")
+		token    = common.HexToAddress("0xcc")
+		ether    = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+		call     = func(from, to common.Address, value *big.Int, traceAddress []int, err string) *backend.CallFrame {
+			return &backend.CallFrame{
+				Type:            "call",
+				TransactionHash: &tx,
+				TraceAddress:    traceAddress,
+				Error:           err,
+				Action:          backend.CallAction{CallType: "call", From: &from, To: &to, Value: value},
+			}
+		}
+	)
+	frames := []*backend.CallFrame{
+		call(attacker, pool, ether, []int{}, ""),
+		call(pool, attacker, big.NewInt(1), []int{0}, ""),
+		call(pool, attacker, big.NewInt(2), []int{1}, ""),
+		call(pool, attacker, ether, []int{2}, "execution reverted"),
+	}
+	b := newFlowBuilder()
+	b.addNative(frames)
+	decimals := hexutil.Uint64(6)
+	b.addToken(&backend.TokenTransfer{Token: token, TokenType: backend.TokenERC20, From: pool, To: attacker, Value: (*hexutil.Big)(big.NewInt(1500000))},
+		&TokenMetadata{Symbol: "USDC", Decimals: &decimals})
+
+	flow := &ValueFlow{TransactionHash: tx}
+	flow.Nodes, flow.Edges = b.graph()
+	if len(flow.Edges) != 3 {
+		t.Fatalf("have %d edges, want 3: %+v", len(flow.Edges), flow.Edges)
+	}
+	// Repeated transfers are aggregated, the reverted one is left out
+	back := flow.Edges[2]
+	if back.From != pool || back.To != attacker || back.Asset != nativeAsset || back.Amount.ToInt().Int64() != 3 || back.Transfers != 2 {
+		t.Errorf("unexpected edge %+v", back)
+	}
+	if have := formatAmount(flow.Edges[1]); have != "1.5 USDC" {
+		t.Errorf("have amount %q, want %q", have, "1.5 USDC")
+	}
+	if dot := flow.DOT(); !strings.Contains(dot, `-> "`+attacker.Hex()+`" [label="1.5 USDC"]`) {
+		t.Errorf("unexpected DOT output:\n%s", dot)
+	}
+	if mermaid := flow.Mermaid(); !strings.HasPrefix(mermaid, "flowchart LR\n") || !strings.Contains(mermaid, `-->|"1 ETH"|`) {
+		t.Errorf("unexpected Mermaid output:\n%s", mermaid)
+	}
+}
@@ -0,0 +1,243 @@
+package hdt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// maxGasProfileBlocks is the maximum number of blocks profiled by a single call.
+const maxGasProfileBlocks = 100
+
+// FrameGas is the gas used by a single frame. Inclusive gas counts the
+// subcalls, exclusive gas is spent by the frame's own code only.
+type FrameGas struct {
+	TraceAddress []int           `json:"traceAddress"`
+	Type         string          `json:"type"`
+	Address      *common.Address `json:"address"` // Callee, or the created contract
+	Selector     hexutil.Bytes   `json:"selector,omitempty"`
+	Signature    string          `json:"signature,omitempty"`
+	Inclusive    hexutil.Uint64  `json:"inclusive"`
+	Exclusive    hexutil.Uint64  `json:"exclusive"`
+}
+
+// GasUsage is the gas used by the frames of a contract, or of a function of
+// a contract if the selector is set. Inclusive gas of recursive calls is
+// counted at every level.
+type GasUsage struct {
+	Address   common.Address `json:"address"`
+	Selector  hexutil.Bytes  `json:"selector,omitempty"`
+	Signature string         `json:"signature,omitempty"`
+	Calls     hexutil.Uint64 `json:"calls"`
+	Inclusive hexutil.Uint64 `json:"inclusive"`
+	Exclusive hexutil.Uint64 `json:"exclusive"`
+}
+
+// GasProfile is the gas breakdown of a transaction or a block range, the
+// contracts and functions are ordered by exclusive gas, descending.
+type GasProfile struct {
+	TransactionHash *common.Hash   `json:"transactionHash,omitempty"`
+	FromBlock       hexutil.Uint64 `json:"fromBlock"`
+	ToBlock         hexutil.Uint64 `json:"toBlock"`
+	Transactions    hexutil.Uint64 `json:"transactions"`
+	GasUsed         hexutil.Uint64 `json:"gasUsed"`          // Execution gas of the top-level frames, without the intrinsic gas
+	Frames          []*FrameGas    `json:"frames,omitempty"` // Only for a single transaction
+	Contracts       []*GasUsage    `json:"contracts"`
+	Functions       []*GasUsage    `json:"functions"`
+}
+
+type gasKey struct {
+	address  common.Address
+	selector string
+}
+
+// gasProfiler accumulates the gas usage of frames per contract and function.
+type gasProfiler struct {
+	gasUsed   uint64
+	txs       map[common.Hash]struct{}
+	contracts map[gasKey]*GasUsage
+	functions map[gasKey]*GasUsage
+}
+
+func newGasProfiler() *gasProfiler {
+	return &gasProfiler{
+		txs:       make(map[common.Hash]struct{}),
+		contracts: make(map[gasKey]*GasUsage),
+		functions: make(map[gasKey]*GasUsage),
+	}
+}
+
+// frameGas computes the inclusive and exclusive gas of the frames carrying a
+// gas usage, rewards and self-destructs have none.
+func frameGas(frames []*backend.CallFrame) []*FrameGas {
+	type key struct {
+		tx   common.Hash
+		path string
+	}
+	var (
+		result   []*FrameGas
+		children = make(map[key]uint64)
+	)
+	for _, frame := range frames {
+		if frame.Result == nil || frame.Result.GasUsed == nil || frame.TransactionHash == nil || len(frame.TraceAddress) == 0 {
+			continue
+		}
+		parent := key{*frame.TransactionHash, fmt.Sprint(frame.TraceAddress[:len(frame.TraceAddress)-1])}
+		children[parent] += *frame.Result.GasUsed
+	}
+	for _, frame := range frames {
+		if frame.Result == nil || frame.Result.GasUsed == nil {
+			continue
+		}
+		f := &FrameGas{
+			TraceAddress: frame.TraceAddress,
+			Type:         strings.ToLower(frame.Type),
+			Address:      frame.Action.To,
+			Inclusive:    hexutil.Uint64(*frame.Result.GasUsed),
+			Exclusive:    hexutil.Uint64(*frame.Result.GasUsed),
+		}
+		switch f.Type {
+		case "call":
+			if frame.Action.CallType != "" {
+				f.Type = strings.ToLower(frame.Action.CallType)
+			}
+		case "create", "create2":
+			f.Address = frame.Result.Address
+		}
+		if input := frame.Action.Input; input != nil && len(*input) >= 4 && f.Type != "create" && f.Type != "create2" {
+			f.Selector = common.CopyBytes((*input)[:4])
+		}
+		if frame.Decoded != nil {
+			f.Signature = frame.Decoded.Signature
+		}
+		if frame.TransactionHash != nil {
+			// Failed subcalls may report more gas than the parent accounts for
+			if sub := children[key{*frame.TransactionHash, fmt.Sprint(frame.TraceAddress)}]; sub < uint64(f.Inclusive) {
+				f.Exclusive -= hexutil.Uint64(sub)
+			} else {
+				f.Exclusive = 0
+			}
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+func (p *gasProfiler) usage(m map[gasKey]*GasUsage, k gasKey, f *FrameGas) {
+	u, ok := m[k]
+	if !ok {
+		u = &GasUsage{Address: k.address}
+		if k.selector != "" {
+			u.Selector = f.Selector
+		}
+		m[k] = u
+	}
+	if u.Signature == "" && k.selector != "" {
+		u.Signature = f.Signature
+	}
+	u.Calls++
+	u.Inclusive += f.Inclusive
+	u.Exclusive += f.Exclusive
+}
+
+// add accounts the frames of one or more transactions.
+func (p *gasProfiler) add(frames []*backend.CallFrame) []*FrameGas {
+	for _, frame := range frames {
+		if frame.TransactionHash != nil {
+			p.txs[*frame.TransactionHash] = struct{}{}
+		}
+	}
+	gas := frameGas(frames)
+	for _, f := range gas {
+		if len(f.TraceAddress) == 0 {
+			p.gasUsed += uint64(f.Inclusive)
+		}
+		if f.Address == nil {
+			continue
+		}
+		p.usage(p.contracts, gasKey{address: *f.Address}, f)
+		p.usage(p.functions, gasKey{address: *f.Address, selector: string(f.Selector)}, f)
+	}
+	return gas
+}
+
+func sortedUsage(m map[gasKey]*GasUsage) []*GasUsage {
+	usage := make([]*GasUsage, 0, len(m))
+	for _, u := range m {
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Exclusive != usage[j].Exclusive {
+			return usage[i].Exclusive > usage[j].Exclusive
+		}
+		if c := bytes.Compare(usage[i].Address[:], usage[j].Address[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(usage[i].Selector, usage[j].Selector) < 0
+	})
+	return usage
+}
+
+func (p *gasProfiler) profile(fromBlock, toBlock uint64) *GasProfile {
+	return &GasProfile{
+		FromBlock:    hexutil.Uint64(fromBlock),
+		ToBlock:      hexutil.Uint64(toBlock),
+		Transactions: hexutil.Uint64(len(p.txs)),
+		GasUsed:      hexutil.Uint64(p.gasUsed),
+		Contracts:    sortedUsage(p.contracts),
+		Functions:    sortedUsage(p.functions),
+	}
+}
+
+// GetGasProfile returns the inclusive and exclusive gas of every frame of a
+// transaction, aggregated by contract and function.
+func (api *API) GetGasProfile(ctx context.Context, hash common.Hash) (*GasProfile, error) {
+	frames, err := api.backend.TraceTransaction(ctx, hash)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no traces of transaction %s", hash.Hex())
+	}
+	if api.decoder != nil {
+		api.decoder.DecodeFrames(ctx, frames)
+	}
+	p := newGasProfiler()
+	gas := p.add(frames)
+	profile := p.profile(frames[0].BlockNumber, frames[0].BlockNumber)
+	profile.TransactionHash = &hash
+	profile.Frames = gas
+	return profile, nil
+}
+
+// GetGasProfileRange aggregates the gas used by contracts and functions over
+// the transactions of a block range, both ends included.
+func (api *API) GetGasProfileRange(ctx context.Context, fromBlock, toBlock hexutil.Uint64) (*GasProfile, error) {
+	if fromBlock > toBlock {
+		return nil, errors.New("fromBlock is after toBlock")
+	}
+	if uint64(toBlock-fromBlock) >= maxGasProfileBlocks {
+		return nil, &backend.RangeTooLargeError{Size: uint64(toBlock-fromBlock) + 1, Max: maxGasProfileBlocks, What: "blocks"}
+	}
+	p := newGasProfiler()
+	for number := uint64(fromBlock); number <= uint64(toBlock); number++ {
+		frames, err := api.backend.TraceBlock(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return nil, backend.RPCError(err)
+		}
+		if api.decoder != nil {
+			api.decoder.DecodeFrames(ctx, frames)
+		}
+		p.add(frames)
+	}
+	return p.profile(uint64(fromBlock), uint64(toBlock)), nil
+}
@@ -0,0 +1,51 @@
+package hdt
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+func TestGasProfile(t *testing.T) {
+	var (
+		tx     = common.HexToHash("0x01")
+		eoa    = common.HexToAddress("0xaa")
+		router = common.HexToAddress("0xbb")
+		token  = common.HexToAddress("0xcc")
+		call   = func(to common.Address, selector byte, gasUsed uint64, traceAddress []int) *backend.CallFrame {
+			input := []byte{0, 0, 0, selector}
+			return &backend.CallFrame{
+				Type:            "call",
+				TransactionHash: &tx,
+				TraceAddress:    traceAddress,
+				Action:          backend.CallAction{CallType: "call", From: &eoa, To: &to, Input: &input},
+				Result:          &backend.CallResult{GasUsed: &gasUsed},
+			}
+		}
+	)
+	p := newGasProfiler()
+	gas := p.add([]*backend.CallFrame{
+		call(router, 1, 100000, []int{}),
+		call(token, 2, 30000, []int{0}),
+		call(token, 3, 20000, []int{1}),
+		call(router, 4, 5000, []int{1, 0}),
+	})
+	want := []uint64{50000, 30000, 15000, 5000}
+	for i, f := range gas {
+		if uint64(f.Exclusive) != want[i] {
+			t.Errorf("frame %v exclusive mismatch: have %d, want %d", f.TraceAddress, f.Exclusive, want[i])
+		}
+	}
+	profile := p.profile(1, 1)
+	if profile.GasUsed != 100000 || profile.Transactions != 1 {
+		t.Errorf("totals mismatch: have %d gas in %d txs", profile.GasUsed, profile.Transactions)
+	}
+	if len(profile.Contracts) != 2 || profile.Contracts[0].Address != router || profile.Contracts[0].Exclusive != 55000 || profile.Contracts[0].Calls != 2 {
+		t.Errorf("contracts mismatch: %+v", profile.Contracts)
+	}
+	if len(profile.Functions) != 4 || profile.Functions[1].Address != token || profile.Functions[1].Selector[3] != 2 {
+		t.Errorf("functions mismatch: %+v", profile.Functions)
+	}
+}
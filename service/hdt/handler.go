@@ -0,0 +1,135 @@
+package hdt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+var errInvalidHash = errors.New("invalid transaction hash")
+
+// Handler renders the hdt graphs over plain HTTP, for pasting into reports:
+//
+//	GET <prefix>flow/<txhash>?format=json|dot|mermaid        value flow of a transaction
+//	GET <prefix>calltree/<txhash>?format=json|text|dot|mermaid call tree of a transaction
+type Handler struct {
+	api    *API
+	prefix string
+}
+
+// NewHandler creates the graph handler mounted at prefix, serving the API
+// of the RPC service so both share the token metadata cache.
+func NewHandler(api *API, prefix string) *Handler {
+	return &Handler{api: api, prefix: prefix}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	kind, arg, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, h.prefix), "/"), "/")
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = FormatJSON
+	}
+	var (
+		result interface{}
+		err    error
+	)
+	switch kind {
+	case "flow":
+		result, err = h.flow(r, arg)
+	case "calltree":
+		result, err = h.callTree(r, arg)
+	default:
+		http.Error(w, "unknown graph", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.Ctx(r.Context()).Debug("Graph request failed", "path", r.URL.Path, "err", err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	render(w, result, format)
+}
+
+// httpStatus maps the error of a graph request to a status code, by the
+// JSON-RPC code of its backend error.
+func httpStatus(err error) int {
+	if errors.Is(err, errInvalidHash) {
+		return http.StatusBadRequest
+	}
+	var rpcErr rpc.Error
+	if !errors.As(backend.RPCError(err), &rpcErr) {
+		return http.StatusInternalServerError
+	}
+	switch rpcErr.ErrorCode() {
+	case backend.CodeNotFound, backend.CodePending, backend.CodeNotIndexed:
+		return http.StatusNotFound
+	case backend.CodeRangeTooLarge:
+		return http.StatusBadRequest
+	case backend.CodeUpstreamUnavailable:
+		return http.StatusBadGateway
+	case backend.CodeDBTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) flow(r *http.Request, arg string) (interface{}, error) {
+	hash, err := parseHash(arg)
+	if err != nil {
+		return nil, err
+	}
+	return h.api.GetValueFlow(r.Context(), hash)
+}
+
+func (h *Handler) callTree(r *http.Request, arg string) (interface{}, error) {
+	hash, err := parseHash(arg)
+	if err != nil {
+		return nil, err
+	}
+	return h.api.GetCallTree(r.Context(), hash)
+}
+
+func parseHash(s string) (common.Hash, error) {
+	if len(s) != 2+2*common.HashLength || !strings.HasPrefix(s, "0x") {
+		return common.Hash{}, errInvalidHash
+	}
+	return common.HexToHash(s), nil
+}
+
+// graph is a result renderable as DOT and Mermaid.
+type graph interface {
+	DOT() string
+	Mermaid() string
+}
+
+func render(w http.ResponseWriter, result interface{}, format string) {
+	g, ok := result.(graph)
+	t, isText := result.(interface{ Text() string })
+	switch {
+	case format == FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	case format == FormatDOT && ok:
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		w.Write([]byte(g.DOT()))
+	case format == FormatMermaid && ok:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(g.Mermaid()))
+	case format == FormatText && isText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(t.Text()))
+	default:
+		http.Error(w, "unsupported format "+format, http.StatusBadRequest)
+	}
+}
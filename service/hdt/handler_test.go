@@ -0,0 +1,64 @@
+package hdt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// failingBackend fails every trace lookup with an internal error.
+type failingBackend struct {
+	backend.Backend
+}
+
+func (b *failingBackend) TraceTransaction(ctx context.Context, txHash common.Hash) ([]*backend.CallFrame, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestHandlerStatus(t *testing.T) {
+	api, f := newDevAPI(t)
+	var (
+		known   = f.Blocks[0].Transactions[0].Hash().Hex()
+		unknown = common.HexToHash("0xdead").Hex()
+	)
+	tests := []struct {
+		api    *API
+		path   string
+		status int
+	}{
+		{api, "/hdt/flow/" + known, http.StatusOK},
+		{api, "/hdt/calltree/" + known + "?format=text", http.StatusOK},
+		{api, "/hdt/flow/0x1234", http.StatusBadRequest},
+		{api, "/hdt/flow/" + unknown, http.StatusNotFound},
+		{api, "/hdt/calltree/" + unknown, http.StatusNotFound},
+		{api, "/hdt/unknown/" + known, http.StatusNotFound},
+		{NewAPI(&failingBackend{}, nil), "/hdt/flow/" + known, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		NewHandler(tt.api, "/hdt/").ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: have status %d, want %d: %s", tt.path, w.Code, tt.status, w.Body)
+		}
+	}
+
+	// The fixture has no token transfers
+	w := httptest.NewRecorder()
+	NewHandler(api, "/hdt/").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hdt/flow/"+known, nil))
+	var flow struct {
+		TokensIncluded bool `json:"tokensIncluded"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&flow); err != nil {
+		t.Fatal(err)
+	}
+	if flow.TokensIncluded {
+		t.Error("flow without token transfers reported as including them")
+	}
+}
@@ -0,0 +1,161 @@
+package hdt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/jsvisa/hdt/backend"
+)
+
+const (
+	// maxHistoryPoints is the maximum number of points of a balance history.
+	maxHistoryPoints = 10000
+
+	// maxVerifyPoints is the maximum number of points checked against upstream.
+	maxVerifyPoints = 100
+)
+
+var errBalanceIndexEmpty = errors.New("balance index is empty, is the indexer enabled?")
+
+// BalanceHistoryOptions are the optional arguments of GetBalanceHistory.
+type BalanceHistoryOptions struct {
+	// Verify is the number of points, spread evenly over the series, which
+	// are checked against the upstream eth_getBalance.
+	Verify hexutil.Uint64 `json:"verify"`
+}
+
+// BalancePoint is the balance of an address at the end of a block.
+type BalancePoint struct {
+	BlockNumber     hexutil.Uint64 `json:"blockNumber"`
+	Balance         *hexutil.Big   `json:"balance"`
+	Delta           *hexutil.Big   `json:"delta,omitempty"`           // Change of the block, only for change points
+	UpstreamBalance *hexutil.Big   `json:"upstreamBalance,omitempty"` // Balance reported by upstream, only for verified points
+	Verified        *bool          `json:"verified,omitempty"`
+	VerifyError     string         `json:"verifyError,omitempty"`
+}
+
+// BalanceHistoryResult is the balance series of an address.
+type BalanceHistoryResult struct {
+	Address      common.Address  `json:"address"`
+	IndexedBlock hexutil.Uint64  `json:"indexedBlock"` // Last block covered by the checkpoints
+	Points       []*BalancePoint `json:"points"`
+	Mismatches   *hexutil.Uint64 `json:"mismatches,omitempty"` // Verified points differing from upstream
+}
+
+// GetBalanceHistory returns the native balance of the address over a block
+// range, served from the balance checkpoints instead of an archive node.
+// With a zero granularity a point is returned for the start of the range and
+// every block which changed the balance, otherwise the balance is sampled
+// every granularity blocks. The range is capped at the indexed block.
+func (api *API) GetBalanceHistory(ctx context.Context, address common.Address, fromBlock, toBlock, granularity hexutil.Uint64, opts *BalanceHistoryOptions) (*BalanceHistoryResult, error) {
+	if opts == nil {
+		opts = new(BalanceHistoryOptions)
+	}
+	if opts.Verify > maxVerifyPoints {
+		return nil, fmt.Errorf("verify must be at most %d", maxVerifyPoints)
+	}
+	head, ok, err := api.backend.BalanceIndexHead(ctx)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if !ok {
+		return nil, errBalanceIndexEmpty
+	}
+	from, to := uint64(fromBlock), uint64(toBlock)
+	if to > head {
+		to = head
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid block range [%d, %d], balances are indexed up to block %d", fromBlock, toBlock, head)
+	}
+	if granularity > 0 && (to-from)/uint64(granularity) >= maxHistoryPoints {
+		return nil, &backend.RangeTooLargeError{Size: (to-from)/uint64(granularity) + 1, Max: maxHistoryPoints, What: "points"}
+	}
+
+	start, err := api.backend.CheckpointBalances(ctx, []common.Address{address}, from)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	checkpoints, err := api.backend.BalanceCheckpoints(ctx, address, from, to)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if granularity == 0 && len(checkpoints) >= maxHistoryPoints {
+		return nil, &backend.RangeTooLargeError{Size: uint64(len(checkpoints)) + 1, Max: maxHistoryPoints, What: "points"}
+	}
+
+	var (
+		points  []*BalancePoint
+		balance = start[address]
+	)
+	if granularity == 0 {
+		if len(checkpoints) == 0 || checkpoints[0].BlockNum != from {
+			points = append(points, &BalancePoint{BlockNumber: hexutil.Uint64(from), Balance: (*hexutil.Big)(balance)})
+		}
+		for _, cp := range checkpoints {
+			point := &BalancePoint{
+				BlockNumber: hexutil.Uint64(cp.BlockNum),
+				Balance:     (*hexutil.Big)(cp.Balance.BigInt()),
+			}
+			// Opening balances seeded by the indexer are no change
+			if !cp.Delta.IsZero() {
+				point.Delta = (*hexutil.Big)(cp.Delta.BigInt())
+			}
+			points = append(points, point)
+		}
+	} else {
+		i := 0
+		for number := from; number <= to; number += uint64(granularity) {
+			for ; i < len(checkpoints) && checkpoints[i].BlockNum <= number; i++ {
+				balance = checkpoints[i].Balance.BigInt()
+			}
+			points = append(points, &BalancePoint{BlockNumber: hexutil.Uint64(number), Balance: (*hexutil.Big)(balance)})
+			if number+uint64(granularity) < number {
+				break // overflow
+			}
+		}
+	}
+	result := &BalanceHistoryResult{
+		Address:      address,
+		IndexedBlock: hexutil.Uint64(head),
+		Points:       points,
+	}
+	if opts.Verify > 0 {
+		mismatches := api.verifyBalances(ctx, address, points, int(opts.Verify))
+		result.Mismatches = &mismatches
+	}
+	return result, nil
+}
+
+// verifyBalances compares up to n points, spread evenly over the series,
+// with the balances reported by upstream, returning the number of mismatches.
+func (api *API) verifyBalances(ctx context.Context, address common.Address, points []*BalancePoint, n int) hexutil.Uint64 {
+	if n > len(points) {
+		n = len(points)
+	}
+	var mismatches hexutil.Uint64
+	for i := 0; i < n; i++ {
+		point := points[0]
+		if n > 1 {
+			point = points[i*(len(points)-1)/(n-1)]
+		}
+		upstream, err := api.backend.BalanceAt(ctx, address, rpc.BlockNumber(point.BlockNumber))
+		if err != nil {
+			// Pruned upstreams can't serve old state, which isn't a mismatch
+			point.VerifyError = err.Error()
+			continue
+		}
+		verified := upstream.Cmp((*big.Int)(point.Balance)) == 0
+		point.UpstreamBalance = (*hexutil.Big)(upstream)
+		point.Verified = &verified
+		if !verified {
+			mismatches++
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,222 @@
+package hdt
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// indexInterval is how often the indexer looks for newly finalized blocks.
+const indexInterval = 12 * time.Second
+
+// IndexerConfig configures the balance checkpoint indexer.
+type IndexerConfig struct {
+	// Confirmations is the depth below the head at which blocks are indexed,
+	// zero follows the upstream finalized tag.
+	Confirmations uint64
+
+	// StartBlock is the first block indexed into an empty table. Accounts
+	// first touched after a non-zero start block are seeded with their
+	// upstream balance, which requires an archive upstream.
+	StartBlock uint64
+
+	// Genesis is the allocation of the genesis block, used when the traces
+	// table carries no genesis traces.
+	Genesis core.GenesisAlloc
+
+	// DAOForkBlock is the block of the DAO hard fork, if the chain had it,
+	// whose irregular state change is applied when no daofork traces exist.
+	DAOForkBlock *big.Int
+	DAODrainList []common.Address
+	DAORefund    common.Address
+}
+
+// Indexer maintains the balance checkpoints table, extending it block by
+// block up to the finalized head.
+type Indexer struct {
+	backend backend.Backend
+	config  *IndexerConfig
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewIndexer creates a balance checkpoint indexer, start it by registering
+// it as a lifecycle of the node.
+func NewIndexer(backend backend.Backend, config *IndexerConfig) *Indexer {
+	return &Indexer{
+		backend: backend,
+		config:  config,
+		quit:    make(chan struct{}),
+	}
+}
+
+// Start implements node.Lifecycle, launching the indexing loop.
+func (idx *Indexer) Start() error {
+	idx.wg.Add(1)
+	go idx.loop()
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating the indexing loop.
+func (idx *Indexer) Stop() error {
+	close(idx.quit)
+	idx.wg.Wait()
+	return nil
+}
+
+func (idx *Indexer) loop() {
+	defer idx.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-idx.quit
+		cancel()
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if err := idx.sync(ctx); err != nil && ctx.Err() == nil {
+				log.Warn("Failed to index balance checkpoints", "err", err)
+			}
+			timer.Reset(indexInterval)
+		case <-idx.quit:
+			return
+		}
+	}
+}
+
+// sync indexes all blocks between the last indexed and the finalized one.
+func (idx *Indexer) sync(ctx context.Context) error {
+	head, ok, err := idx.backend.BalanceIndexHead(ctx)
+	if err != nil {
+		return err
+	}
+	next := idx.config.StartBlock
+	if ok {
+		next = head + 1
+	}
+	finalized, err := backend.FinalizedNumber(ctx, idx.backend, idx.config.Confirmations)
+	if err != nil {
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for number := next; number <= finalized; number++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := idx.index(ctx, number); err != nil {
+			return fmt.Errorf("block %d: %w", number, err)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Indexing balance checkpoints", "number", number, "finalized", finalized, "elapsed", time.Since(start))
+			logged = time.Now()
+		}
+	}
+	if next <= finalized {
+		log.Debug("Indexed balance checkpoints", "from", next, "to", finalized, "elapsed", time.Since(start))
+	}
+	return nil
+}
+
+// index writes the checkpoints of a single block.
+func (idx *Indexer) index(ctx context.Context, number uint64) error {
+	block, err := idx.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		return err
+	}
+	frames, err := idx.backend.TraceBlock(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		return err
+	}
+	// Don't skip over blocks whose traces haven't been loaded yet
+	if len(senders(frames)) < len(block.Transactions()) {
+		return fmt.Errorf("traces of %d transactions missing", len(block.Transactions())-len(senders(frames)))
+	}
+	// Fees must be accounted, otherwise every later checkpoint is off
+	sheet, _, err := blockBalanceSheet(ctx, idx.backend, block, frames, true)
+	if err != nil {
+		return err
+	}
+	if number == 0 && !hasFrameType(frames, "genesis") {
+		for addr, account := range idx.config.Genesis {
+			add(sheet.transfers, addr, account.Balance, false)
+		}
+	}
+	if fork := idx.config.DAOForkBlock; fork != nil && fork.Uint64() == number && !hasFrameType(frames, "daofork") {
+		balances, err := idx.backend.CheckpointBalances(ctx, idx.config.DAODrainList, number)
+		if err != nil {
+			return err
+		}
+		for _, addr := range idx.config.DAODrainList {
+			add(sheet.transfers, addr, balances[addr], true)
+			add(sheet.transfers, idx.config.DAORefund, balances[addr], false)
+		}
+	}
+	deltas := make(map[common.Address]*big.Int)
+	for _, change := range sheet.changes() {
+		if change.Delta.ToInt().Sign() != 0 {
+			deltas[change.Address] = change.Delta.ToInt()
+		}
+	}
+	if idx.config.StartBlock > 0 && len(deltas) > 0 {
+		if err := idx.seed(ctx, number, deltas); err != nil {
+			return err
+		}
+	}
+	return idx.backend.WriteBalanceCheckpoints(ctx, number, deltas)
+}
+
+// seed writes the opening balances of the accounts without a checkpoint as
+// of the previous block, which the history before the start block lacks.
+func (idx *Indexer) seed(ctx context.Context, number uint64, deltas map[common.Address]*big.Int) error {
+	addresses := make([]common.Address, 0, len(deltas))
+	for addr := range deltas {
+		addresses = append(addresses, addr)
+	}
+	balances, err := idx.backend.CheckpointBalances(ctx, addresses, number)
+	if err != nil {
+		return err
+	}
+	seeds := make(map[common.Address]*big.Int)
+	for _, addr := range addresses {
+		// Unknown and emptied accounts look the same, upstream tells them apart
+		if balances[addr].Sign() != 0 {
+			continue
+		}
+		balance, err := idx.backend.BalanceAt(ctx, addr, rpc.BlockNumber(number-1))
+		if err != nil {
+			return fmt.Errorf("opening balance of %s: %w", addr, err)
+		}
+		if balance.Sign() != 0 {
+			seeds[addr] = balance
+		}
+	}
+	return idx.backend.SeedBalanceCheckpoints(ctx, number-1, seeds)
+}
+
+func hasFrameType(frames []*backend.CallFrame, typ string) bool {
+	for _, frame := range frames {
+		if strings.EqualFold(frame.Type, typ) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package hdt
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+// TestIndexerStartBlock indexes the fixture from its first block, seeding
+// the opening balances from upstream, and reads the history back.
+func TestIndexerStartBlock(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		fixture = upstreamtest.Fixture(t, "ethereum.json")
+		first   = fixture.Blocks[0].Header.Number.Uint64()
+		last    = fixture.Blocks[len(fixture.Blocks)-1].Header.Number.Uint64()
+		to      = common.HexToAddress("0xb0b0")
+		value   = fixture.Blocks[0].Transactions[0].Value()
+		ether   = big.NewInt(1e18)
+	)
+
+	upstream := upstreamtest.NewServer(fixture)
+	defer upstream.Close()
+	upstream.SetFinalized(last)
+	upstream.Handle("eth_getBlockReceipts", upstreamtest.BlockReceipts(fixture))
+	var (
+		mu     sync.Mutex
+		seeded []uint64
+	)
+	upstream.Handle("eth_getBalance", func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		var (
+			addr   common.Address
+			number rpc.BlockNumber
+		)
+		if err := json.Unmarshal(params[0], &addr); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(params[1], &number); err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		seeded = append(seeded, uint64(number))
+		mu.Unlock()
+		if addr == to {
+			return (*hexutil.Big)(ether), nil
+		}
+		return (*hexutil.Big)(new(big.Int).Mul(ether, big.NewInt(100))), nil
+	})
+
+	b := upstreamtest.NewBackend(t, upstream, fixture.Chain, fixture)
+	idx := NewIndexer(b, &IndexerConfig{StartBlock: first})
+	if err := idx.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	head, ok, err := b.BalanceIndexHead(ctx)
+	if err != nil || !ok || head != last {
+		t.Fatalf("index head %d (%v, %v), want %d", head, ok, err, last)
+	}
+	mu.Lock()
+	if len(seeded) == 0 {
+		t.Fatal("no opening balance fetched from upstream")
+	}
+	for _, number := range seeded {
+		if number < first-1 {
+			t.Errorf("opening balance fetched at block %d, before the start block", number)
+		}
+	}
+	mu.Unlock()
+	// Re-syncing the indexed range is a no-op
+	calls := upstream.Calls("eth_getBalance")
+	if err := idx.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if have := upstream.Calls("eth_getBalance"); have != calls {
+		t.Errorf("re-sync fetched %d more balances", have-calls)
+	}
+
+	api := NewAPI(b, nil)
+	history, err := api.GetBalanceHistory(ctx, to, hexutil.Uint64(first-1), hexutil.Uint64(last), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := new(big.Int).Add(ether, value)
+	if len(history.Points) != 2 {
+		t.Fatalf("have %d points, want the opening balance and one change", len(history.Points))
+	}
+	if p := history.Points[0]; uint64(p.BlockNumber) != first-1 || p.Balance.ToInt().Cmp(ether) != 0 || p.Delta != nil {
+		t.Errorf("opening point %d: %v (%v), want %d: %v (no change)", p.BlockNumber, p.Balance, p.Delta, first-1, ether)
+	}
+	checkpoints, err := b.BalanceCheckpoints(ctx, to, first-1, first-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 1 || !checkpoints[0].Delta.IsZero() {
+		t.Errorf("opening checkpoints %+v, want one with a zero delta", checkpoints)
+	}
+	if p := history.Points[1]; uint64(p.BlockNumber) != first || p.Balance.ToInt().Cmp(after) != 0 || p.Delta.ToInt().Cmp(value) != 0 {
+		t.Errorf("change point %d: %v (%v), want %d: %v (%v)", p.BlockNumber, p.Balance, p.Delta, first, after, value)
+	}
+
+	sampled, err := api.GetBalanceHistory(ctx, to, hexutil.Uint64(first), hexutil.Uint64(last), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sampled.Points) != int(last-first+1) {
+		t.Fatalf("have %d sampled points, want %d", len(sampled.Points), last-first+1)
+	}
+	for _, p := range sampled.Points {
+		if p.Balance.ToInt().Cmp(after) != 0 {
+			t.Errorf("block %d: have %v, want %v", p.BlockNumber, p.Balance, after)
+		}
+	}
+	// The range is capped at the indexed block
+	if _, err := api.GetBalanceHistory(ctx, to, hexutil.Uint64(last+1), hexutil.Uint64(last+10), 0, nil); err == nil {
+		t.Error("range above the indexed block accepted")
+	}
+}
+
+// TestIndexerBlobFee indexes a block with a blob transaction, whose sender
+// pays the burnt blob fee on top of the gas fee.
+func TestIndexerBlobFee(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		fixture  = upstreamtest.Fixture(t, "cancun.json")
+		block    = fixture.Blocks[0]
+		number   = block.Header.Number.Uint64()
+		opening  = new(big.Int).Mul(big.NewInt(1e18), big.NewInt(100))
+		upstream = upstreamtest.NewServer(fixture)
+	)
+	defer upstream.Close()
+	upstream.SetFinalized(number)
+	upstream.Handle("eth_getBlockReceipts", upstreamtest.BlockReceipts(fixture))
+	upstream.Handle("eth_getBalance", func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		return (*hexutil.Big)(opening), nil
+	})
+
+	b := upstreamtest.NewBackend(t, upstream, fixture.Chain, fixture)
+	if err := NewIndexer(b, &IndexerConfig{StartBlock: number}).sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		tx      = block.Transactions[0]
+		sender  = *block.Traces[0].Action.From
+		price   = new(big.Int).Add(block.Header.BaseFee, tx.EffectiveGasTipValue(block.Header.BaseFee))
+		gasFee  = new(big.Int).Mul(big.NewInt(21000), price)
+		blobFee = new(big.Int).Mul(new(big.Int).SetUint64(tx.BlobGas()), eip4844.CalcBlobFee(*block.Header.ExcessBlobGas))
+		want    = new(big.Int).Neg(new(big.Int).Add(gasFee, blobFee))
+	)
+	checkpoints, err := b.BalanceCheckpoints(ctx, sender, number, number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 1 {
+		t.Fatalf("have %d checkpoints of the sender, want 1", len(checkpoints))
+	}
+	if cp := checkpoints[0]; cp.Delta.BigInt().Cmp(want) != 0 || cp.Balance.BigInt().Cmp(new(big.Int).Add(opening, want)) != 0 {
+		t.Errorf("sender delta %v, balance %v, want %v, %v", cp.Delta, cp.Balance, want, new(big.Int).Add(opening, want))
+	}
+}
@@ -0,0 +1,201 @@
+package hdt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+)
+
+// Graph output formats.
+const (
+	FormatJSON    = "json"
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+	FormatText    = "text"
+)
+
+// dotQuote quotes a string as a Graphviz ID.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// mermaidQuote quotes a string as a Mermaid label.
+func mermaidQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, "#quot;", "\n", "<br/>").Replace(s) + `"`
+}
+
+func flowNodeLabel(n *FlowNode) string {
+	label := shortAddress(n.Address)
+	if n.Symbol != "" {
+		label += "\n" + n.Symbol
+	}
+	if n.Sender {
+		label += "\n(sender)"
+	}
+	return label
+}
+
+func flowEdgeLabel(e *FlowEdge) string {
+	label := formatAmount(e)
+	if e.Transfers > 1 {
+		label += fmt.Sprintf(" (%d×)", e.Transfers)
+	}
+	return label
+}
+
+// DOT renders the value flow as a Graphviz digraph.
+func (f *ValueFlow) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(f.TransactionHash.Hex()))
+	b.WriteString("  rankdir=LR;\n  node [shape=box, fontname=monospace];\n")
+	for _, n := range f.Nodes {
+		attrs := "label=" + dotQuote(flowNodeLabel(n))
+		if n.Sender {
+			attrs += ", style=bold"
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(n.Address.Hex()), attrs)
+	}
+	for _, e := range f.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotQuote(e.From.Hex()), dotQuote(e.To.Hex()), dotQuote(flowEdgeLabel(e)))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the value flow as a Mermaid flowchart.
+func (f *ValueFlow) Mermaid() string {
+	ids := make(map[common.Address]string, len(f.Nodes))
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, n := range f.Nodes {
+		ids[n.Address] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "  %s[%s]\n", ids[n.Address], mermaidQuote(flowNodeLabel(n)))
+	}
+	for _, e := range f.Edges {
+		fmt.Fprintf(&b, "  %s -->|%s| %s\n", ids[e.From], mermaidQuote(flowEdgeLabel(e)), ids[e.To])
+	}
+	return b.String()
+}
+
+// method names the function called by the node, if known.
+func (n *CallNode) method() string {
+	switch {
+	case n.Decoded == nil:
+		return ""
+	case n.Decoded.Signature != "":
+		return n.Decoded.Signature
+	default:
+		return n.Decoded.Selector.String()
+	}
+}
+
+// label describes the node on a single line.
+func (n *CallNode) label() string {
+	parts := []string{strings.ToUpper(n.Type)}
+	from, to := "?", "?"
+	if n.From != nil {
+		from = shortAddress(*n.From)
+	}
+	if n.To != nil {
+		to = shortAddress(*n.To)
+	}
+	parts = append(parts, from+" → "+to)
+	if m := n.method(); m != "" {
+		parts = append(parts, m)
+	}
+	if n.Value != nil && n.Value.ToInt().Sign() > 0 {
+		parts = append(parts, "value="+decimal.NewFromBigInt(n.Value.ToInt(), -18).String()+" "+nativeSymbol)
+	}
+	if n.GasUsed != nil {
+		parts = append(parts, fmt.Sprintf("gasUsed=%d", uint64(*n.GasUsed)))
+	}
+	if n.Error != "" {
+		e := "error=" + n.Error
+		if r := n.RevertReason; r != nil && r.Message != "" {
+			e += " (" + r.Message + ")"
+		}
+		parts = append(parts, e)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Text renders the call tree as an indented text tree.
+func (t *CallTree) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (block %d)\n", t.TransactionHash.Hex(), uint64(t.BlockNumber))
+	var walk func(n *CallNode, prefix string, last bool, top bool)
+	walk = func(n *CallNode, prefix string, last bool, top bool) {
+		branch, indent := "├─ ", "│  "
+		if last {
+			branch, indent = "└─ ", "   "
+		}
+		if top {
+			branch, indent = "", ""
+		}
+		b.WriteString(prefix + branch + n.label() + "\n")
+		for i, child := range n.Calls {
+			walk(child, prefix+indent, i == len(n.Calls)-1, false)
+		}
+	}
+	walk(t.Root, "", true, true)
+	return b.String()
+}
+
+func (t *CallTree) walk(fn func(id string, n *CallNode, parent string)) {
+	var visit func(n *CallNode, parent string)
+	visit = func(n *CallNode, parent string) {
+		id := "f"
+		for _, i := range n.TraceAddress {
+			id += fmt.Sprintf("_%d", i)
+		}
+		fn(id, n, parent)
+		for _, child := range n.Calls {
+			visit(child, id)
+		}
+	}
+	visit(t.Root, "")
+}
+
+// DOT renders the call tree as a Graphviz digraph.
+func (t *CallTree) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(t.TransactionHash.Hex()))
+	b.WriteString("  node [shape=box, fontname=monospace];\n")
+	t.walk(func(id string, n *CallNode, parent string) {
+		attrs := "label=" + dotQuote(strings.Replace(n.label(), " ", "\n", 2))
+		if n.Error != "" {
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", id, attrs)
+		if parent != "" {
+			fmt.Fprintf(&b, "  %s -> %s;\n", parent, id)
+		}
+	})
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the call tree as a Mermaid flowchart.
+func (t *CallTree) Mermaid() string {
+	var (
+		b      strings.Builder
+		failed []string
+	)
+	b.WriteString("flowchart TD\n")
+	t.walk(func(id string, n *CallNode, parent string) {
+		fmt.Fprintf(&b, "  %s[%s]\n", id, mermaidQuote(strings.Replace(n.label(), " ", "\n", 2)))
+		if parent != "" {
+			fmt.Fprintf(&b, "  %s --> %s\n", parent, id)
+		}
+		if n.Error != "" {
+			failed = append(failed, id)
+		}
+	})
+	if len(failed) > 0 {
+		b.WriteString("  classDef failed stroke:#d00,color:#d00\n")
+		fmt.Fprintf(&b, "  class %s failed\n", strings.Join(failed, ","))
+	}
+	return b.String()
+}
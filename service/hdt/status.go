@@ -0,0 +1,92 @@
+package hdt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// Transaction outcomes.
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// TransactionStatus is the outcome of a transaction, taken from its traces.
+type TransactionStatus struct {
+	TransactionHash     common.Hash           `json:"transactionHash"`
+	TransactionPosition hexutil.Uint64        `json:"transactionPosition"`
+	BlockNumber         hexutil.Uint64        `json:"blockNumber"`
+	Status              string                `json:"status"`
+	Error               string                `json:"error,omitempty"`        // Error of the top-level frame
+	RevertReason        *backend.RevertReason `json:"revertReason,omitempty"` // Decoded revert data of the top-level frame
+	FailedFrames        []*backend.CallFrame  `json:"failedFrames"`           // All failed frames, including the caught ones
+}
+
+// GetTransactionStatus returns the status of a transaction, or of every
+// transaction of a block, with the failed frames and their decoded revert
+// reasons. Custom errors are decoded with the ABI registry.
+func (api *API) GetTransactionStatus(ctx context.Context, target BlockOrTx) ([]*TransactionStatus, error) {
+	var (
+		frames []*backend.CallFrame
+		err    error
+	)
+	if target.Hash != nil {
+		if frames, err = api.backend.TraceTransaction(ctx, *target.Hash); err != nil {
+			return nil, backend.RPCError(err)
+		}
+		if len(frames) == 0 {
+			return nil, fmt.Errorf("no traces of transaction %s", target.Hash.Hex())
+		}
+	} else {
+		header, err := api.backend.HeaderByNumber(ctx, *target.Number)
+		if err != nil {
+			return nil, backend.RPCError(err)
+		}
+		if frames, err = api.backend.TraceBlock(ctx, rpc.BlockNumber(header.Number.Int64())); err != nil {
+			return nil, backend.RPCError(err)
+		}
+	}
+	if api.decoder != nil {
+		api.decoder.DecodeFrames(ctx, frames)
+	}
+	var (
+		statuses []*TransactionStatus
+		byHash   = make(map[common.Hash]*TransactionStatus)
+	)
+	for _, frame := range frames {
+		if frame.TransactionHash == nil || *frame.TransactionHash == (common.Hash{}) {
+			continue // block rewards
+		}
+		status, ok := byHash[*frame.TransactionHash]
+		if !ok {
+			status = &TransactionStatus{
+				TransactionHash:     *frame.TransactionHash,
+				TransactionPosition: hexutil.Uint64(frame.TransactionPosition),
+				BlockNumber:         hexutil.Uint64(frame.BlockNumber),
+				Status:              StatusSuccess,
+				FailedFrames:        []*backend.CallFrame{},
+			}
+			byHash[*frame.TransactionHash] = status
+			statuses = append(statuses, status)
+		}
+		if frame.Error == "" {
+			continue
+		}
+		status.FailedFrames = append(status.FailedFrames, frame)
+		if len(frame.TraceAddress) == 0 {
+			status.Status = StatusFailed
+			status.Error = frame.Error
+			status.RevertReason = frame.RevertReason
+		}
+	}
+	if statuses == nil {
+		statuses = []*TransactionStatus{}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,180 @@
+package hdt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/logging"
+)
+
+// tokenCacheLimit is the number of token metadata entries kept in memory.
+const tokenCacheLimit = 65536
+
+var (
+	nameSelector     = hexutil.MustDecode("0x06fdde03") // name()
+	symbolSelector   = hexutil.MustDecode("0x95d89b41") // symbol()
+	decimalsSelector = hexutil.MustDecode("0x313ce567") // decimals()
+)
+
+// TokenMetadata is the descriptive metadata of a token contract, fields are
+// empty if the contract doesn't implement them.
+type TokenMetadata struct {
+	Name     string          `json:"name,omitempty"`
+	Symbol   string          `json:"symbol,omitempty"`
+	Decimals *hexutil.Uint64 `json:"decimals,omitempty"`
+}
+
+// TokenTransfersOptions are the arguments of GetTokenTransfers, use the same
+// fromBlock and toBlock to select a single block.
+type TokenTransfersOptions struct {
+	TransactionHash *common.Hash    `json:"transactionHash"`
+	Address         *common.Address `json:"address"`
+	Direction       string          `json:"direction"` // "from", "to" or "both" (default), applies to address
+	Token           *common.Address `json:"token"`
+	FromBlock       *hexutil.Uint64 `json:"fromBlock"`
+	ToBlock         *hexutil.Uint64 `json:"toBlock"`
+	Cursor          string          `json:"cursor"` // Opaque cursor returned by a previous call
+	Limit           *hexutil.Uint64 `json:"limit"`
+}
+
+// TokenTransferResult is a token transfer annotated with the token metadata.
+type TokenTransferResult struct {
+	*backend.TokenTransfer
+	*TokenMetadata
+}
+
+// TokenTransfersResult is a page of transfers and the cursor of the next
+// page, which is null once all transfers have been returned.
+type TokenTransfersResult struct {
+	Transfers  []*TokenTransferResult `json:"transfers"`
+	NextCursor *string                `json:"nextCursor"`
+}
+
+// GetTokenTransfers returns the ERC-20, ERC-721 and ERC-1155 transfers of a
+// transaction, block range, address or token, in chain order. Every transfer
+// is annotated with the symbol, name and decimals of its token.
+func (api *API) GetTokenTransfers(ctx context.Context, opts TokenTransfersOptions) (*TokenTransfersResult, error) {
+	filter := &backend.TokenTransferFilter{
+		Token:           opts.Token,
+		Address:         opts.Address,
+		TransactionHash: opts.TransactionHash,
+		ToBlock:         maxBlockNumber,
+		Limit:           defaultPageSize,
+	}
+	if opts.FromBlock != nil {
+		filter.FromBlock = uint64(*opts.FromBlock)
+	}
+	if opts.ToBlock != nil && uint64(*opts.ToBlock) < maxBlockNumber {
+		filter.ToBlock = uint64(*opts.ToBlock)
+	}
+	if opts.TransactionHash == nil && opts.Address == nil && opts.Token == nil && (opts.FromBlock == nil || opts.ToBlock == nil) {
+		return nil, fmt.Errorf("either transactionHash, address, token or a block range is required")
+	}
+	switch opts.Direction {
+	case "", "both":
+		filter.Direction = backend.DirectionBoth
+	case "from":
+		filter.Direction = backend.DirectionFrom
+	case "to":
+		filter.Direction = backend.DirectionTo
+	default:
+		return nil, fmt.Errorf("invalid direction %q", opts.Direction)
+	}
+	if opts.Limit != nil {
+		if *opts.Limit == 0 || *opts.Limit > maxPageSize {
+			return nil, fmt.Errorf("limit must be within [1, %d]", maxPageSize)
+		}
+		filter.Limit = int(*opts.Limit)
+	}
+	if opts.Cursor != "" {
+		cursor, err := decodeCursor[backend.TokenCursor](opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = cursor
+	}
+	transfers, cursor, err := api.backend.TokenTransfers(ctx, filter)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	results := make([]*TokenTransferResult, len(transfers))
+	for i, t := range transfers {
+		md, err := api.tokenMetadata(ctx, t.Token)
+		if err != nil {
+			logging.Ctx(ctx).Debug("Failed to fetch token metadata", "token", t.Token, "err", err)
+		}
+		results[i] = &TokenTransferResult{TokenTransfer: t, TokenMetadata: md}
+	}
+	return &TokenTransfersResult{Transfers: results, NextCursor: encodeCursor(cursor)}, nil
+}
+
+// tokenMetadata returns the metadata of the token, fetched from upstream
+// the first time it's needed. It's only cached once a call succeeded, if
+// every one failed the last error is returned.
+func (api *API) tokenMetadata(ctx context.Context, token common.Address) (*TokenMetadata, error) {
+	if md, ok := api.tokens.Get(token); ok {
+		return md, nil
+	}
+	var (
+		succeeded bool
+		lastErr   error
+	)
+	call := func(selector []byte) []byte {
+		out, err := api.backend.CallContract(ctx, token, selector, rpc.LatestBlockNumber)
+		if err != nil {
+			lastErr = err
+			return nil
+		}
+		succeeded = true
+		return out
+	}
+	md := &TokenMetadata{
+		Name:   decodeTokenString(call(nameSelector)),
+		Symbol: decodeTokenString(call(symbolSelector)),
+	}
+	if out := call(decimalsSelector); len(out) == 32 {
+		if d := new(big.Int).SetBytes(out); d.IsUint64() && d.Uint64() <= 255 {
+			decimals := hexutil.Uint64(d.Uint64())
+			md.Decimals = &decimals
+		}
+	}
+	if !succeeded {
+		return nil, lastErr
+	}
+	api.tokens.Add(token, md)
+	return md, nil
+}
+
+// decodeTokenString decodes a name or symbol, returned either as an ABI
+// string or, by early tokens such as MKR, as a bytes32.
+func decodeTokenString(out []byte) string {
+	var s []byte
+	switch {
+	case len(out) == 32:
+		s = bytes.TrimRight(out, "\x00")
+	case len(out) >= 64:
+		offset := new(big.Int).SetBytes(out[:32])
+		if !offset.IsInt64() || offset.Int64()+32 > int64(len(out)) {
+			return ""
+		}
+		start := offset.Int64()
+		length := new(big.Int).SetBytes(out[start : start+32])
+		if !length.IsInt64() || start+32+length.Int64() > int64(len(out)) {
+			return ""
+		}
+		s = out[start+32 : start+32+length.Int64()]
+	}
+	if !utf8.Valid(s) {
+		return ""
+	}
+	return strings.TrimSpace(string(s))
+}
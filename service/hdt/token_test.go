@@ -0,0 +1,52 @@
+package hdt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// callBackend answers every contract call with a 32 byte symbol once the
+// upstream is back.
+type callBackend struct {
+	backend.Backend
+	down  bool
+	calls int
+}
+
+func (b *callBackend) CallContract(ctx context.Context, to common.Address, data []byte, number rpc.BlockNumber) ([]byte, error) {
+	b.calls++
+	if b.down {
+		return nil, errors.New("connection refused")
+	}
+	return common.RightPadBytes([]byte("TKN"), 32), nil
+}
+
+func TestTokenMetadataCache(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		token = common.HexToAddress("0xaa")
+		b     = &callBackend{down: true}
+		api   = NewAPI(b, nil)
+	)
+	if md, err := api.tokenMetadata(ctx, token); err == nil || md != nil {
+		t.Fatalf("have metadata %+v and error %v while upstream is down", md, err)
+	}
+	b.down = false
+	md, err := api.tokenMetadata(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Symbol != "TKN" {
+		t.Errorf("have symbol %q, want TKN", md.Symbol)
+	}
+	calls := b.calls
+	if _, err := api.tokenMetadata(ctx, token); err != nil || b.calls != calls {
+		t.Errorf("metadata not served from the cache: %d more calls, error %v", b.calls-calls, err)
+	}
+}
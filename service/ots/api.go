@@ -0,0 +1,423 @@
+// Package ots implements the ots_ namespace consumed by the Otterscan block
+// explorer, answered from the traces table wherever possible.
+package ots
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/service/eth"
+)
+
+// apiLevel is the Otterscan API level implemented by this package.
+const apiLevel = 8
+
+// Internal operation types as defined by Otterscan.
+const (
+	OpTransfer     = 0
+	OpSelfDestruct = 1
+	OpCreate       = 2
+	OpCreate2      = 3
+)
+
+// maxBlockNumber bounds open ended block ranges, it fits into a bigint column.
+const maxBlockNumber = uint64(math.MaxInt64)
+
+// InternalOperation is a value transfer, contract creation or self-destruct
+// happening inside a transaction.
+type InternalOperation struct {
+	Type  int            `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+}
+
+// TraceEntry is a single call frame of the Otterscan transaction trace.
+type TraceEntry struct {
+	Type   string          `json:"type"`
+	Depth  int             `json:"depth"`
+	From   common.Address  `json:"from"`
+	To     *common.Address `json:"to"`
+	Value  *hexutil.Big    `json:"value"`
+	Input  hexutil.Bytes   `json:"input"`
+	Output hexutil.Bytes   `json:"output"`
+}
+
+// ContractCreator identifies the transaction and account which created a contract.
+type ContractCreator struct {
+	Tx      common.Hash    `json:"hash"`
+	Creator common.Address `json:"creator"`
+}
+
+// TransactionsWithReceipts is a page of the transaction history of an address.
+type TransactionsWithReceipts struct {
+	Txs       []*eth.RPCTransaction    `json:"txs"`
+	Receipts  []map[string]interface{} `json:"receipts"`
+	FirstPage bool                     `json:"firstPage"`
+	LastPage  bool                     `json:"lastPage"`
+}
+
+// API is the collection of Otterscan APIs.
+type API struct {
+	backend backend.Backend
+	config  *params.ChainConfig
+}
+
+// NewAPI creates a new API definition for the Otterscan methods, the chain
+// config recovers the senders of the transactions.
+func NewAPI(backend backend.Backend, config *params.ChainConfig) *API {
+	return &API{backend: backend, config: config}
+}
+
+// GetApiLevel returns the Otterscan API level supported by this server.
+func (api *API) GetApiLevel() uint64 {
+	return apiLevel
+}
+
+// frameType returns the opcode style type of a call frame.
+func frameType(frame *backend.CallFrame) string {
+	switch typ := strings.ToUpper(frame.Type); typ {
+	case vm.CALL.String():
+		if frame.Action.CallType != "" {
+			return strings.ToUpper(frame.Action.CallType)
+		}
+		return typ
+	case vm.CREATE.String(), vm.CREATE2.String():
+		if strings.EqualFold(frame.Action.CreationMethod, vm.CREATE2.String()) {
+			return vm.CREATE2.String()
+		}
+		return typ
+	case "SUICIDE":
+		return vm.SELFDESTRUCT.String()
+	default:
+		return typ
+	}
+}
+
+// GetInternalOperations returns the value transfers, contract creations and
+// self-destructs performed by the inner frames of a transaction.
+func (api *API) GetInternalOperations(ctx context.Context, hash common.Hash) ([]*InternalOperation, error) {
+	frames, err := api.backend.TraceTransaction(ctx, hash)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	ops := make([]*InternalOperation, 0)
+	for _, frame := range frames {
+		if len(frame.TraceAddress) == 0 {
+			continue
+		}
+		op := &InternalOperation{Value: (*hexutil.Big)(frame.Action.Value)}
+		if frame.Action.From != nil {
+			op.From = *frame.Action.From
+		}
+		switch typ := frameType(frame); typ {
+		case vm.CALL.String():
+			if frame.Action.Value == nil || frame.Action.Value.Sign() == 0 {
+				continue
+			}
+			op.Type, op.To = OpTransfer, *frame.Action.To
+		case vm.CREATE.String(), vm.CREATE2.String():
+			op.Type = OpCreate
+			if typ == vm.CREATE2.String() {
+				op.Type = OpCreate2
+			}
+			if frame.Result != nil && frame.Result.Address != nil {
+				op.To = *frame.Result.Address
+			}
+		case vm.SELFDESTRUCT.String():
+			op.Type, op.From, op.To = OpSelfDestruct, *frame.Action.SelfDestructed, *frame.Action.RefundAddress
+			op.Value = (*hexutil.Big)(frame.Action.Balance)
+		default:
+			continue
+		}
+		if op.Value == nil {
+			op.Value = new(hexutil.Big)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// TraceTransaction returns the call tree of a transaction as a flat list of
+// frames annotated with their depth.
+func (api *API) TraceTransaction(ctx context.Context, hash common.Hash) ([]*TraceEntry, error) {
+	frames, err := api.backend.TraceTransaction(ctx, hash)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	entries := make([]*TraceEntry, 0, len(frames))
+	for _, frame := range frames {
+		entry := &TraceEntry{
+			Type:  frameType(frame),
+			Depth: len(frame.TraceAddress),
+			To:    frame.Action.To,
+			Value: (*hexutil.Big)(frame.Action.Value),
+		}
+		switch entry.Type {
+		case vm.SELFDESTRUCT.String():
+			entry.From, entry.To = *frame.Action.SelfDestructed, frame.Action.RefundAddress
+			entry.Value = (*hexutil.Big)(frame.Action.Balance)
+		case vm.CREATE.String(), vm.CREATE2.String():
+			if frame.Action.From != nil {
+				entry.From = *frame.Action.From
+			}
+			if frame.Action.Init != nil {
+				entry.Input = *frame.Action.Init
+			}
+			if frame.Result != nil {
+				entry.To = frame.Result.Address
+			}
+		default:
+			if frame.Action.From != nil {
+				entry.From = *frame.Action.From
+			}
+			if frame.Action.Input != nil {
+				entry.Input = *frame.Action.Input
+			}
+			if frame.Result != nil && frame.Result.Output != nil {
+				entry.Output = *frame.Result.Output
+			}
+		}
+		// Value is meaningless for static and delegate calls
+		if entry.Type == vm.STATICCALL.String() || entry.Type == vm.DELEGATECALL.String() {
+			entry.Value = nil
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetTransactionError returns the revert data of a failed transaction, or
+// empty bytes if it succeeded.
+func (api *API) GetTransactionError(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
+	frames, err := api.backend.TraceTransaction(ctx, hash)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	for _, frame := range frames {
+		if len(frame.TraceAddress) != 0 {
+			continue
+		}
+		if frame.Error != "" && frame.Result != nil && frame.Result.Output != nil {
+			return *frame.Result.Output, nil
+		}
+		break
+	}
+	return hexutil.Bytes{}, nil
+}
+
+// HasCode reports whether the address holds code at the given block.
+func (api *API) HasCode(ctx context.Context, address common.Address, number rpc.BlockNumber) (bool, error) {
+	code, err := api.backend.CodeAt(ctx, address, number)
+	if err != nil {
+		return false, backend.RPCError(err)
+	}
+	return len(code) > 0, nil
+}
+
+// GetContractCreator returns the transaction and account which created the
+// contract at address, or null if it is not a contract. If the address was
+// created several times (self-destructed and redeployed), the most recent
+// creation is returned.
+func (api *API) GetContractCreator(ctx context.Context, address common.Address) (*ContractCreator, error) {
+	frames, err := api.backend.ContractCreations(ctx, address)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		frame := frames[i]
+		if frame.Error != "" || frame.Action.From == nil {
+			continue
+		}
+		return &ContractCreator{Tx: *frame.TransactionHash, Creator: *frame.Action.From}, nil
+	}
+	return nil, nil
+}
+
+// GetBlockDetails returns the block header together with its issuance and
+// the total fees paid by its transactions.
+func (api *API) GetBlockDetails(ctx context.Context, number rpc.BlockNumber) (map[string]interface{}, error) {
+	block, err := api.backend.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if block == nil {
+		return nil, &backend.NotFoundError{What: fmt.Sprintf("block #%d", number)}
+	}
+	fields, err := eth.RPCMarshalBlock(block, false, false, api.config)
+	if err != nil {
+		return nil, err
+	}
+	fields["transactionCount"] = len(block.Transactions())
+	// Otterscan doesn't use the bloom, spare the bandwidth
+	delete(fields, "logsBloom")
+
+	number = rpc.BlockNumber(block.NumberU64())
+	frames, err := api.backend.TraceBlock(ctx, number)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	var (
+		blockReward = new(big.Int)
+		uncleReward = new(big.Int)
+	)
+	for _, frame := range frames {
+		if !strings.EqualFold(frame.Type, "reward") || frame.Action.Value == nil {
+			continue
+		}
+		switch frame.Action.RewardType {
+		case "block":
+			blockReward.Add(blockReward, frame.Action.Value)
+		case "uncle":
+			uncleReward.Add(uncleReward, frame.Action.Value)
+		}
+	}
+	receipts, err := api.backend.BlockReceipts(ctx, number)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	totalFees := new(big.Int)
+	for _, receipt := range receipts {
+		if receipt.EffectiveGasPrice == nil {
+			continue
+		}
+		fee := new(big.Int).SetUint64(receipt.GasUsed)
+		totalFees.Add(totalFees, fee.Mul(fee, receipt.EffectiveGasPrice))
+	}
+	return map[string]interface{}{
+		"block": fields,
+		"issuance": map[string]interface{}{
+			"blockReward": (*hexutil.Big)(blockReward),
+			"uncleReward": (*hexutil.Big)(uncleReward),
+			"issuance":    (*hexutil.Big)(new(big.Int).Add(blockReward, uncleReward)),
+		},
+		"totalFees": (*hexutil.Big)(totalFees),
+	}, nil
+}
+
+// SearchTransactionsBefore returns a page of the transactions touching the
+// address in blocks before the given one (exclusive), newest first. A zero
+// block number starts from the chain head.
+func (api *API) SearchTransactionsBefore(ctx context.Context, address common.Address, number uint64, pageSize uint16) (*TransactionsWithReceipts, error) {
+	firstPage := number == 0
+	toBlock := maxBlockNumber
+	if !firstPage {
+		toBlock = number - 1
+	}
+	refs, err := api.search(ctx, address, 0, toBlock, true, int(pageSize))
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	lastPage := true
+	if len(refs) > 0 {
+		if oldest := refs[len(refs)-1].BlockNumber; oldest > 0 {
+			more, err := api.backend.SearchTransactions(ctx, address, 0, oldest-1, true, 1)
+			if err != nil {
+				return nil, backend.RPCError(err)
+			}
+			lastPage = len(more) == 0
+		}
+	}
+	return api.withReceipts(ctx, refs, firstPage, lastPage)
+}
+
+// SearchTransactionsAfter returns a page of the transactions touching the
+// address in blocks after the given one (exclusive), newest first. A zero
+// block number starts from genesis.
+func (api *API) SearchTransactionsAfter(ctx context.Context, address common.Address, number uint64, pageSize uint16) (*TransactionsWithReceipts, error) {
+	lastPage := number == 0
+	fromBlock := uint64(0)
+	if !lastPage {
+		fromBlock = number + 1
+	}
+	refs, err := api.search(ctx, address, fromBlock, maxBlockNumber, false, int(pageSize))
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	firstPage := true
+	if len(refs) > 0 {
+		newest := refs[len(refs)-1].BlockNumber
+		more, err := api.backend.SearchTransactions(ctx, address, newest+1, maxBlockNumber, false, 1)
+		if err != nil {
+			return nil, backend.RPCError(err)
+		}
+		firstPage = len(more) == 0
+	}
+	// Pages are always presented newest first
+	for i, j := 0, len(refs)-1; i < j; i, j = i+1, j-1 {
+		refs[i], refs[j] = refs[j], refs[i]
+	}
+	return api.withReceipts(ctx, refs, firstPage, lastPage)
+}
+
+// search returns up to pageSize transactions, extended so that the last block
+// of the page is always complete. Otherwise paging by block number would
+// skip the remaining transactions of that block.
+func (api *API) search(ctx context.Context, address common.Address, fromBlock, toBlock uint64, descending bool, pageSize int) ([]*backend.TransactionRef, error) {
+	refs, err := api.backend.SearchTransactions(ctx, address, fromBlock, toBlock, descending, pageSize)
+	if err != nil || len(refs) < pageSize || len(refs) == 0 {
+		return refs, backend.RPCError(err)
+	}
+	boundary := refs[len(refs)-1].BlockNumber
+	rest, err := api.backend.SearchTransactions(ctx, address, boundary, boundary, descending, 0)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	for len(refs) > 0 && refs[len(refs)-1].BlockNumber == boundary {
+		refs = refs[:len(refs)-1]
+	}
+	return append(refs, rest...), nil
+}
+
+// withReceipts resolves the transactions and receipts of the given references.
+func (api *API) withReceipts(ctx context.Context, refs []*backend.TransactionRef, firstPage, lastPage bool) (*TransactionsWithReceipts, error) {
+	result := &TransactionsWithReceipts{
+		Txs:       make([]*eth.RPCTransaction, 0, len(refs)),
+		Receipts:  make([]map[string]interface{}, 0, len(refs)),
+		FirstPage: firstPage,
+		LastPage:  lastPage,
+	}
+	var block *types.Block
+	for _, ref := range refs {
+		if block == nil || block.NumberU64() != ref.BlockNumber {
+			var err error
+			if block, err = api.backend.BlockByNumber(ctx, rpc.BlockNumber(ref.BlockNumber)); err != nil {
+				return nil, backend.RPCError(err)
+			}
+		}
+		tx := eth.NewRPCTransactionFromBlockHash(block, ref.Hash, api.config)
+		if tx == nil {
+			return nil, fmt.Errorf("transaction %s not found in block #%d", ref.Hash, ref.BlockNumber)
+		}
+		receipt, err := api.backend.TransactionReceipt(ctx, ref.Hash)
+		if err != nil {
+			return nil, backend.RPCError(err)
+		}
+		fields := eth.RPCMarshalReceipt(receipt, block.Transaction(ref.Hash), api.config)
+		fields["timestamp"] = hexutil.Uint64(block.Time())
+		result.Txs = append(result.Txs, tx)
+		result.Receipts = append(result.Receipts, fields)
+	}
+	return result, nil
+}
+
+// APIs return the collection of RPC services the ots package offers.
+func APIs(backend backend.Backend, config *params.ChainConfig) []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "ots",
+			Service:   NewAPI(backend, config),
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package ots
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+func TestGetBlockDetailsIssuance(t *testing.T) {
+	fixture := upstreamtest.Fixture(t, "ethereum.json")
+	// Pre-merge style rewards: the miner and one uncle
+	var (
+		block  = fixture.Blocks[0]
+		hash   = block.Header.Hash()
+		number = block.Header.Number.Uint64()
+		miner  = block.Header.Coinbase
+		uncle  = common.HexToAddress("0xaa")
+		reward = func(author common.Address, value int64, typ string) *backend.CallFrame {
+			return &backend.CallFrame{
+				Type:         "reward",
+				BlockHash:    &hash,
+				BlockNumber:  number,
+				TraceAddress: []int{},
+				Action:       backend.CallAction{Author: &author, Value: big.NewInt(value), RewardType: typ},
+			}
+		}
+	)
+	block.Traces = append(block.Traces, reward(miner, 2e18, "block"), reward(uncle, 1e18, "uncle"))
+
+	upstream := upstreamtest.NewServer(fixture)
+	defer upstream.Close()
+	upstream.Handle("eth_getBlockReceipts", func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		receipts := make([]*types.Receipt, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			receipts[i] = &types.Receipt{
+				Type:              tx.Type(),
+				Status:            types.ReceiptStatusSuccessful,
+				TxHash:            tx.Hash(),
+				GasUsed:           21000,
+				EffectiveGasPrice: big.NewInt(10),
+				Logs:              []*types.Log{},
+			}
+		}
+		return receipts, nil
+	})
+
+	var (
+		ctx = context.Background()
+		b   = upstreamtest.NewBackend(t, upstream, fixture.Chain, fixture)
+	)
+	details, err := NewAPI(b, params.MainnetChainConfig).GetBlockDetails(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuance := details["issuance"].(map[string]interface{})
+	for field, want := range map[string]int64{"blockReward": 2e18, "uncleReward": 1e18, "issuance": 3e18} {
+		if have := issuance[field].(*hexutil.Big).ToInt(); have.Int64() != want {
+			t.Errorf("%s: have %v, want %d", field, have, want)
+		}
+	}
+	fees := int64(21000 * 10 * len(block.Transactions))
+	if have := details["totalFees"].(*hexutil.Big).ToInt(); have.Int64() != fees {
+		t.Errorf("total fees: have %v, want %d", have, fees)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		fixture = upstreamtest.Fixture(t, "ethereum.json")
+		api     = NewAPI(upstreamtest.NewDevBackend(t, fixture), params.MainnetChainConfig)
+		unknown = common.HexToHash("0xdead")
+		beyond  = rpc.BlockNumber(fixture.Blocks[len(fixture.Blocks)-1].Header.Number.Int64() + 100)
+	)
+	_, err := api.TraceTransaction(ctx, unknown)
+	if rpcErr, ok := err.(rpc.Error); !ok || rpcErr.ErrorCode() != backend.CodeNotFound {
+		t.Errorf("unknown transaction: have %v", err)
+	}
+	_, err = api.GetBlockDetails(ctx, beyond)
+	if rpcErr, ok := err.(rpc.Error); !ok || rpcErr.ErrorCode() != backend.CodeNotFound {
+		t.Errorf("unknown block: have %v", err)
+	}
+}
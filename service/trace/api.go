@@ -18,23 +18,70 @@ package trace
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	ethtracers "github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/service/cache"
+	"github.com/jsvisa/hdt/service/decoder"
 )
 
+// TraceConfig holds the extra parameters to the trace functions.
+type TraceConfig struct {
+	*ethtracers.TraceConfig
+
+	// Decode annotates every frame with its ABI decoding.
+	Decode bool `json:"decode"`
+
+	// Wait for a pending transaction to be mined and traced for up to this
+	// duration, e.g. "30s", instead of failing right away.
+	Wait *string `json:"wait"`
+}
+
+// maxPendingWait caps the wait for pending transactions.
+const maxPendingWait = time.Minute
+
+// pendingPollInterval is the delay between lookups of a pending transaction.
+var pendingPollInterval = time.Second
+
+// wait returns the duration to wait for pending transactions.
+func (config *TraceConfig) wait() (time.Duration, error) {
+	if config == nil || config.Wait == nil {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(*config.Wait)
+	if err != nil {
+		return 0, fmt.Errorf("invalid wait: %v", err)
+	}
+	if wait > maxPendingWait {
+		wait = maxPendingWait
+	}
+	return wait, nil
+}
+
 // API is the collection of tracing APIs exposed over the private debugging endpoint.
 type API struct {
 	backend backend.Backend
+	cache   *cache.Cache
+	decoder *decoder.Decoder
 }
 
 // NewAPI creates a new API definition for the tracing methods of the Ethereum service.
-func NewAPI(backend backend.Backend) *API {
-	return &API{backend: backend}
+func NewAPI(backend backend.Backend, cache *cache.Cache, decoder *decoder.Decoder) *API {
+	return &API{backend: backend, cache: cache, decoder: decoder}
+}
+
+// decode annotates the frames if requested by the config.
+func (api *API) decode(ctx context.Context, frames []*backend.CallFrame, config *TraceConfig) []*backend.CallFrame {
+	if config != nil && config.Decode && api.decoder != nil {
+		api.decoder.DecodeFrames(ctx, frames)
+	}
+	return frames
 }
 
 // blockByNumber is the wrapper of the chain access function offered by the backend.
@@ -42,33 +89,96 @@ func NewAPI(backend backend.Backend) *API {
 func (api *API) blockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
 	block, err := api.backend.BlockByNumber(ctx, number)
 	if err != nil {
-		return nil, err
+		return nil, backend.RPCError(err)
 	}
 	if block == nil {
-		return nil, fmt.Errorf("block #%d not found", number)
+		return nil, &backend.NotFoundError{What: fmt.Sprintf("block #%d", number)}
 	}
 	return block, nil
 }
 
 // TraceBlockByNumber returns the structured logs created during the execution of
 // EVM and returns them as a JSON object.
-func (api *API) Block(ctx context.Context, number rpc.BlockNumber, config *ethtracers.TraceConfig) ([]*backend.CallFrame, error) {
-	return api.backend.TraceBlock(ctx, number)
+func (api *API) Block(ctx context.Context, number rpc.BlockNumber, config *TraceConfig) ([]*backend.CallFrame, error) {
+	var frames []*backend.CallFrame
+	// Block tags (latest, pending, ...) move along the chain, never cache them
+	if number >= 0 && api.cache.Get(ctx, &frames, "trace_block", number) {
+		return api.decode(ctx, frames, config), nil
+	}
+	frames, err := api.backend.TraceBlock(ctx, number)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if len(frames) == 0 {
+		// Blocks with transactions have frames once indexed
+		header, err := api.backend.HeaderByNumber(ctx, number)
+		if err != nil {
+			return nil, backend.RPCError(err)
+		}
+		if header.TxHash != types.EmptyTxsHash {
+			return nil, &backend.NotIndexedError{Block: header.Number.Uint64()}
+		}
+	}
+	// Empty results may just be lagging behind the indexer
+	if number >= 0 && len(frames) > 0 {
+		api.cache.Put(ctx, uint64(number), frames, "trace_block", number)
+	}
+	return api.decode(ctx, frames, config), nil
 }
 
 // Transaction returns the structured logs created during the execution of EVM
 // and returns them as a JSON object.
-func (api *API) Transaction(ctx context.Context, hash common.Hash, config *ethtracers.TraceConfig) ([]*backend.CallFrame, error) {
-	return api.backend.TraceTransaction(ctx, hash)
+func (api *API) Transaction(ctx context.Context, hash common.Hash, config *TraceConfig) ([]*backend.CallFrame, error) {
+	var frames []*backend.CallFrame
+	if api.cache.Get(ctx, &frames, "trace_transaction", hash) {
+		return api.decode(ctx, frames, config), nil
+	}
+	wait, err := config.wait()
+	if err != nil {
+		return nil, err
+	}
+	frames, err = api.traceTransaction(ctx, hash, wait)
+	if err != nil {
+		return nil, backend.RPCError(err)
+	}
+	if len(frames) > 0 {
+		api.cache.Put(ctx, frames[0].BlockNumber, frames, "trace_transaction", hash)
+	}
+	return api.decode(ctx, frames, config), nil
+}
+
+// traceTransaction traces the transaction, polling up to wait while it's
+// pending or mined but not indexed yet. The last error is returned if it
+// didn't make it in time.
+func (api *API) traceTransaction(ctx context.Context, hash common.Hash, wait time.Duration) ([]*backend.CallFrame, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		frames, err := api.backend.TraceTransaction(ctx, hash)
+		var (
+			pending    *backend.PendingError
+			notIndexed *backend.NotIndexedError
+		)
+		if err == nil || !(errors.As(err, &pending) || errors.As(err, &notIndexed)) {
+			return frames, err
+		}
+		if time.Now().Add(pendingPollInterval).After(deadline) {
+			return nil, err
+		}
+		select {
+		case <-time.After(pendingPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
 }
 
 // APIs return the collection of RPC services the tracer package offers.
-func APIs(backend backend.Backend) []rpc.API {
+func APIs(backend backend.Backend, cache *cache.Cache, decoder *decoder.Decoder) []rpc.API {
 	// Append all the local APIs and return
 	return []rpc.API{
 		{
 			Namespace: "trace",
-			Service:   NewAPI(backend),
+			Service:   NewAPI(backend, cache, decoder),
 		},
 	}
 }
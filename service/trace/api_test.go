@@ -0,0 +1,115 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+// newPendingAPI serves the fixture with its last block still in the pool of
+// the upstream, the database already holding its traces.
+func newPendingAPI(t *testing.T) (*API, *upstreamtest.Server, *backend.FixtureBlock) {
+	t.Helper()
+	fixture := upstreamtest.Fixture(t, "ethereum.json")
+	last := fixture.Blocks[len(fixture.Blocks)-1]
+	upstream := upstreamtest.NewServer(&backend.Fixture{Chain: fixture.Chain, Blocks: fixture.Blocks[:len(fixture.Blocks)-1]})
+	upstream.AddPending(last.Transactions...)
+	t.Cleanup(upstream.Close)
+
+	b := upstreamtest.NewBackend(t, upstream, fixture.Chain, fixture)
+	return NewAPI(b, nil, nil), upstream, last
+}
+
+func TestTransactionPending(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		api, upstream, block = newPendingAPI(t)
+		hash                 = block.Transactions[0].Hash()
+	)
+	_, err := api.Transaction(ctx, hash, nil)
+	var pending *backend.PendingError
+	if !errors.As(err, &pending) || pending.Hash != hash {
+		t.Fatalf("have %v, want pending %s", err, hash)
+	}
+	if rpcErr, ok := err.(rpc.Error); !ok || rpcErr.ErrorCode() != backend.CodePending {
+		t.Errorf("pending error without its JSON-RPC code: %v", err)
+	}
+
+	// Still pending once the wait is over
+	pendingPollInterval = 10 * time.Millisecond
+	wait := "50ms"
+	if _, err := api.Transaction(ctx, hash, &TraceConfig{Wait: &wait}); !errors.As(err, &pending) {
+		t.Fatalf("have %v, want pending", err)
+	}
+
+	// Mined while waiting
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		upstream.AddBlock(block)
+	}()
+	wait = "10s"
+	frames, err := api.Transaction(ctx, hash, &TraceConfig{Wait: &wait})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != len(block.Traces) || *frames[0].BlockHash != block.Header.Hash() {
+		t.Errorf("traced %d frames, want %d of block %s", len(frames), len(block.Traces), block.Header.Hash())
+	}
+
+	invalid := "soon"
+	if _, err := api.Transaction(ctx, hash, &TraceConfig{Wait: &invalid}); err == nil {
+		t.Error("invalid wait accepted")
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	fixture := upstreamtest.Fixture(t, "ethereum.json")
+	upstream := upstreamtest.NewServer(fixture)
+	t.Cleanup(upstream.Close)
+
+	// The last block is mined but not indexed
+	var (
+		ctx     = context.Background()
+		indexed = &backend.Fixture{Chain: fixture.Chain, Blocks: fixture.Blocks[:len(fixture.Blocks)-1]}
+		api     = NewAPI(upstreamtest.NewBackend(t, upstream, fixture.Chain, indexed), nil, nil)
+		first   = fixture.Blocks[0]
+		last    = fixture.Blocks[len(fixture.Blocks)-1]
+	)
+	code := func(err error) int {
+		if rpcErr, ok := err.(rpc.Error); ok {
+			return rpcErr.ErrorCode()
+		}
+		return 0
+	}
+
+	_, err := api.Block(ctx, rpc.BlockNumber(last.Header.Number.Int64()), nil)
+	if code(err) != backend.CodeNotIndexed {
+		t.Errorf("block not indexed: have %v", err)
+	}
+	_, err = api.Transaction(ctx, last.Transactions[0].Hash(), nil)
+	if code(err) != backend.CodeNotIndexed {
+		t.Errorf("transaction not indexed: have %v", err)
+	}
+	_, err = api.Block(ctx, rpc.BlockNumber(last.Header.Number.Int64()+100), nil)
+	if code(err) != backend.CodeNotFound {
+		t.Errorf("unknown block: have %v", err)
+	}
+	if _, err := api.Block(ctx, rpc.BlockNumber(first.Header.Number.Int64()), nil); err != nil {
+		t.Errorf("indexed block: %v", err)
+	}
+
+	// Upstream answering too late
+	upstream.SetLatency("", time.Second)
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = api.Transaction(timeout, first.Transactions[0].Hash(), nil)
+	if code(err) != backend.CodeUpstreamUnavailable {
+		t.Errorf("slow upstream: have %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// Quality rules checked over the traces table.
+const (
+	RuleSubtraces    = "subtraces"     // subtraces differs from the number of children
+	RuleOrphan       = "orphan"        // Parent trace address missing
+	RuleDuplicate    = "duplicate"     // Repeated (txhash, trace_address)
+	RuleTraceAddress = "trace_address" // trace_address isn't a list of positions
+	RuleTxpos        = "txpos"         // Transaction positions not contiguous from zero
+	RuleTimestamp    = "timestamp"     // block_timestamp differs from the header
+)
+
+// Rules lists every quality rule.
+var Rules = []string{RuleSubtraces, RuleOrphan, RuleDuplicate, RuleTraceAddress, RuleTxpos, RuleTimestamp}
+
+const (
+	// qualityInterval is how often the checker looks for newly finalized blocks.
+	qualityInterval = time.Minute
+
+	// qualityBatch is the number of blocks loaded and checked at once.
+	qualityBatch = 100
+)
+
+func newIssue(number uint64, rule string, txHash *string, traceAddress *string, format string, args ...interface{}) *backend.QualityIssue {
+	return &backend.QualityIssue{
+		BlockNum:        number,
+		Rule:            rule,
+		TransactionHash: txHash,
+		TraceAddress:    traceAddress,
+		Detail:          fmt.Sprintf(format, args...),
+	}
+}
+
+// CheckStructure checks the trace tree invariants of the rows of whole
+// blocks, rewards aside as they belong to no transaction. The issues of a
+// transaction are reported by trace address, whatever the order of the rows.
+func CheckStructure(rows []backend.Trace) []*backend.QualityIssue {
+	type txRows struct {
+		number uint64
+		hash   *string
+		pos    map[uint64]struct{}
+		seen   map[string]*backend.Trace
+		parsed map[string][]int
+		order  []string
+	}
+	var (
+		issues []*backend.QualityIssue
+		txs    = make(map[string]*txRows)
+		hashes []string
+		blocks = make(map[uint64]map[uint64][]string) // txpos -> hashes per block
+	)
+	for i := range rows {
+		row := &rows[i]
+		if row.TransactionHash == nil {
+			continue
+		}
+		hash := *row.TransactionHash
+		tx, ok := txs[hash]
+		if !ok {
+			tx = &txRows{number: row.BlockNum, hash: row.TransactionHash, pos: make(map[uint64]struct{}), seen: make(map[string]*backend.Trace), parsed: make(map[string][]int)}
+			txs[hash] = tx
+			hashes = append(hashes, hash)
+		}
+		if _, ok := tx.pos[row.TransactionPos]; !ok {
+			tx.pos[row.TransactionPos] = struct{}{}
+			if blocks[row.BlockNum] == nil {
+				blocks[row.BlockNum] = make(map[uint64][]string)
+			}
+			blocks[row.BlockNum][row.TransactionPos] = append(blocks[row.BlockNum][row.TransactionPos], hash)
+		}
+		address, err := backend.ParseTraceAddress(row.TraceAddress)
+		if err != nil {
+			issues = append(issues, newIssue(row.BlockNum, RuleTraceAddress, row.TransactionHash, &row.TraceAddress, "unparsable trace address: %v", err))
+			continue
+		}
+		key := fmt.Sprint(address)
+		if _, ok := tx.seen[key]; ok {
+			issues = append(issues, newIssue(row.BlockNum, RuleDuplicate, row.TransactionHash, &row.TraceAddress, "trace address %s repeated", key))
+			continue
+		}
+		tx.seen[key] = row
+		tx.parsed[key] = address
+		tx.order = append(tx.order, key)
+	}
+	for _, hash := range hashes {
+		tx := txs[hash]
+		if len(tx.pos) > 1 {
+			issues = append(issues, newIssue(tx.number, RuleTxpos, tx.hash, nil, "transaction at %d positions", len(tx.pos)))
+		}
+		sort.Slice(tx.order, func(i, j int) bool {
+			return backend.CompareTraceAddress(tx.parsed[tx.order[i]], tx.parsed[tx.order[j]]) < 0
+		})
+		children := make(map[string]int, len(tx.seen))
+		for _, key := range tx.order {
+			address := tx.parsed[key]
+			if len(address) == 0 {
+				continue
+			}
+			parent := fmt.Sprint(address[:len(address)-1])
+			if _, ok := tx.seen[parent]; !ok {
+				row := tx.seen[key]
+				issues = append(issues, newIssue(tx.number, RuleOrphan, tx.hash, &row.TraceAddress, "parent %s missing", parent))
+			}
+			children[parent]++
+		}
+		for _, key := range tx.order {
+			row := tx.seen[key]
+			if have := children[key]; have != row.SubTraces {
+				issues = append(issues, newIssue(tx.number, RuleSubtraces, tx.hash, &row.TraceAddress, "subtraces %d, children %d", row.SubTraces, have))
+			}
+		}
+	}
+	numbers := make([]uint64, 0, len(blocks))
+	for number := range blocks {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	for _, number := range numbers {
+		positions := blocks[number]
+		shared := make([]uint64, 0, len(positions))
+		for pos := range positions {
+			shared = append(shared, pos)
+		}
+		sort.Slice(shared, func(i, j int) bool { return shared[i] < shared[j] })
+		for _, pos := range shared {
+			if hashes := positions[pos]; len(hashes) > 1 {
+				issues = append(issues, newIssue(number, RuleTxpos, nil, nil, "position %d shared by %d transactions", pos, len(hashes)))
+			}
+		}
+		for pos := uint64(0); pos < uint64(len(positions)); pos++ {
+			if _, ok := positions[pos]; !ok {
+				issues = append(issues, newIssue(number, RuleTxpos, nil, nil, "position %d missing out of %d transactions", pos, len(positions)))
+				break
+			}
+		}
+	}
+	return issues
+}
+
+// CheckTimestamps checks the block timestamps of the rows against the
+// headers, reporting each mismatching block once.
+func CheckTimestamps(ctx context.Context, b backend.Backend, rows []backend.Trace) ([]*backend.QualityIssue, error) {
+	var (
+		issues  []*backend.QualityIssue
+		checked = make(map[[2]int64]struct{})
+		headers = make(map[uint64]uint64)
+	)
+	for _, row := range rows {
+		// Layouts without timestamps leave them unset
+		if row.Timestamp.IsZero() {
+			continue
+		}
+		key := [2]int64{int64(row.BlockNum), row.Timestamp.Unix()}
+		if _, ok := checked[key]; ok {
+			continue
+		}
+		checked[key] = struct{}{}
+		want, ok := headers[row.BlockNum]
+		if !ok {
+			var err error
+			if want, err = b.BlockTimestamp(ctx, rpc.BlockNumber(row.BlockNum)); err != nil {
+				return nil, err
+			}
+			headers[row.BlockNum] = want
+		}
+		if have := uint64(row.Timestamp.Unix()); have != want {
+			issues = append(issues, newIssue(row.BlockNum, RuleTimestamp, nil, nil, "block_timestamp %d, header %d", have, want))
+		}
+	}
+	return issues, nil
+}
+
+// CheckRange runs every quality rule over a block range.
+func CheckRange(ctx context.Context, b backend.Backend, fromBlock, toBlock uint64) ([]*backend.QualityIssue, error) {
+	rows, err := b.TraceStructure(ctx, fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	issues := CheckStructure(rows)
+	stamps, err := CheckTimestamps(ctx, b, rows)
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, stamps...)
+	now := time.Now()
+	for _, issue := range issues {
+		issue.CheckedAt = now
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].BlockNum < issues[j].BlockNum })
+	return issues, nil
+}
+
+// Checker runs the quality rules over the finalized blocks, recording the
+// issues in the report table and exporting their count per rule as gauges.
+type Checker struct {
+	backend       backend.Backend
+	confirmations uint64
+	startBlock    uint64
+	head          metrics.Gauge
+	issues        map[string]metrics.Gauge
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewChecker creates a quality checker, start it by registering it as a
+// lifecycle of the node. Blocks are checked once confirmations deep below
+// the head, zero follows the upstream finalized tag. Without a report yet,
+// checking begins at the start block.
+func NewChecker(backend backend.Backend, confirmations, startBlock uint64) *Checker {
+	c := &Checker{
+		backend:       backend,
+		confirmations: confirmations,
+		startBlock:    startBlock,
+		head:          metrics.NewRegisteredGauge("hdt/quality/head", nil),
+		issues:        make(map[string]metrics.Gauge, len(Rules)),
+		quit:          make(chan struct{}),
+	}
+	for _, rule := range Rules {
+		c.issues[rule] = metrics.NewRegisteredGauge("hdt/quality/issues/"+rule, nil)
+	}
+	return c
+}
+
+// Start implements node.Lifecycle, launching the checking loop.
+func (c *Checker) Start() error {
+	c.wg.Add(1)
+	go c.loop()
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating the checking loop.
+func (c *Checker) Stop() error {
+	close(c.quit)
+	c.wg.Wait()
+	return nil
+}
+
+func (c *Checker) loop() {
+	defer c.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.quit
+		cancel()
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if err := c.sync(ctx); err != nil && ctx.Err() == nil {
+				log.Warn("Failed to check trace quality", "err", err)
+			}
+			timer.Reset(qualityInterval)
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// sync checks all blocks between the last checked and the finalized one.
+func (c *Checker) sync(ctx context.Context) error {
+	head, ok, err := c.backend.QualityCheckHead(ctx)
+	if err != nil {
+		return err
+	}
+	next := c.startBlock
+	if ok {
+		next = head + 1
+	}
+	finalized, err := backend.FinalizedNumber(ctx, c.backend, c.confirmations)
+	if err != nil {
+		return err
+	}
+	for from := next; from <= finalized; from += qualityBatch {
+		to := from + qualityBatch - 1
+		if to > finalized {
+			to = finalized
+		}
+		issues, err := CheckRange(ctx, c.backend, from, to)
+		if err != nil {
+			return fmt.Errorf("blocks %d-%d: %w", from, to, err)
+		}
+		if len(issues) > 0 {
+			log.Warn("Trace quality issues found", "from", from, "to", to, "issues", len(issues))
+		}
+		if err := c.backend.WriteQualityIssues(ctx, from, to, issues, true); err != nil {
+			return err
+		}
+		c.head.Update(int64(to))
+		if err := c.UpdateMetrics(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateMetrics refreshes the issue gauges from the report table.
+func (c *Checker) UpdateMetrics(ctx context.Context) error {
+	counts, err := c.backend.QualityIssueCounts(ctx)
+	if err != nil {
+		return err
+	}
+	for rule, gauge := range c.issues {
+		gauge.Update(int64(counts[rule]))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package verify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+func TestCheckStructure(t *testing.T) {
+	var (
+		txA = "0xaa"
+		txB = "0xbb"
+		txC = "0xcc"
+		row = func(tx string, pos uint64, subtraces int, address string) backend.Trace {
+			return backend.Trace{BlockNum: 1, TransactionHash: &tx, TransactionPos: pos, SubTraces: subtraces, TraceAddress: address}
+		}
+	)
+	rows := []backend.Trace{
+		row(txA, 0, 2, "[]"),
+		row(txA, 0, 0, "[0]"),
+		row(txA, 0, 0, "[1]"),
+		row(txA, 0, 0, "[1]"),   // duplicate
+		row(txB, 1, 1, "[]"),    // subtraces 1 but no child
+		row(txB, 1, 0, "[0,3]"), // orphan, parent [0] missing
+		row(txC, 3, 0, "[]"),    // position 2 missing
+		row(txC, 3, 0, "[0,x]"), // unparsable
+		{BlockNum: 1, TraceType: "reward"},
+	}
+	want := map[string]int{RuleDuplicate: 1, RuleOrphan: 1, RuleSubtraces: 1, RuleTraceAddress: 1, RuleTxpos: 1}
+	have := make(map[string]int)
+	for _, issue := range CheckStructure(rows) {
+		have[issue.Rule]++
+	}
+	for rule, n := range want {
+		if have[rule] != n {
+			t.Errorf("rule %s: have %d issues, want %d", rule, have[rule], n)
+		}
+	}
+	if len(have) != len(want) {
+		t.Errorf("unexpected rules: %v", have)
+	}
+}
+
+// TestCheckStructureOrder reports the issues of a transaction by trace
+// address, however its rows are ordered.
+func TestCheckStructureOrder(t *testing.T) {
+	var (
+		tx  = "0xaa"
+		row = func(subtraces int, address string) backend.Trace {
+			return backend.Trace{BlockNum: 1, TransactionHash: &tx, SubTraces: subtraces, TraceAddress: address}
+		}
+	)
+	// Every frame claims a child it doesn't have
+	rows := []backend.Trace{row(1, "[10]"), row(1, "[2]"), row(13, "[]"), row(1, "[0]")}
+	want := []string{"[]", "[0]", "[2]", "[10]"}
+	for i := 0; i < 10; i++ {
+		issues := CheckStructure(rows)
+		if len(issues) != len(want) {
+			t.Fatalf("have %d issues, want %d", len(issues), len(want))
+		}
+		for j, issue := range issues {
+			if *issue.TraceAddress != want[j] {
+				t.Errorf("issue %d: have trace address %s, want %s", j, *issue.TraceAddress, want[j])
+			}
+		}
+		rows[0], rows[len(rows)-1] = rows[len(rows)-1], rows[0]
+	}
+}
+
+// TestCheckerStartBlock checks the fixture blocks from the start block on.
+func TestCheckerStartBlock(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		fixture = upstreamtest.Fixture(t, "ethereum.json")
+		first   = fixture.Blocks[0].Header.Number.Uint64()
+		last    = fixture.Blocks[len(fixture.Blocks)-1].Header.Number.Uint64()
+	)
+	upstream := upstreamtest.NewServer(fixture)
+	defer upstream.Close()
+	upstream.SetFinalized(last)
+
+	b := upstreamtest.NewBackend(t, upstream, fixture.Chain, fixture)
+	if err := NewChecker(b, 0, first).sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	head, ok, err := b.QualityCheckHead(ctx)
+	if err != nil || !ok || head != last {
+		t.Fatalf("checked up to %d (%v, %v), want %d", head, ok, err, last)
+	}
+	counts, err := b.QualityIssueCounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 0 {
+		t.Errorf("issues in the fixture: %v", counts)
+	}
+}
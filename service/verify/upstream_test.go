@@ -0,0 +1,96 @@
+package verify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/jsvisa/hdt/backend"
+	"github.com/jsvisa/hdt/pkg/upstreamtest"
+)
+
+// TestBlockWideOrder verifies a transaction with more than ten sub calls,
+// stored in reverse, against an upstream serving them depth-first.
+func TestBlockWideOrder(t *testing.T) {
+	fixture := upstreamtest.Fixture(t, "ethereum.json")
+	var (
+		block  = fixture.Blocks[0]
+		root   = block.Traces[0]
+		frames = []*backend.CallFrame{root}
+	)
+	root.Subtraces = 12
+	for i := 0; i < root.Subtraces; i++ {
+		child := *root
+		child.TraceAddress, child.Subtraces = []int{i}, 0
+		frames = append(frames, &child)
+	}
+	block.Traces = frames
+	upstream := upstreamtest.NewServer(fixture)
+	defer upstream.Close()
+
+	reversed := make([]*backend.CallFrame, len(frames))
+	for i, frame := range frames {
+		reversed[len(frames)-1-i] = frame
+	}
+	var (
+		ctx    = context.Background()
+		stored = &backend.FixtureBlock{Header: block.Header, Transactions: block.Transactions, Traces: reversed}
+		b      = upstreamtest.NewBackend(t, upstream, fixture.Chain, &backend.Fixture{Chain: fixture.Chain, Blocks: []*backend.FixtureBlock{stored}})
+	)
+	if report := Block(ctx, b, block.Header.Number.Uint64()); !report.OK() || report.DBFrames != len(frames) {
+		t.Fatalf("wide block mismatched: %+v", report)
+	}
+}
+
+// TestBlockReorg verifies the database against a fake upstream which reorgs
+// a block onto a sibling without the reverted sub call.
+func TestBlockReorg(t *testing.T) {
+	fixture := upstreamtest.Fixture(t, "ethereum.json")
+	upstream := upstreamtest.NewServer(fixture)
+	defer upstream.Close()
+
+	var (
+		ctx = context.Background()
+		b   = upstreamtest.NewBackend(t, upstream, fixture.Chain, fixture)
+	)
+
+	block := fixture.Blocks[1]
+	number := block.Header.Number.Uint64()
+	if report := Block(ctx, b, number); !report.OK() {
+		t.Fatalf("fixture block mismatched: %+v", report)
+	}
+
+	// Same transactions, the second sub call of the first one is gone
+	header := types.CopyHeader(block.Header)
+	header.Extra = []byte("sibling")
+	traces := make([]*backend.CallFrame, 0, len(block.Traces))
+	for _, frame := range block.Traces {
+		if len(frame.TraceAddress) == 1 && frame.TraceAddress[0] == 1 {
+			continue
+		}
+		cpy := *frame
+		if len(cpy.TraceAddress) == 0 && cpy.TransactionPosition == 0 {
+			cpy.Subtraces--
+		}
+		traces = append(traces, &cpy)
+	}
+	upstream.Reorg(&backend.FixtureBlock{Header: header, Transactions: block.Transactions, Traces: traces})
+
+	report := Block(ctx, b, number)
+	if report.OK() || report.DBFrames != len(block.Traces) || report.UpstreamFrames != len(traces) {
+		t.Fatalf("reorged block: %+v", report)
+	}
+	kinds := make(map[string]int)
+	for _, m := range report.Mismatches {
+		kinds[m.Kind]++
+	}
+	if kinds[KindExtra] != 1 {
+		t.Errorf("mismatches %v, want the reverted sub call as extra", kinds)
+	}
+
+	upstream.Fail("trace_block", 1, &upstreamtest.Error{Code: -32000, Message: "unavailable"})
+	if report := Block(ctx, b, number); report.Error == "" {
+		t.Error("upstream failure not reported")
+	}
+}
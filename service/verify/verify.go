@@ -0,0 +1,272 @@
+// Package verify checks the traces table against the upstream trace_block,
+// frame by frame and field by field.
+package verify
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+// Mismatch kinds.
+const (
+	KindMissing = "missing" // Frame returned by upstream only
+	KindExtra   = "extra"   // Frame stored in the database only
+	KindOrder   = "order"   // Frame returned at a different position
+	KindValue   = "value"   // Value or balance differs
+	KindGas     = "gas"     // Gas or gas used differs
+	KindField   = "field"   // Any other field differs
+)
+
+// maxMismatches bounds the mismatches reported per block, a block missing
+// entirely would otherwise list every frame.
+const maxMismatches = 100
+
+// Mismatch is a single difference between the database and upstream.
+type Mismatch struct {
+	Kind                string       `json:"kind"`
+	TransactionPosition uint64       `json:"transactionPosition"`
+	TransactionHash     *common.Hash `json:"transactionHash,omitempty"`
+	TraceAddress        []int        `json:"traceAddress"`
+	Field               string       `json:"field,omitempty"`
+	DB                  string       `json:"db,omitempty"`
+	Upstream            string       `json:"upstream,omitempty"`
+}
+
+// BlockReport is the outcome of the verification of a block.
+type BlockReport struct {
+	BlockNumber    uint64      `json:"blockNumber"`
+	DBFrames       int         `json:"dbFrames"`
+	UpstreamFrames int         `json:"upstreamFrames"`
+	Error          string      `json:"error,omitempty"` // Set if the block could not be verified
+	Mismatches     []*Mismatch `json:"mismatches,omitempty"`
+	Truncated      bool        `json:"truncated,omitempty"`
+}
+
+// OK reports whether the block was verified without differences.
+func (r *BlockReport) OK() bool {
+	return r.Error == "" && len(r.Mismatches) == 0
+}
+
+// Report summarises the verification of a block range, only the blocks which
+// failed to verify are listed.
+type Report struct {
+	FromBlock  uint64         `json:"fromBlock"`
+	ToBlock    uint64         `json:"toBlock"`
+	Blocks     int            `json:"blocks"` // Number of blocks checked
+	Frames     int            `json:"frames"` // Number of upstream frames checked
+	Mismatched int            `json:"mismatched"`
+	Errors     int            `json:"errors"`
+	Failures   []*BlockReport `json:"failures"`
+}
+
+// OK reports whether every block was verified without differences.
+func (r *Report) OK() bool {
+	return r.Mismatched == 0 && r.Errors == 0
+}
+
+// Add accounts the report of a block.
+func (r *Report) Add(block *BlockReport) {
+	r.Blocks++
+	r.Frames += block.UpstreamFrames
+	switch {
+	case block.Error != "":
+		r.Errors++
+	case len(block.Mismatches) > 0:
+		r.Mismatched++
+	default:
+		return
+	}
+	r.Failures = append(r.Failures, block)
+	sort.Slice(r.Failures, func(i, j int) bool {
+		return r.Failures[i].BlockNumber < r.Failures[j].BlockNumber
+	})
+}
+
+// Block compares the frames of a block in the database with upstream.
+func Block(ctx context.Context, b backend.Backend, number uint64) *BlockReport {
+	report := &BlockReport{BlockNumber: number}
+	upstream, err := b.UpstreamTraceBlock(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		report.Error = fmt.Sprintf("upstream: %v", err)
+		return report
+	}
+	db, err := b.TraceBlock(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		report.Error = fmt.Sprintf("database: %v", err)
+		return report
+	}
+	report.DBFrames, report.UpstreamFrames = len(db), len(upstream)
+	report.Mismatches = Compare(db, upstream)
+	if len(report.Mismatches) > maxMismatches {
+		report.Mismatches, report.Truncated = report.Mismatches[:maxMismatches], true
+	}
+	return report
+}
+
+// frameKeys identify the frames within a block. Rewards carry no transaction,
+// they are told apart by their position among the rewards.
+func frameKeys(frames []*backend.CallFrame) []string {
+	var (
+		keys    = make([]string, len(frames))
+		rewards int
+	)
+	for i, frame := range frames {
+		if strings.EqualFold(frame.Type, "reward") {
+			keys[i] = fmt.Sprintf("reward/%d", rewards)
+			rewards++
+			continue
+		}
+		keys[i] = fmt.Sprintf("%d/%v", frame.TransactionPosition, frame.TraceAddress)
+	}
+	return keys
+}
+
+func newMismatch(kind string, frame *backend.CallFrame) *Mismatch {
+	m := &Mismatch{
+		Kind:                kind,
+		TransactionPosition: frame.TransactionPosition,
+		TraceAddress:        frame.TraceAddress,
+	}
+	if frame.TransactionHash != nil && *frame.TransactionHash != (common.Hash{}) {
+		hash := *frame.TransactionHash
+		m.TransactionHash = &hash
+	}
+	return m
+}
+
+// Compare diffs the frames of a block stored in the database against the
+// ones returned by upstream, in upstream order.
+func Compare(db, upstream []*backend.CallFrame) []*Mismatch {
+	var (
+		mismatches []*Mismatch
+		dbKeys     = frameKeys(db)
+		upKeys     = frameKeys(upstream)
+		dbIndex    = make(map[string]int, len(db))
+		upIndex    = make(map[string]int, len(upstream))
+	)
+	for i, key := range dbKeys {
+		dbIndex[key] = i
+	}
+	for i, key := range upKeys {
+		upIndex[key] = i
+	}
+	// Walk the common frames in upstream order, a frame out of place in the
+	// database breaks the increasing sequence of database positions.
+	last := -1
+	for i, key := range upKeys {
+		j, ok := dbIndex[key]
+		if !ok {
+			mismatches = append(mismatches, newMismatch(KindMissing, upstream[i]))
+			continue
+		}
+		if j < last {
+			m := newMismatch(KindOrder, upstream[i])
+			m.DB, m.Upstream = fmt.Sprint(j), fmt.Sprint(i)
+			mismatches = append(mismatches, m)
+		}
+		last = j
+		have, want := fields(db[j]), fields(upstream[i])
+		for _, name := range fieldNames {
+			if have[name] == want[name] {
+				continue
+			}
+			m := newMismatch(fieldKind(name), upstream[i])
+			m.Field, m.DB, m.Upstream = name, have[name], want[name]
+			mismatches = append(mismatches, m)
+		}
+	}
+	for j, key := range dbKeys {
+		if _, ok := upIndex[key]; !ok {
+			mismatches = append(mismatches, newMismatch(KindExtra, db[j]))
+		}
+	}
+	return mismatches
+}
+
+// fieldNames are the compared fields, in reporting order.
+var fieldNames = []string{
+	"type", "callType", "from", "to", "value", "gas", "input", "init",
+	"author", "rewardType", "address", "balance", "refundAddress",
+	"error", "subtraces", "transactionHash",
+	"result.gasUsed", "result.output", "result.address", "result.code",
+}
+
+func fieldKind(name string) string {
+	switch name {
+	case "value", "balance":
+		return KindValue
+	case "gas", "result.gasUsed":
+		return KindGas
+	}
+	return KindField
+}
+
+func fmtAddress(a *common.Address) string {
+	if a == nil {
+		return ""
+	}
+	return strings.ToLower(a.Hex())
+}
+
+func fmtBig(v *big.Int) string {
+	if v == nil {
+		return "0"
+	}
+	return v.String()
+}
+
+func fmtUint(v *uint64) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(*v)
+}
+
+func fmtBytes(b *[]byte) string {
+	if b == nil {
+		return "0x"
+	}
+	return hexutil.Encode(*b)
+}
+
+// fields flattens a frame into its normalised field values. Results of
+// failed frames are skipped, the tracers disagree on whether to keep them.
+func fields(frame *backend.CallFrame) map[string]string {
+	action := frame.Action
+	f := map[string]string{
+		"type":          strings.ToLower(frame.Type),
+		"callType":      strings.ToLower(action.CallType),
+		"from":          fmtAddress(action.From),
+		"to":            fmtAddress(action.To),
+		"value":         fmtBig(action.Value),
+		"gas":           fmtUint(action.Gas),
+		"input":         fmtBytes(action.Input),
+		"init":          fmtBytes(action.Init),
+		"author":        fmtAddress(action.Author),
+		"rewardType":    strings.ToLower(action.RewardType),
+		"address":       fmtAddress(action.SelfDestructed),
+		"balance":       fmtBig(action.Balance),
+		"refundAddress": fmtAddress(action.RefundAddress),
+		"error":         frame.Error,
+		"subtraces":     fmt.Sprint(frame.Subtraces),
+	}
+	if frame.TransactionHash != nil && *frame.TransactionHash != (common.Hash{}) {
+		f["transactionHash"] = frame.TransactionHash.Hex()
+	}
+	if frame.Error == "" && frame.Result != nil {
+		f["result.gasUsed"] = fmtUint(frame.Result.GasUsed)
+		f["result.output"] = fmtBytes(frame.Result.Output)
+		f["result.address"] = fmtAddress(frame.Result.Address)
+		f["result.code"] = fmtBytes(frame.Result.Code)
+	}
+	return f
+}
@@ -0,0 +1,60 @@
+package verify
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/jsvisa/hdt/backend"
+)
+
+func TestCompare(t *testing.T) {
+	var (
+		tx   = common.HexToHash("0x01")
+		from = common.HexToAddress("0xaa")
+		to   = common.HexToAddress("0xbb")
+		call = func(traceAddress []int, value int64, gasUsed uint64) *backend.CallFrame {
+			return &backend.CallFrame{
+				Type:            "call",
+				TransactionHash: &tx,
+				TraceAddress:    traceAddress,
+				Action:          backend.CallAction{CallType: "call", From: &from, To: &to, Value: big.NewInt(value)},
+				Result:          &backend.CallResult{GasUsed: &gasUsed},
+			}
+		}
+	)
+	upstream := []*backend.CallFrame{
+		call([]int{}, 1, 100),
+		call([]int{0}, 0, 50),
+		call([]int{1}, 0, 20),
+		call([]int{2}, 0, 10),
+	}
+	db := []*backend.CallFrame{
+		call([]int{}, 1, 100),
+		call([]int{1}, 0, 20),
+		call([]int{0}, 7, 50),
+		call([]int{3}, 0, 5),
+	}
+	want := []struct {
+		kind  string
+		field string
+	}{
+		{KindValue, "value"},
+		{KindOrder, ""},
+		{KindMissing, ""},
+		{KindExtra, ""},
+	}
+	have := Compare(db, upstream)
+	if len(have) != len(want) {
+		t.Fatalf("mismatches count: have %d, want %d: %+v", len(have), len(want), have)
+	}
+	for i, m := range have {
+		if m.Kind != want[i].kind || m.Field != want[i].field {
+			t.Errorf("mismatch %d: have %s/%s, want %s/%s", i, m.Kind, m.Field, want[i].kind, want[i].field)
+		}
+	}
+	if m := Compare(upstream, upstream); len(m) != 0 {
+		t.Errorf("identical frames mismatched: %+v", m)
+	}
+}